@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/daemon"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/sfomuseum/go-flags/flagset"
+)
+
+// runDeadLetter implements the `webhookd dlq` subcommand for inspecting and replaying dead letters. It returns the process exit code.
+func runDeadLetter(args []string) int {
+
+	fs := flagset.NewFlagSet("dlq")
+
+	configFile := fs.String("config", "/etc/config/config.yaml", "Path to config file")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Inspect, replay and purge webhook messages that dispatchers failed to relay.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s dlq [options] list|show ID|replay ID|ALL|purge ID|ALL\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+
+	if err != nil {
+		return 1
+	}
+
+	posargs := fs.Args()
+
+	if len(posargs) == 0 {
+		fs.Usage()
+		return 1
+	}
+
+	action := posargs[0]
+	var id string
+
+	if len(posargs) > 1 {
+		id = posargs[1]
+	}
+
+	if action != "list" && id == "" {
+		fmt.Fprintf(os.Stderr, "Missing dead letter ID for '%s'\n", action)
+		return 1
+	}
+
+	ctx := context.Background()
+
+	cfg, err := config.NewConfig(*configFile)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config %s, %v\n", *configFile, err)
+		return 1
+	}
+
+	if cfg.DeadLetter == "" {
+		fmt.Fprintf(os.Stderr, "Config %s does not define a dead_letter store\n", *configFile)
+		return 1
+	}
+
+	webhookDaemon, err := daemon.NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create webhook daemon, %v\n", err)
+		return 1
+	}
+
+	defer webhookDaemon.Close()
+
+	store := webhookDaemon.DeadLetters()
+
+	ids := []string{id}
+
+	if id == "ALL" {
+
+		entries, err := store.List(ctx)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list dead letters, %v\n", err)
+			return 1
+		}
+
+		ids = make([]string, len(entries))
+
+		for idx, e := range entries {
+			ids[idx] = e.ID
+		}
+	}
+
+	switch action {
+	case "list":
+
+		entries, err := store.List(ctx)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list dead letters, %v\n", err)
+			return 1
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tENDPOINT\tDISPATCHER\tREQUEST ID\tFAILED\tREPLAYS\tERROR")
+
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", e.ID, e.Endpoint, e.Dispatcher, e.RequestID, e.Failed.Format(time.RFC3339), e.Replays, e.Error)
+		}
+
+		tw.Flush()
+
+	case "show":
+
+		e, err := store.Get(ctx, id)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get dead letter '%s', %v\n", id, err)
+			return 1
+		}
+
+		body := e.Body
+		e.Body = nil
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(e)
+
+		fmt.Println(string(body))
+
+	case "replay":
+
+		failed := 0
+
+		for _, id := range ids {
+
+			r, err := webhookDaemon.ReplayDeadLetter(ctx, id)
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to replay dead letter '%s', %v\n", id, err)
+				failed += 1
+				continue
+			}
+
+			if r.Outcome == webhookd.DispatchOutcomeFailed {
+				fmt.Printf("%s\t%s\t%s\n", id, r.Outcome, r.Error)
+				failed += 1
+				continue
+			}
+
+			fmt.Printf("%s\t%s\n", id, r.Outcome)
+		}
+
+		if failed > 0 {
+			return 1
+		}
+
+	case "purge":
+
+		for _, id := range ids {
+
+			err := store.Delete(ctx, id)
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to purge dead letter '%s', %v\n", id, err)
+				return 1
+			}
+
+			fmt.Printf("%s\tpurged\n", id)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid action '%s'\n", action)
+		fs.Usage()
+		return 1
+	}
+
+	return 0
+}
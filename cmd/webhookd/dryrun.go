@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/daemon"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/multi"
+)
+
+// runDryRun implements the `webhookd test` subcommand for running a payload through a webhook's receiver,
+// transformations and (optionally) dispatchers without starting the daemon. It returns the process exit code.
+func runDryRun(args []string) int {
+
+	fs := flagset.NewFlagSet("test")
+
+	configFile := fs.String("config", "/etc/config/config.yaml", "Path to config file")
+	endpoint := fs.String("endpoint", "", "The endpoint of the webhook to test, for example \"/github\".")
+	payload := fs.String("payload", "", "Path to a file containing the request body, or \"-\" to read it from STDIN.")
+	method := fs.String("method", http.MethodPost, "The HTTP method of the request.")
+	dispatch := fs.Bool("dispatch", false, "Relay the message to the webhook's dispatchers for real, instead of only showing what would be sent.")
+
+	var headers multi.MultiString
+	fs.Var(&headers, "header", "A request header in the form \"Name: value\". May be repeated. Default Content-Type is application/json.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Run a payload through a webhook's receiver and transformations and show the payload each dispatcher would send.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s test [options] -endpoint PATH -payload FILE\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+
+	if err != nil {
+		return 1
+	}
+
+	if *endpoint == "" || *payload == "" {
+		fs.Usage()
+		return 1
+	}
+
+	var body []byte
+
+	if *payload == "-" {
+		body, err = io.ReadAll(os.Stdin)
+	} else {
+		body, err = os.ReadFile(*payload)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read payload %s, %v\n", *payload, err)
+		return 1
+	}
+
+	cfg, err := config.NewConfig(*configFile)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config %s, %v\n", *configFile, err)
+		return 1
+	}
+
+	// Log lines are written to STDERR so they don't get mixed up with the messages written to STDOUT.
+
+	closeLog, err := logger.Setup(&logger.Options{
+		Level:  cfg.Logging.Level,
+		Format: cfg.Logging.Format,
+		Output: logger.OutputStderr,
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logging, %v\n", err)
+		return 1
+	}
+
+	defer closeLog()
+
+	ctx := context.Background()
+
+	webhookDaemon, err := daemon.NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create webhook daemon, %v\n", err)
+		return 1
+	}
+
+	defer webhookDaemon.Close()
+
+	req := httptest.NewRequest(strings.ToUpper(*method), *endpoint, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	for _, h := range headers {
+
+		k, v, ok := strings.Cut(h, ":")
+
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Invalid header '%s', must be in the form \"Name: value\"\n", h)
+			return 1
+		}
+
+		req.Header.Set(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+
+	result, err := webhookDaemon.DryRun(req, *dispatch)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	transformations := transformationNames(cfg, *endpoint)
+	show_route := result.Route != ""
+
+	for _, step := range result.Steps {
+
+		var label string
+
+		switch step.Stage {
+		case daemon.DryRunStageReceiver:
+			label = "receiver"
+		case daemon.DryRunStageTransformation:
+			label = fmt.Sprintf("transformation %d (%s)", step.Offset+1, transformations[step.Offset])
+		case daemon.DryRunStageDispatcher:
+
+			if show_route {
+				fmt.Printf("--- route %s\n", result.Route)
+				show_route = false
+			}
+
+			outcome := "would send"
+
+			if step.Result != nil {
+
+				outcome = step.Result.Outcome
+
+				if step.Result.Error != nil {
+					outcome = fmt.Sprintf("%s, %v", outcome, step.Result.Error)
+				}
+			}
+
+			label = fmt.Sprintf("dispatcher %s (%s)", step.Name, outcome)
+		}
+
+		if step.Error != nil {
+			fmt.Printf("--- %s: %v\n", label, step.Error)
+			continue
+		}
+
+		// Dispatchers may send a payload derived from the message, for example a PagerDuty event,
+		// rather than the message itself.
+
+		body := step.Message.Body
+
+		if step.Payload != nil {
+			body = step.Payload
+		}
+
+		fmt.Printf("--- %s\n", label)
+		os.Stdout.Write(body)
+
+		if !bytes.HasSuffix(body, []byte("\n")) {
+			fmt.Println()
+		}
+	}
+
+	switch {
+	case result.Halted:
+		fmt.Println("--- halted, nothing would be dispatched")
+	case result.Failed() == nil && !result.Routed:
+		fmt.Println("--- no route matched, nothing would be dispatched")
+	}
+
+	if result.Failed() != nil {
+		return 1
+	}
+
+	if result.Summary != nil {
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result.Summary)
+
+		if !result.Summary.Success {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// transformationNames returns the labels of the transformations applied by the webhook for 'endpoint' in 'cfg', in the
+// order they are applied. Disabled transformations, whose labels begin with "#", are skipped like they are by the daemon.
+func transformationNames(cfg *config.WebhookConfig, endpoint string) []string {
+
+	names := make([]string, 0)
+
+	for _, hook := range cfg.Webhooks {
+
+		if hook.Endpoint != endpoint {
+			continue
+		}
+
+		for _, name := range hook.Transformations {
+
+			if !strings.HasPrefix(name, "#") {
+				names = append(names, name)
+			}
+		}
+
+		break
+	}
+
+	return names
+}
@@ -3,31 +3,57 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/bobertrublik/webhook-router/internal/config"
 	"github.com/bobertrublik/webhook-router/internal/daemon"
 	"github.com/bobertrublik/webhook-router/internal/logger"
 	"github.com/bobertrublik/webhook-router/internal/router"
+	"github.com/bobertrublik/webhook-router/internal/server"
+	"github.com/bobertrublik/webhook-router/internal/tracing"
 	"github.com/joho/godotenv"
 	"github.com/sfomuseum/go-flags/flagset"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 
-	if err := godotenv.Load(); err != nil {
-		logger.Log.Error("Error loading the .env file: %v", err)
+	// The .env file is optional so that subcommands like validate can be run in CI without one.
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Log.Error("Failed to load .env file", "error", err)
 		os.Exit(1)
 	}
 
+	if len(os.Args) > 1 {
+
+		switch os.Args[1] {
+		case "dlq":
+			os.Exit(runDeadLetter(os.Args[2:]))
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "test":
+			os.Exit(runDryRun(os.Args[2:]))
+		}
+	}
+
 	fs := flagset.NewFlagSet("webhooks")
 
 	configFile := fs.String("config", "/etc/config/config.yaml", "Path to config file")
+	listen := fs.String("listen", "", "The address to listen on, for example \"0.0.0.0:8080\". Overrides the server.listen setting in the config file.")
+	watch := fs.Bool("watch", true, "Reload the config file when it changes. The config file is always reloaded on SIGHUP.")
+	logLevel := fs.String("log-level", "", "The minimum level of messages that are logged: debug, info, warn or error. Overrides the logging.level setting in the config file.")
+	logFormat := fs.String("log-format", "", "The format of log lines: json or text. Overrides the logging.format setting in the config file.")
+	logOutput := fs.String("log-output", "", "Where log lines are written: stdout, stderr or the path of a file. Overrides the logging.output setting in the config file.")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, "webhookd is a command line tool to start a go-webhookd daemon and serve requests over HTTP.\n")
 		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t %s dlq [options] list|show|replay|purge\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t %s validate [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t %s test [options] -endpoint PATH -payload FILE\n", os.Args[0])
 		fs.PrintDefaults()
 	}
 
@@ -36,23 +62,108 @@ func main() {
 	cfg, err := config.NewConfig(*configFile)
 
 	if err != nil {
-		logger.Log.Error("Failed to load config %s, %v", configFile, err)
+		logger.Log.Error("Failed to load config", "path", *configFile, "error", err)
 		os.Exit(1)
 	}
+
+	log_opts := &logger.Options{
+		Level:  cfg.Logging.Level,
+		Format: cfg.Logging.Format,
+		Output: cfg.Logging.Output,
+	}
+
+	if *logLevel != "" {
+		log_opts.Level = *logLevel
+	}
+
+	if *logFormat != "" {
+		log_opts.Format = *logFormat
+	}
+
+	if *logOutput != "" {
+		log_opts.Output = *logOutput
+	}
+
+	closeLog, err := logger.Setup(log_opts)
+
+	if err != nil {
+		logger.Log.Error("Failed to set up logging", "error", err)
+		os.Exit(1)
+	}
+
+	defer closeLog()
+
 	ctx := context.Background()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+
+	if err != nil {
+		logger.Log.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	webhookDaemon, err := daemon.NewWebhookDaemonFromConfig(ctx, cfg)
 
 	if err != nil {
-		logger.Log.Error("Failed to create webhook daemon, %v", err)
+		logger.Log.Error("Failed to create webhook daemon", "error", err)
 		os.Exit(1)
 	}
 
 	rtr := router.New(webhookDaemon)
 
-	logger.Log.Info("Server listening on http://localhost:8080")
-	if err := http.ListenAndServe("0.0.0.0:8080", rtr); err != nil {
-		logger.Log.Error("There was an error with the http server: %v", err)
+	if *listen != "" {
+		cfg.Server.Listen = *listen
+	}
+
+	srv, err := server.NewServerFromConfig(cfg.Server, rtr)
+
+	if err != nil {
+		logger.Log.Error("Failed to create HTTP server", "error", err)
+		os.Exit(1)
+	}
+
+	err = webhookDaemon.Start(ctx)
+
+	if err != nil {
+		logger.Log.Error("Failed to start webhook daemon", "error", err)
+		os.Exit(1)
+	}
+
+	err = watchConfig(ctx, webhookDaemon, *configFile, *watch)
+
+	if err != nil {
+		logger.Log.Error("Failed to watch config file", "error", err)
+		os.Exit(1)
+	}
+
+	// The server stops accepting new requests on SIGINT or SIGTERM and waits for in-flight
+	// requests to complete. Queued messages are delivered, or left for the next start, once
+	// the daemon is closed.
+
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = srv.Run(sigCtx)
+
+	if err != nil {
+		logger.Log.Error("There was an error with the HTTP server", "error", err)
+	}
+
+	closeErr := webhookDaemon.Close()
+
+	if closeErr != nil {
+		logger.Log.Error("Failed to close webhook daemon", "error", closeErr)
+	}
+
+	// Flush any spans that have not been exported yet.
+
+	tracingErr := shutdownTracing(context.Background())
+
+	if tracingErr != nil {
+		logger.Log.Error("Failed to shut down tracing", "error", tracingErr)
+	}
+
+	if err != nil || closeErr != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/daemon"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+)
+
+// watchConfig reloads the webhooks configured for 'webhookDaemon' from 'configFile' whenever the process receives
+// SIGHUP and, if 'watch' is true, whenever the file changes. It returns once the triggers are in place; reloads
+// happen in the background until 'ctx' is cancelled. A config that fails to load or validate is logged and the
+// daemon keeps its current webhooks.
+func watchConfig(ctx context.Context, webhookDaemon *daemon.WebhookDaemon, configFile string, watch bool) error {
+
+	// Reloads are processed one at a time. Triggers that arrive while a reload is pending are
+	// coalesced since the pending reload will read the latest version of the file anyway.
+
+	reloads := make(chan string, 1)
+
+	trigger := func(reason string) {
+		select {
+		case reloads <- reason:
+		default:
+		}
+	}
+
+	if watch {
+
+		err := config.Watch(ctx, configFile, config.DefaultWatchDelay, func() { trigger("file changed") })
+
+		if err != nil {
+			return err
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+
+		defer signal.Stop(hup)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				trigger("SIGHUP")
+			case reason := <-reloads:
+
+				logger.Log.Info("Reloading config", "path", configFile, "reason", reason)
+
+				cfg, err := config.NewConfig(configFile)
+
+				if err != nil {
+					logger.Log.Error("Failed to reload config, keeping previous config", "path", configFile, "error", err)
+					continue
+				}
+
+				err = webhookDaemon.Reload(ctx, cfg)
+
+				if err != nil {
+					logger.Log.Error("Failed to reload config, keeping previous config", "path", configFile, "error", err)
+					continue
+				}
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/daemon"
+	"github.com/sfomuseum/go-flags/flagset"
+	"gopkg.in/yaml.v3"
+)
+
+// runValidate implements the `webhookd validate` subcommand for checking a config file without starting the daemon.
+// It returns the process exit code, which is non-zero if any problems are found.
+func runValidate(args []string) int {
+
+	fs := flagset.NewFlagSet("validate")
+
+	configFile := fs.String("config", "/etc/config/config.yaml", "Path to config file")
+	printConfig := fs.Bool("print", false, "Print the config to STDOUT, with references to environment variables and files resolved and their values redacted.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Check a config file for problems without starting the daemon. Every problem found is reported.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s validate [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+
+	if err != nil {
+		return 1
+	}
+
+	ctx := context.Background()
+
+	// Keep track of the values resolved from environment variables and files so that they can be
+	// redacted from any problems reported, for example in a URI that failed to parse.
+
+	secrets := make([]string, 0)
+
+	lookup := func(ref string) (string, bool, error) {
+
+		v, ok, err := config.LookupReference(ref)
+
+		if ok && len(v) >= config.MinRedactLength {
+			secrets = append(secrets, v)
+		}
+
+		return v, ok, err
+	}
+
+	report := func(errs []error) int {
+
+		// Longer values first, in case one secret contains another.
+
+		sort.Slice(secrets, func(i, j int) bool {
+			return len(secrets[i]) > len(secrets[j])
+		})
+
+		for _, err := range errs {
+
+			msg := err.Error()
+
+			for _, s := range secrets {
+				msg = strings.ReplaceAll(msg, s, config.Redacted)
+			}
+
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *configFile, msg)
+		}
+
+		fmt.Fprintf(os.Stderr, "Found %d problem(s) in %s\n", len(errs), *configFile)
+		return 1
+	}
+
+	cfg, err := config.NewConfigWithLookup(*configFile, lookup)
+
+	if err != nil {
+
+		// Every reference that can't be resolved is reported, as a list of joined errors.
+
+		joined, ok := err.(interface{ Unwrap() []error })
+
+		if !ok {
+			return report([]error{fmt.Errorf("Failed to load config, %w", err)})
+		}
+
+		return report(joined.Unwrap())
+	}
+
+	if *printConfig {
+
+		redacted, err := config.NewConfigWithLookup(*configFile, config.RedactReference)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load redacted config %s, %v\n", *configFile, err)
+			return 1
+		}
+
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+
+		err = enc.Encode(redacted)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print config, %v\n", err)
+			return 1
+		}
+
+		enc.Close()
+	}
+
+	errs := daemon.ValidateConfig(ctx, cfg)
+
+	if len(errs) > 0 {
+		return report(errs)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s is valid\n", *configFile)
+	return 0
+}
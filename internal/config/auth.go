@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// type WebhookAuthConfig is a struct containing the authentication policy for an individual webhook.
+type WebhookAuthConfig struct {
+	// Mode is the authentication mode for the webhook. Valid options are "none" (the default), "jwt", "api-key" and "basic".
+	Mode string `json:"mode" yaml:"mode"`
+	// JWT contains the settings used when `Mode` is "jwt".
+	JWT *WebhookJWTConfig `json:"jwt,omitempty" yaml:"jwt,omitempty"`
+	// APIKey contains the settings used when `Mode` is "api-key".
+	APIKey *WebhookAPIKeyConfig `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	// Basic contains the settings used when `Mode` is "basic".
+	Basic *WebhookBasicConfig `json:"basic,omitempty" yaml:"basic,omitempty"`
+}
+
+// type WebhookJWTConfig is a struct containing the settings used to validate JSON Web Tokens.
+type WebhookJWTConfig struct {
+	// Issuer is the URL of the token issuer. Signing keys are fetched from its `.well-known/jwks.json` document
+	// unless `JWKSURI` is set.
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// Audience is the list of audiences a token must be issued for (any one of them is sufficient).
+	Audience []string `json:"audience" yaml:"audience"`
+	// Algorithms is the list of signature algorithms accepted. Defaults to "RS256".
+	Algorithms []string `json:"algorithms,omitempty" yaml:"algorithms,omitempty"`
+	// Scopes is the list of scopes that must all be present in the token's "scope" claim.
+	Scopes []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	// JWKSURI is an optional URL for the issuer's JSON Web Key Set.
+	JWKSURI string `json:"jwks_uri,omitempty" yaml:"jwks_uri,omitempty"`
+}
+
+// type WebhookAPIKeyConfig is a struct containing the settings used to validate static API keys.
+type WebhookAPIKeyConfig struct {
+	// Header is the name of the request header containing the API key. Defaults to "X-API-Key".
+	Header string `json:"header,omitempty" yaml:"header,omitempty"`
+	// KeyEnv is the name of the environment variable containing one or more (comma or newline separated) valid keys.
+	KeyEnv string `json:"key_env,omitempty" yaml:"key_env,omitempty"`
+	// KeyFile is the path to a file containing one or more (comma or newline separated) valid keys.
+	KeyFile string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+}
+
+// type WebhookBasicConfig is a struct containing the settings used to validate HTTP basic authentication credentials.
+type WebhookBasicConfig struct {
+	// Username is the expected username.
+	Username string `json:"username" yaml:"username"`
+	// PasswordEnv is the name of the environment variable containing the expected password.
+	PasswordEnv string `json:"password_env,omitempty" yaml:"password_env,omitempty"`
+	// PasswordFile is the path to a file containing the expected password.
+	PasswordFile string `json:"password_file,omitempty" yaml:"password_file,omitempty"`
+	// Realm is the realm reported in the "WWW-Authenticate" header of failed requests. Defaults to "webhookd".
+	Realm string `json:"realm,omitempty" yaml:"realm,omitempty"`
+}
+
+// UnmarshalYAML allows the `auth` block to be written as a single mode string (for example `auth: "jwt"`)
+// as well as a complete dictionary.
+func (a *WebhookAuthConfig) UnmarshalYAML(value *yaml.Node) error {
+
+	if value.Kind == yaml.ScalarNode {
+		a.Mode = value.Value
+		return nil
+	}
+
+	type plain WebhookAuthConfig
+
+	var p plain
+
+	err := value.Decode(&p)
+
+	if err != nil {
+		return fmt.Errorf("Failed to decode auth config, %w", err)
+	}
+
+	*a = WebhookAuthConfig(p)
+	return nil
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// type WebhookDispatcherConfig is a struct containing configuration information for a named dispatcher.
+type WebhookDispatcherConfig struct {
+	// URI is the URI used to instantiate the dispatcher.
+	URI string `json:"uri" yaml:"uri"`
+	// Retry is an optional policy for retrying failed dispatches.
+	Retry *WebhookRetryConfig `json:"retry,omitempty" yaml:"retry,omitempty"`
+	// Options is an optional dictionary of dispatcher-specific settings. They are passed to the dispatcher
+	// encoded as query parameters in the fragment of `URI` (see `URIWithOptions`).
+	Options WebhookOptions `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// type WebhookOptions is a dictionary of named settings where each setting has one or more values. In YAML
+// each value may be written as either a single string or a list of strings.
+type WebhookOptions map[string][]string
+
+// UnmarshalYAML decodes a dictionary whose values are either scalars or lists of scalars.
+func (o *WebhookOptions) UnmarshalYAML(value *yaml.Node) error {
+
+	var raw map[string]yaml.Node
+
+	err := value.Decode(&raw)
+
+	if err != nil {
+		return fmt.Errorf("Failed to decode options, %w", err)
+	}
+
+	opts := make(WebhookOptions)
+
+	for k, v := range raw {
+
+		switch v.Kind {
+		case yaml.ScalarNode:
+			opts[k] = []string{v.Value}
+		case yaml.SequenceNode:
+
+			var values []string
+
+			err := v.Decode(&values)
+
+			if err != nil {
+				return fmt.Errorf("Failed to decode option '%s', %w", k, err)
+			}
+
+			opts[k] = values
+
+		default:
+			return fmt.Errorf("Invalid value for option '%s', must be a string or a list of strings", k)
+		}
+	}
+
+	*o = opts
+	return nil
+}
+
+// URIWithOptions returns the dispatcher's URI with `Options` appended to any parameters already present in the URI's
+// fragment. The fragment is used, rather than the query string, because for some dispatchers (for example `http://`)
+// the query string is part of the destination and because fragments are never sent over the wire.
+func (d WebhookDispatcherConfig) URIWithOptions() (string, error) {
+
+	if len(d.Options) == 0 {
+		return d.URI, nil
+	}
+
+	u, err := url.Parse(d.URI)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	params, err := url.ParseQuery(u.EscapedFragment())
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse URI fragment, %w", err)
+	}
+
+	keys := make([]string, 0, len(d.Options))
+
+	for k := range d.Options {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range d.Options[k] {
+			params.Add(k, v)
+		}
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	return u.String() + "#" + params.Encode(), nil
+}
+
+// type WebhookRetryConfig is a struct containing the policy for retrying failed dispatches.
+type WebhookRetryConfig struct {
+	// MaxAttempts is the maximum number of times a message will be dispatched, including the first attempt. Defaults to 3.
+	MaxAttempts int `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	// BaseDelay is the delay before the first retry, doubled for each subsequent retry. Defaults to "500ms".
+	BaseDelay string `json:"base_delay,omitempty" yaml:"base_delay,omitempty"`
+	// MaxDelay is the upper bound for the delay between retries. Defaults to "30s".
+	MaxDelay string `json:"max_delay,omitempty" yaml:"max_delay,omitempty"`
+	// Jitter is the fraction (0.0 - 1.0) of each delay that is randomized to avoid retries from many requests happening in lockstep.
+	Jitter float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	// StatusCodes is the list of error codes that are considered retryable. Network errors are reported as 502 and timeouts as 504.
+	// Defaults to 408, 425, 429, 500, 502, 503 and 504.
+	StatusCodes []int `json:"status_codes,omitempty" yaml:"status_codes,omitempty"`
+}
+
+// UnmarshalYAML allows a dispatcher to be defined as a single URI string (for example `log: "log://"`)
+// as well as a complete dictionary.
+func (d *WebhookDispatcherConfig) UnmarshalYAML(value *yaml.Node) error {
+
+	if value.Kind == yaml.ScalarNode {
+		d.URI = value.Value
+		return nil
+	}
+
+	type plain WebhookDispatcherConfig
+
+	var p plain
+
+	err := value.Decode(&p)
+
+	if err != nil {
+		return fmt.Errorf("Failed to decode dispatcher config, %w", err)
+	}
+
+	*d = WebhookDispatcherConfig(p)
+	return nil
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Redacted is the value substituted for references resolved by `RedactReference`.
+const Redacted string = "[REDACTED]"
+
+// MinRedactLength is the minimum length of a value resolved from an environment variable or file for it to be redacted
+// from errors by `WebhookConfig.Redact`.
+const MinRedactLength int = 8
+
+// filePrefix is the prefix of references to the contents of a file, rather than an environment variable.
+const filePrefix string = "file:"
+
+// LookupFunc is a function used by `Interpolate` to resolve a reference, which is either the name of an environment
+// variable or "file:" followed by the path of a file. It returns false if the variable or file does not exist.
+type LookupFunc func(ref string) (string, bool, error)
+
+// LookupReference resolves 'ref' to the value of the environment variable it names or, if it begins with "file:", the
+// contents of the file at the path that follows. Trailing whitespace (typically a newline left behind by editors or
+// `kubectl create secret`) is removed from the contents of files.
+func LookupReference(ref string) (string, bool, error) {
+
+	path, is_file := strings.CutPrefix(ref, filePrefix)
+
+	if !is_file {
+		v, ok := os.LookupEnv(ref)
+		return v, ok, nil
+	}
+
+	b, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+
+	if err != nil {
+		return "", false, fmt.Errorf("Failed to read file '%s', %w", path, err)
+	}
+
+	return strings.TrimRight(string(b), " \t\r\n"), true, nil
+}
+
+// RedactReference resolves 'ref' in the same way as `LookupReference` but returns `Redacted` in place of its value, so
+// that a config can be shown without revealing its secrets. Defaults are still used for references that don't exist.
+func RedactReference(ref string) (string, bool, error) {
+
+	_, ok, err := LookupReference(ref)
+
+	if err != nil || !ok {
+		return "", ok, err
+	}
+
+	return Redacted, true, nil
+}
+
+// Interpolate returns 'str' with each reference in the form of:
+//
+//	${NAME}
+//	${NAME:-DEFAULT}
+//	${file:PATH}
+//	${file:PATH:-DEFAULT}
+//
+// replaced by the value returned by 'lookup'. DEFAULT is used if the environment variable or file does not exist or is
+// empty. It is an error for a reference without a default not to exist. Write "$${" for a literal "${".
+func Interpolate(str string, lookup LookupFunc) (string, error) {
+	return replaceReferences(str, lookup, false)
+}
+
+// InterpolateURI replaces the references in the URI 'str' in the same way as `Interpolate`, except that values inserted
+// after the start of its query or fragment (after a "?" or "#") are escaped using `EscapeURIValue`, so that a value
+// containing characters like "&" or "#" can't change the meaning of the URI. Defaults are inserted verbatim, as are
+// values redacted by `RedactReference`.
+func InterpolateURI(str string, lookup LookupFunc) (string, error) {
+	return replaceReferences(str, lookup, true)
+}
+
+// EscapeURIValue returns 'v' escaped for use in the query or fragment of a URI. Spaces are escaped as "%20" rather than
+// "+", which isn't decoded by receivers and transformations (like filter://) that parse their query themselves.
+func EscapeURIValue(v string) string {
+	return strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+}
+
+// replaceReferences implements `Interpolate` and, if 'escape' is true, `InterpolateURI`.
+func replaceReferences(str string, lookup LookupFunc, escape bool) (string, error) {
+
+	var sb strings.Builder
+
+	for {
+
+		idx := strings.Index(str, "${")
+
+		if idx == -1 {
+			sb.WriteString(str)
+			break
+		}
+
+		// "$${" is an escaped, literal "${".
+
+		if idx > 0 && str[idx-1] == '$' {
+			sb.WriteString(str[:idx-1])
+			sb.WriteString("${")
+			str = str[idx+2:]
+			continue
+		}
+
+		sb.WriteString(str[:idx])
+		str = str[idx+2:]
+
+		end := strings.Index(str, "}")
+
+		if end == -1 {
+			return "", fmt.Errorf("Unterminated reference '${%s'", str)
+		}
+
+		expr := str[:end]
+		str = str[end+1:]
+
+		ref, fallback, has_fallback := strings.Cut(expr, ":-")
+
+		err := checkReference(ref)
+
+		if err != nil {
+			return "", err
+		}
+
+		v, ok, err := lookup(ref)
+
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case has_fallback && (!ok || v == ""):
+			v = fallback
+		case !ok && strings.HasPrefix(ref, filePrefix):
+			return "", fmt.Errorf("File '%s' does not exist", strings.TrimPrefix(ref, filePrefix))
+		case !ok:
+			return "", fmt.Errorf("Environment variable '%s' is not set", ref)
+		case escape && v != Redacted && strings.ContainsAny(sb.String(), "?#"):
+			v = EscapeURIValue(v)
+		}
+
+		sb.WriteString(v)
+	}
+
+	return sb.String(), nil
+}
+
+// checkReference returns an error if 'ref' is neither a valid environment variable name nor a "file:" reference.
+func checkReference(ref string) error {
+
+	if strings.HasPrefix(ref, filePrefix) {
+
+		if ref == filePrefix {
+			return fmt.Errorf("Missing path in reference '${%s}'", ref)
+		}
+
+		return nil
+	}
+
+	if ref == "" {
+		return fmt.Errorf("Empty reference '${}'")
+	}
+
+	for i, r := range ref {
+
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+			// pass
+		case r >= '0' && r <= '9' && i > 0:
+			// pass
+		default:
+			return fmt.Errorf("Invalid environment variable name in reference '${%s}'", ref)
+		}
+	}
+
+	return nil
+}
+
+// InterpolateValues replaces the references in the receiver, transformation and dispatcher URIs, and dispatcher options,
+// of 'c' with the values returned by 'lookup', as described in `InterpolateURI` and `Interpolate` respectively. Options
+// aren't escaped because they are encoded when they are added to the URI. Every invalid reference is reported, not
+// just the first.
+func (c *WebhookConfig) InterpolateValues(lookup LookupFunc) error {
+
+	errs := make([]error, 0)
+
+	interpolate := func(str string, label string, escape bool) string {
+
+		v, err := replaceReferences(str, lookup, escape)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to interpolate %s, %w", label, err))
+			return str
+		}
+
+		return v
+	}
+
+	for _, name := range sortedNames(c.Receivers) {
+		c.Receivers[name] = interpolate(c.Receivers[name], fmt.Sprintf("receiver '%s'", name), true)
+	}
+
+	for _, name := range sortedNames(c.Transformations) {
+		c.Transformations[name] = interpolate(c.Transformations[name], fmt.Sprintf("transformation '%s'", name), true)
+	}
+
+	for _, name := range sortedNames(c.Dispatchers) {
+
+		d := c.Dispatchers[name]
+		d.URI = interpolate(d.URI, fmt.Sprintf("dispatcher '%s'", name), true)
+
+		if len(d.Options) > 0 {
+
+			opts := make(WebhookOptions, len(d.Options))
+
+			for _, k := range sortedNames(d.Options) {
+
+				values := make([]string, len(d.Options[k]))
+
+				for i, v := range d.Options[k] {
+					values[i] = interpolate(v, fmt.Sprintf("option '%s' of dispatcher '%s'", k, name), false)
+				}
+
+				opts[k] = values
+			}
+
+			d.Options = opts
+		}
+
+		c.Dispatchers[name] = d
+	}
+
+	return errors.Join(errs...)
+}
+
+// sortedNames returns the keys of 'm' in alphabetical order, so that errors are reported in a stable order.
+func sortedNames[V any](m map[string]V) []string {
+
+	names := make([]string, 0, len(m))
+
+	for k := range m {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+
+	path_token := filepath.Join(t.TempDir(), "token")
+
+	err := os.WriteFile(path_token, []byte("s33kret\n"), 0600)
+
+	if err != nil {
+		t.Fatalf("Failed to write %s, %v", path_token, err)
+	}
+
+	t.Setenv("WEBHOOKD_TEST_URL", "https://hooks.example.com/T/B/X")
+	t.Setenv("WEBHOOKD_TEST_EMPTY", "")
+
+	tests := map[string]string{
+		"log://":                                      "log://",
+		"slack://?webhook=${WEBHOOKD_TEST_URL}":       "slack://?webhook=https://hooks.example.com/T/B/X",
+		"${WEBHOOKD_TEST_MISSING:-alerts}":            "alerts",
+		"${WEBHOOKD_TEST_EMPTY:-alerts}":              "alerts",
+		"${WEBHOOKD_TEST_URL:-alerts}":                "https://hooks.example.com/T/B/X",
+		"${WEBHOOKD_TEST_EMPTY}":                      "",
+		"${WEBHOOKD_TEST_MISSING:-}":                  "",
+		"token=${file:" + path_token + "}":            "token=s33kret",
+		"${file:/does/not/exist:-none}":               "none",
+		"a=${WEBHOOKD_TEST_MISSING:-1}&b=$${LITERAL}": "a=1&b=${LITERAL}",
+		`data.severity =~ "^Sev[0-2]$"`:               `data.severity =~ "^Sev[0-2]$"`,
+	}
+
+	for str, expected := range tests {
+
+		v, err := Interpolate(str, LookupReference)
+
+		if err != nil {
+			t.Fatalf("Failed to interpolate '%s', %v", str, err)
+		}
+
+		if v != expected {
+			t.Fatalf("Unexpected value for '%s': '%s'", str, v)
+		}
+	}
+
+	invalid := []string{
+		"${WEBHOOKD_TEST_MISSING}",
+		"${file:/does/not/exist}",
+		"${WEBHOOKD_TEST_URL",
+		"${}",
+		"${file:}",
+		"${not-a-name}",
+		"${1ABC}",
+	}
+
+	for _, str := range invalid {
+
+		_, err := Interpolate(str, LookupReference)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail", str)
+		}
+	}
+
+	v, err := Interpolate("https://${WEBHOOKD_TEST_URL}/${WEBHOOKD_TEST_MISSING:-default}", RedactReference)
+
+	if err != nil {
+		t.Fatalf("Failed to interpolate redacted value, %v", err)
+	}
+
+	if v != "https://"+Redacted+"/default" {
+		t.Fatalf("Unexpected redacted value '%s'", v)
+	}
+}
+
+func TestInterpolateURI(t *testing.T) {
+
+	t.Setenv("WEBHOOKD_TEST_URL", "https://hooks.example.com/T/B/X?a=1&b=2")
+	t.Setenv("WEBHOOKD_TEST_HOST", "example.com")
+	t.Setenv("WEBHOOKD_TEST_TOKEN", "s3 k&r#t")
+
+	tests := map[string]string{
+		"${WEBHOOKD_TEST_URL}":                                             "https://hooks.example.com/T/B/X?a=1&b=2",
+		"https://${WEBHOOKD_TEST_HOST}/hooks":                              "https://example.com/hooks",
+		"slack://?webhook=${WEBHOOKD_TEST_URL}":                            "slack://?webhook=https%3A%2F%2Fhooks.example.com%2FT%2FB%2FX%3Fa%3D1%26b%3D2",
+		"https://${WEBHOOKD_TEST_HOST}/hooks?token=${WEBHOOKD_TEST_TOKEN}": "https://example.com/hooks?token=s3%20k%26r%23t",
+		"https://${WEBHOOKD_TEST_HOST}/hooks#token=${WEBHOOKD_TEST_TOKEN}": "https://example.com/hooks#token=s3%20k%26r%23t",
+		"https://example.com/hooks?a=${WEBHOOKD_TEST_MISSING:-1&b=2}":      "https://example.com/hooks?a=1&b=2",
+	}
+
+	for str, expected := range tests {
+
+		v, err := InterpolateURI(str, LookupReference)
+
+		if err != nil {
+			t.Fatalf("Failed to interpolate '%s', %v", str, err)
+		}
+
+		if v != expected {
+			t.Fatalf("Unexpected value for '%s': '%s'", str, v)
+		}
+	}
+
+	v, err := InterpolateURI("slack://?webhook=${WEBHOOKD_TEST_URL}&channel=alerts", LookupReference)
+
+	if err != nil {
+		t.Fatalf("Failed to interpolate URI, %v", err)
+	}
+
+	u, err := url.Parse(v)
+
+	if err != nil {
+		t.Fatalf("Failed to parse interpolated URI, %v", err)
+	}
+
+	if u.Query().Get("webhook") != os.Getenv("WEBHOOKD_TEST_URL") || u.Query().Get("channel") != "alerts" {
+		t.Fatalf("Unexpected query '%s'", u.RawQuery)
+	}
+
+	v, err = InterpolateURI("slack://?webhook=${WEBHOOKD_TEST_URL}", RedactReference)
+
+	if err != nil {
+		t.Fatalf("Failed to interpolate redacted value, %v", err)
+	}
+
+	if v != "slack://?webhook="+Redacted {
+		t.Fatalf("Unexpected redacted value '%s'", v)
+	}
+}
+
+func TestNewConfigWithLookup(t *testing.T) {
+
+	t.Setenv("WEBHOOKD_TEST_SECRET", "s33kret")
+
+	path_config := filepath.Join(t.TempDir(), "config.yaml")
+
+	body := `
+receivers:
+  github: "hmac://github?secret_env=GITHUB_SECRET"
+transformations:
+  schema: "jsonschema://?schema=${WEBHOOKD_TEST_SCHEMAS:-/etc/schemas}/alert.json"
+dispatchers:
+  slack:
+    uri: "slack://"
+    options:
+      webhook: "${WEBHOOKD_TEST_SECRET}"
+      channel: "${WEBHOOKD_TEST_CHANNEL:-alerts}"
+  http: "https://example.com/hooks?token=${WEBHOOKD_TEST_SECRET}"
+webhooks:
+  - endpoint: "/github"
+    receiver: "github"
+    dispatchers:
+      - "slack"
+`
+
+	err := os.WriteFile(path_config, []byte(body), 0600)
+
+	if err != nil {
+		t.Fatalf("Failed to write %s, %v", path_config, err)
+	}
+
+	cfg, err := NewConfig(path_config)
+
+	if err != nil {
+		t.Fatalf("Failed to create new config, %v", err)
+	}
+
+	if cfg.Transformations["schema"] != "jsonschema://?schema=/etc/schemas/alert.json" {
+		t.Fatalf("Unexpected transformation URI '%s'", cfg.Transformations["schema"])
+	}
+
+	if cfg.Dispatchers["http"].URI != "https://example.com/hooks?token=s33kret" {
+		t.Fatalf("Unexpected dispatcher URI '%s'", cfg.Dispatchers["http"].URI)
+	}
+
+	opts := cfg.Dispatchers["slack"].Options
+
+	if opts["webhook"][0] != "s33kret" || opts["channel"][0] != "alerts" {
+		t.Fatalf("Unexpected dispatcher options %v", opts)
+	}
+
+	redacted, err := NewConfigWithLookup(path_config, RedactReference)
+
+	if err != nil {
+		t.Fatalf("Failed to create new redacted config, %v", err)
+	}
+
+	if redacted.Dispatchers["slack"].Options["webhook"][0] != Redacted || redacted.Dispatchers["slack"].Options["channel"][0] != "alerts" {
+		t.Fatalf("Unexpected redacted options %v", redacted.Dispatchers["slack"].Options)
+	}
+
+	if strings.Contains(redacted.Dispatchers["http"].URI, "s33kret") {
+		t.Fatalf("Expected secret to be redacted from '%s'", redacted.Dispatchers["http"].URI)
+	}
+
+	// Every reference that can't be resolved is reported
+
+	os.Unsetenv("WEBHOOKD_TEST_SECRET")
+
+	_, err = NewConfig(path_config)
+
+	if err == nil {
+		t.Fatalf("Expected config with unset environment variable to fail")
+	}
+
+	if strings.Count(err.Error(), "WEBHOOKD_TEST_SECRET") != 2 {
+		t.Fatalf("Expected both unresolved references to be reported, %v", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+
+	t.Setenv("WEBHOOKD_TEST_SECRET", "s33kret-t0ken")
+	t.Setenv("WEBHOOKD_TEST_PORT", "8080")
+	t.Setenv("WEBHOOKD_TEST_WEBHOOK", "https://hooks.example.com/T/B/X")
+
+	path_config := filepath.Join(t.TempDir(), "config.yaml")
+
+	body := `
+receivers:
+  insecure: "insecure://"
+dispatchers:
+  http: "http://localhost:${WEBHOOKD_TEST_PORT}/hooks?token=${WEBHOOKD_TEST_SECRET}"
+  slack: "slack://?webhook=${WEBHOOKD_TEST_WEBHOOK}"
+webhooks:
+  - endpoint: "/insecure"
+    receiver: "insecure"
+    dispatchers:
+      - "http"
+`
+
+	err := os.WriteFile(path_config, []byte(body), 0600)
+
+	if err != nil {
+		t.Fatalf("Failed to write %s, %v", path_config, err)
+	}
+
+	cfg, err := NewConfig(path_config)
+
+	if err != nil {
+		t.Fatalf("Failed to create new config, %v", err)
+	}
+
+	// Short values, like the port, are not redacted.
+
+	err = cfg.RedactError(fmt.Errorf("Failed to parse URI %s", cfg.Dispatchers["http"].URI))
+
+	if err.Error() != "Failed to parse URI http://localhost:8080/hooks?token="+Redacted {
+		t.Fatalf("Unexpected redacted error '%v'", err)
+	}
+
+	// Values are redacted after they are escaped, too.
+
+	err = cfg.RedactError(fmt.Errorf("Failed to parse URI %s", cfg.Dispatchers["slack"].URI))
+
+	if err.Error() != "Failed to parse URI slack://?webhook="+Redacted {
+		t.Fatalf("Unexpected redacted error '%v'", err)
+	}
+
+	if cfg.RedactError(nil) != nil {
+		t.Fatalf("Expected nil error to stay nil")
+	}
+}
@@ -0,0 +1,13 @@
+package config
+
+// type WebhookLoggingConfig is a struct containing configuration information for the daemon's logs. Each setting can be
+// overridden by the corresponding command line flag. Changes require a restart.
+type WebhookLoggingConfig struct {
+	// Level is the minimum level of messages that are logged: "debug", "info", "warn" or "error". Defaults to "info".
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+	// Format is the format of log lines: "json" or "text". Defaults to "json".
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// Output is where log lines are written: "stdout", "stderr" or the path of a file that lines are appended to.
+	// Defaults to "stdout".
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+}
@@ -0,0 +1,28 @@
+package config
+
+// type WebhookRouteConfig is a struct containing configuration information for a route which relays messages matching
+// a condition to a list of dispatchers. A condition is either a single test of a value selected by `Path`, `Header` or
+// `Meta`, or an expression in `Expr`.
+type WebhookRouteConfig struct {
+	// Name is an optional label for the route, used in logs and dispatch summaries.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Path is a gjson path selecting the value in the body of a message to test.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Header is the name of the request header whose value is tested.
+	Header string `json:"header,omitempty" yaml:"header,omitempty"`
+	// Meta is the metadata key whose value is tested, for example "event_type".
+	Meta string `json:"meta,omitempty" yaml:"meta,omitempty"`
+	// Equals matches messages whose selected value is equal to this string.
+	Equals *string `json:"equals,omitempty" yaml:"equals,omitempty"`
+	// Matches matches messages whose selected value matches this regular expression.
+	Matches string `json:"matches,omitempty" yaml:"matches,omitempty"`
+	// Exists matches messages where the selected value exists, or does not exist if false.
+	Exists *bool `json:"exists,omitempty" yaml:"exists,omitempty"`
+	// Expr is an expression combining one or more tests, for example `data.essentials.severity == "Sev0" && !resolved`.
+	Expr string `json:"expr,omitempty" yaml:"expr,omitempty"`
+	// Default marks the route used for messages that match no other route. A default route has no condition.
+	Default bool `json:"default,omitempty" yaml:"default,omitempty"`
+	// Dispatchers is the list of dispatcher labels configured in `WebhookConfig.Dispatchers` that matching messages are
+	// relayed to.
+	Dispatchers []string `json:"dispatchers" yaml:"dispatchers"`
+}
@@ -0,0 +1,22 @@
+package config
+
+// type WebhookServerConfig is a struct containing configuration information for the HTTP server. Durations are
+// strings parsed by `time.ParseDuration`, for example "30s". Zero values are replaced by the defaults in the
+// `server` package.
+type WebhookServerConfig struct {
+	// Listen is the address the server listens on, for example "0.0.0.0:8080" or ":8080".
+	Listen string `json:"listen,omitempty" yaml:"listen,omitempty"`
+	// ReadTimeout is the maximum duration for reading an entire request, including the body.
+	ReadTimeout string `json:"read_timeout,omitempty" yaml:"read_timeout,omitempty"`
+	// ReadHeaderTimeout is the maximum duration for reading request headers.
+	ReadHeaderTimeout string `json:"read_header_timeout,omitempty" yaml:"read_header_timeout,omitempty"`
+	// WriteTimeout is the maximum duration before timing out writes of a response. Synchronous webhooks respond
+	// once every dispatcher has finished, including retries, so this should be generous.
+	WriteTimeout string `json:"write_timeout,omitempty" yaml:"write_timeout,omitempty"`
+	// IdleTimeout is the maximum duration to wait for the next request on a keep-alive connection.
+	IdleTimeout string `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`
+	// MaxHeaderBytes is the maximum size of request headers, in bytes.
+	MaxHeaderBytes int `json:"max_header_bytes,omitempty" yaml:"max_header_bytes,omitempty"`
+	// ShutdownGracePeriod is the maximum duration to wait for in-flight requests to complete when shutting down.
+	ShutdownGracePeriod string `json:"shutdown_grace_period,omitempty" yaml:"shutdown_grace_period,omitempty"`
+}
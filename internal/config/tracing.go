@@ -0,0 +1,14 @@
+package config
+
+// type WebhookTracingConfig is a struct containing configuration information for OpenTelemetry tracing.
+type WebhookTracingConfig struct {
+	// Exporter is a URI used to instantiate the span exporter, for example "otlp://otel-collector:4318" or
+	// "file:///var/log/webhookd/traces.json". If empty spans are not exported but incoming trace context is
+	// still propagated to dispatchers.
+	Exporter string `json:"exporter,omitempty" yaml:"exporter,omitempty"`
+	// ServiceName is the value of the "service.name" resource attribute. Defaults to "webhookd".
+	ServiceName string `json:"service_name,omitempty" yaml:"service_name,omitempty"`
+	// SampleRatio is the fraction (0.0 to 1.0) of new traces to sample. Traces continued from an incoming
+	// "traceparent" header follow the caller's sampling decision. Defaults to 1.0.
+	SampleRatio float64 `json:"sample_ratio,omitempty" yaml:"sample_ratio,omitempty"`
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDelay is the default time `Watch` waits for changes to a config file to settle before signaling them.
+const DefaultWatchDelay time.Duration = 500 * time.Millisecond
+
+// Watch() invokes 'onChange' whenever the config file at 'configFile' is written, created, renamed or replaced, until
+// 'ctx' is cancelled. Bursts of changes occurring within 'delay' of each other result in a single call to 'onChange'.
+//
+// The directory containing 'configFile' is watched, rather than the file itself, so that files which are replaced
+// rather than modified in place are still tracked. This is how editors save files and how Kubernetes updates
+// mounted ConfigMaps and Secrets (by swapping a "..data" symlink).
+func Watch(ctx context.Context, configFile string, delay time.Duration, onChange func()) error {
+
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return fmt.Errorf("Failed to create file watcher, %w", err)
+	}
+
+	root := filepath.Dir(configFile)
+
+	err = watcher.Add(root)
+
+	if err != nil {
+		watcher.Close()
+		return fmt.Errorf("Failed to watch '%s', %w", root, err)
+	}
+
+	name := filepath.Base(configFile)
+
+	go func() {
+
+		defer watcher.Close()
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+
+				if timer != nil {
+					timer.Stop()
+				}
+
+				return
+
+			case ev, ok := <-watcher.Events:
+
+				if !ok {
+					return
+				}
+
+				base := filepath.Base(ev.Name)
+
+				if base != name && base != "..data" {
+					continue
+				}
+
+				if !ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Rename) && !ev.Has(fsnotify.Remove) {
+					continue
+				}
+
+				if timer == nil {
+					timer = time.NewTimer(delay)
+				} else {
+
+					if !timer.Stop() {
+						select {
+						case <-timer.C:
+						default:
+						}
+					}
+
+					timer.Reset(delay)
+				}
+
+				fire = timer.C
+
+			case <-fire:
+
+				fire = nil
+				onChange()
+
+			case err, ok := <-watcher.Errors:
+
+				if !ok {
+					return
+				}
+
+				logger.Log.Error("Config file watcher error", "path", configFile, "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
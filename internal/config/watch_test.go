@@ -0,0 +1,95 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	root := t.TempDir()
+	path := filepath.Join(root, "config.yaml")
+
+	err := os.WriteFile(path, []byte("webhooks: []"), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write config file, %v", err)
+	}
+
+	changes := make(chan bool, 10)
+
+	err = Watch(ctx, path, 50*time.Millisecond, func() { changes <- true })
+
+	if err != nil {
+		t.Fatalf("Failed to watch config file, %v", err)
+	}
+
+	// Changes to other files in the same directory are ignored.
+
+	err = os.WriteFile(filepath.Join(root, "other.yaml"), []byte("x"), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write other file, %v", err)
+	}
+
+	select {
+	case <-changes:
+		t.Fatalf("Unexpected change for unrelated file")
+	case <-time.After(200 * time.Millisecond):
+		// pass
+	}
+
+	// Several writes in quick succession are reported once.
+
+	for i := 0; i < 3; i++ {
+
+		err = os.WriteFile(path, []byte("webhooks: []\n"), 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write config file, %v", err)
+		}
+	}
+
+	select {
+	case <-changes:
+		// pass
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for change")
+	}
+
+	select {
+	case <-changes:
+		t.Fatalf("Expected writes to be coalesced")
+	case <-time.After(200 * time.Millisecond):
+		// pass
+	}
+
+	// Files replaced by renaming, as editors do, are still tracked.
+
+	tmp := filepath.Join(root, "config.yaml.tmp")
+
+	err = os.WriteFile(tmp, []byte("webhooks: []\n"), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write config file, %v", err)
+	}
+
+	err = os.Rename(tmp, path)
+
+	if err != nil {
+		t.Fatalf("Failed to replace config file, %v", err)
+	}
+
+	select {
+	case <-changes:
+		// pass
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for change after rename")
+	}
+}
@@ -2,11 +2,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"gopkg.in/yaml.v3"
-	"log"
 	_ "log"
 	"os"
+	"sort"
+	"strings"
 )
 
 // type WebhookConfig is a struct containing configuration information for a `webhookd` instance.
@@ -15,13 +17,43 @@ type WebhookConfig struct {
 	// receiver (in `WebhookWebhooksConfig`) and the value is a URI used to instantiate the reciever.
 	Receivers map[string]string `json:"receivers"`
 	// Dispatchers is a dictionary of available dispatchers where the key is a unique label used to identify the
-	// dispatcher (in `WebhookWebhooksConfig`) and the value is a URI used to instantiate the dispatcher.
-	Dispatchers map[string]string `json:"dispatchers"`
+	// dispatcher (in `WebhookWebhooksConfig`) and the value is either a URI used to instantiate the dispatcher or
+	// a `WebhookDispatcherConfig` dictionary.
+	Dispatchers map[string]WebhookDispatcherConfig `json:"dispatchers"`
 	// Transformations is a dictionary of available transformations where the key is a unique label used to identify the
 	// transformation (in `WebhookWebhooksConfig`) and the value is a URI used to instantiate the transformation.
 	Transformations map[string]string `json:"transformations"`
 	// Webhooks is a list of `WebhookWebhooksConfig` used to configure the webhooks that a `webhookd` instance will respond to.
 	Webhooks []WebhookWebhooksConfig `json:"webhooks"`
+	// Queue contains the settings for the durable queue used by webhooks whose `Delivery` is "async".
+	Queue WebhookQueueConfig `json:"queue,omitempty" yaml:"queue,omitempty"`
+	// DeadLetter is an optional URI used to instantiate the store where messages that dispatchers failed to relay are kept.
+	DeadLetter string `json:"dead_letter,omitempty" yaml:"dead_letter,omitempty"`
+	// Admin contains the settings for the administrative HTTP endpoints.
+	Admin WebhookAdminConfig `json:"admin,omitempty" yaml:"admin,omitempty"`
+	// Server contains the settings for the HTTP server.
+	Server WebhookServerConfig `json:"server,omitempty" yaml:"server,omitempty"`
+	// Tracing contains the settings for OpenTelemetry tracing.
+	Tracing WebhookTracingConfig `json:"tracing,omitempty" yaml:"tracing,omitempty"`
+	// Logging contains the settings for the daemon's logs.
+	Logging WebhookLoggingConfig `json:"logging,omitempty" yaml:"logging,omitempty"`
+	// secrets is the list of values resolved from environment variables and files which are redacted by `Redact`.
+	secrets []string
+}
+
+// type WebhookAdminConfig is a struct containing configuration information for the administrative HTTP endpoints.
+type WebhookAdminConfig struct {
+	// Auth is the authentication policy enforced for requests to the administrative endpoints.
+	Auth WebhookAuthConfig `json:"auth,omitempty" yaml:"auth,omitempty"`
+}
+
+// type WebhookQueueConfig is a struct containing configuration information for the asynchronous delivery queue.
+type WebhookQueueConfig struct {
+	// Path is the directory where the queue's append-only log file is stored. It is required if any webhook uses
+	// asynchronous delivery and should be on a persistent volume.
+	Path string `json:"path" yaml:"path"`
+	// Workers is the number of concurrent workers delivering queued messages. Defaults to 1.
+	Workers int `json:"workers,omitempty" yaml:"workers,omitempty"`
 }
 
 // type WebhookWebhooksConfig is a struct containing configuration information for an individual webhook.
@@ -36,29 +68,113 @@ type WebhookWebhooksConfig struct {
 	// subsequent transformations will be applied to the output of the previous transformation.
 	Transformations []string `json:"transformations"`
 	// Dispatchers is a list of dispatcher labels configured in `WebhookConfig.Dispatchers`. Each dispatcher takes the output
-	// of the last transformation and relays ("dispatches") it acccording to its internal rules.
+	// of the last transformation and relays ("dispatches") it acccording to its internal rules. It must be empty if `Routes`
+	// is not.
 	Dispatchers []string `json:"dispatchers"`
+	// Routes is an optional list of `WebhookRouteConfig` used to choose the dispatchers each message is relayed to based on
+	// its contents. Routes are evaluated in order and the first one that matches is used.
+	Routes []WebhookRouteConfig `json:"routes,omitempty" yaml:"routes,omitempty"`
+	// DispatchPolicy determines whether a request is considered successful when some dispatchers fail. Valid options
+	// are "all" (the default, every dispatcher must succeed), "any" (at least one dispatcher must succeed) and "best-effort"
+	// (dispatcher failures are reported but never fail the request).
+	DispatchPolicy string `json:"dispatch_policy,omitempty" yaml:"dispatch_policy,omitempty"`
+	// Delivery is either "sync" (the default) to dispatch messages before responding to a request, or "async" to
+	// durably queue messages, respond with "202 Accepted" and dispatch them in the background.
+	Delivery string `json:"delivery,omitempty" yaml:"delivery,omitempty"`
+	// Auth is the authentication policy enforced for requests to `Endpoint`. If omitted no authentication is required.
+	Auth WebhookAuthConfig `json:"auth,omitempty"`
 }
 
-// NewConfigFromURI returns a new `WebhookConfig` instance derived from 'uri' which is expected to take the form of
-// a valid `gocloud.dev/runtimevar` URI. The value of that URI is expected to be a JSON-encoded `WebhookConfig` string.
+// NewConfig returns a new `WebhookConfig` instance derived from the YAML file 'configFile'. References to environment
+// variables and files in receiver, transformation and dispatcher URIs and options are resolved using `LookupReference`
+// (see `Interpolate`).
 func NewConfig(configFile string) (*WebhookConfig, error) {
+	return NewConfigWithLookup(configFile, LookupReference)
+}
+
+// NewConfigWithLookup returns a new `WebhookConfig` instance derived from the YAML file 'configFile' whose references
+// are resolved using 'lookup'. For example, use `RedactReference` to show a config without revealing its secrets.
+func NewConfigWithLookup(configFile string, lookup LookupFunc) (*WebhookConfig, error) {
 
 	// Read the file from the provided path
 	f, err := os.ReadFile(configFile)
 	if err != nil {
-		log.Fatalf("error reading config file: %v", err)
+		return nil, fmt.Errorf("Failed to read config file, %w", err)
 	}
 
 	// Unmarshal the YAML data into the Config struct
 	var config *WebhookConfig
 	if err := yaml.Unmarshal(f, &config); err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("Failed to parse config file, %w", err)
+	}
+
+	if config == nil {
+		return nil, fmt.Errorf("Config file is empty")
+	}
+
+	// Keep track of the values resolved from environment variables and files so that they can be
+	// redacted from errors, for example in a URI that failed to parse.
+
+	secrets := make([]string, 0)
+
+	err = config.InterpolateValues(func(ref string) (string, bool, error) {
+
+		v, ok, err := lookup(ref)
+
+		if ok && len(v) >= MinRedactLength {
+
+			secrets = append(secrets, v)
+
+			// Values in the query or fragment of a URI are inserted escaped.
+
+			escaped := EscapeURIValue(v)
+
+			if escaped != v {
+				secrets = append(secrets, escaped)
+			}
+		}
+
+		return v, ok, err
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
+	// Longer values first, in case one secret contains another.
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+
+	config.secrets = secrets
+
 	return config, nil
 }
 
+// Redact returns 'str' with every value of at least `MinRedactLength` characters that was resolved from an environment
+// variable or file when 'c' was loaded replaced by `Redacted`. Shorter values, like "true" or a port number, are
+// unlikely to be secrets and would redact unrelated text.
+func (c *WebhookConfig) Redact(str string) string {
+
+	for _, s := range c.secrets {
+		str = strings.ReplaceAll(str, s, Redacted)
+	}
+
+	return str
+}
+
+// RedactError returns an error whose message is that of 'err' with the values resolved from environment variables and
+// files redacted, as described in `Redact`, or nil if 'err' is nil.
+func (c *WebhookConfig) RedactError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	return errors.New(c.Redact(err.Error()))
+}
+
 // GetReceiverConfigByName returns the receiver URI for 'name'.
 func (c *WebhookConfig) GetReceiverConfigByName(name string) (string, error) {
 
@@ -71,7 +187,7 @@ func (c *WebhookConfig) GetReceiverConfigByName(name string) (string, error) {
 	return config, nil
 }
 
-// GetDispatcherConfigByName returns the dispatcher URI for 'name'.
+// GetDispatcherConfigByName returns the dispatcher URI for 'name', including any options.
 func (c *WebhookConfig) GetDispatcherConfigByName(name string) (string, error) {
 
 	config, ok := c.Dispatchers[name]
@@ -80,7 +196,19 @@ func (c *WebhookConfig) GetDispatcherConfigByName(name string) (string, error) {
 		return "", fmt.Errorf("Invalid dispatcher name '%s'", name)
 	}
 
-	return config, nil
+	return config.URIWithOptions()
+}
+
+// GetDispatcherRetryConfigByName returns the retry policy for the dispatcher 'name' or nil if it does not have one.
+func (c *WebhookConfig) GetDispatcherRetryConfigByName(name string) (*WebhookRetryConfig, error) {
+
+	config, ok := c.Dispatchers[name]
+
+	if !ok {
+		return nil, fmt.Errorf("Invalid dispatcher name '%s'", name)
+	}
+
+	return config.Retry, nil
 }
 
 // GetTransformationConfigByName returns the dispatcher URI for 'name'.
@@ -1,85 +1,84 @@
 package config
 
 import (
-	"context"
-	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 )
 
-const example_config string = "../docs/config/config.json.example"
-
-func newConfigFromURI() (*WebhookConfig, error) {
-
-	ctx := context.Background()
-
-	path_config, err := filepath.Abs(example_config)
+const example_config string = `
+receivers:
+  insecure: "insecure://"
+transformations:
+  chicken: "chicken://zxx"
+dispatchers:
+  log: "log://"
+  http:
+    uri: "https://example.com/hooks"
+    options:
+      method: "PUT"
+webhooks:
+  - endpoint: "/insecure-test"
+    receiver: "insecure"
+    transformations:
+      - "chicken"
+    dispatchers:
+      - "log"
+`
+
+func newConfig(t *testing.T) *WebhookConfig {
+
+	path_config := filepath.Join(t.TempDir(), "config.yaml")
+
+	err := os.WriteFile(path_config, []byte(example_config), 0600)
 
 	if err != nil {
-		return nil, fmt.Errorf("Failed to derive absolute path for %s, %v", example_config, err)
+		t.Fatalf("Failed to write %s, %v", path_config, err)
 	}
 
-	uri := fmt.Sprintf("file://%s?decoder=string", path_config)
-
-	cfg, err := NewConfigFromURI(ctx, uri)
+	cfg, err := NewConfig(path_config)
 
 	if err != nil {
-		return nil, fmt.Errorf("Failed to create new config for %s, %v", path_config, err)
+		t.Fatalf("Failed to create new config for %s, %v", path_config, err)
 	}
 
-	return cfg, nil
+	return cfg
 }
 
-func TestNewConfigFromURI(t *testing.T) {
+func TestNewConfig(t *testing.T) {
 
-	cfg, err := newConfigFromURI()
+	cfg := newConfig(t)
 
-	if err != nil {
-		t.Fatalf("Failed to create new config from URI, %v", err)
+	if len(cfg.Webhooks) != 1 || cfg.Webhooks[0].Endpoint != "/insecure-test" {
+		t.Fatalf("Unexpected webhooks: %v", cfg.Webhooks)
 	}
 
-	if cfg.Daemon != "http://localhost:8080" {
-		t.Fatalf("Unexpected cfg.Daemon value: %s", cfg.Daemon)
-	}
-}
+	dir := t.TempDir()
 
-func TestNewConfigFromReader(t *testing.T) {
+	_, err := NewConfig(filepath.Join(dir, "missing.yaml"))
 
-	ctx := context.Background()
-
-	path_config, err := filepath.Abs(example_config)
-
-	if err != nil {
-		t.Fatalf("Failed to derive absolute path for %s, %v", example_config, err)
-	}
-
-	r, err := os.Open(path_config)
-
-	if err != nil {
-		t.Fatalf("Failed to open %s for reading, %v", path_config, err)
+	if err == nil {
+		t.Fatalf("Expected missing config file to fail")
 	}
 
-	defer r.Close()
+	empty := filepath.Join(dir, "empty.yaml")
 
-	cfg, err := NewConfigFromReader(ctx, r)
+	err = os.WriteFile(empty, []byte(""), 0600)
 
 	if err != nil {
-		t.Fatalf("Failed to create new config for %s, %v", path_config, err)
+		t.Fatalf("Failed to write %s, %v", empty, err)
 	}
 
-	if cfg.Daemon != "http://localhost:8080" {
-		t.Fatalf("Unexpected cfg.Daemon value: %s", cfg.Daemon)
+	_, err = NewConfig(empty)
+
+	if err == nil {
+		t.Fatalf("Expected empty config file to fail")
 	}
 }
 
 func TestGetReceiverConfigByName(t *testing.T) {
 
-	cfg, err := newConfigFromURI()
-
-	if err != nil {
-		t.Fatalf("Failed to create new config from URI, %v", err)
-	}
+	cfg := newConfig(t)
 
 	name := "insecure"
 	expected := "insecure://"
@@ -94,15 +93,16 @@ func TestGetReceiverConfigByName(t *testing.T) {
 		t.Fatalf("Unexpected value for %s receiver: %s", name, uri)
 	}
 
+	_, err = cfg.GetReceiverConfigByName("missing")
+
+	if err == nil {
+		t.Fatalf("Expected undefined receiver to fail")
+	}
 }
 
 func TestGetTransformationConfigByName(t *testing.T) {
 
-	cfg, err := newConfigFromURI()
-
-	if err != nil {
-		t.Fatalf("Failed to create new config from URI, %v", err)
-	}
+	cfg := newConfig(t)
 
 	name := "chicken"
 	expected := "chicken://zxx"
@@ -116,28 +116,27 @@ func TestGetTransformationConfigByName(t *testing.T) {
 	if uri != expected {
 		t.Fatalf("Unexpected value for %s transformation: %s", name, uri)
 	}
-
-	t.Skip()
 }
 
 func TestGetDispatcherConfigByName(t *testing.T) {
 
-	cfg, err := newConfigFromURI()
+	cfg := newConfig(t)
 
-	if err != nil {
-		t.Fatalf("Failed to create new config from URI, %v", err)
+	tests := map[string]string{
+		"log":  "log://",
+		"http": "https://example.com/hooks#method=PUT",
 	}
 
-	name := "log"
-	expected := "log://"
+	for name, expected := range tests {
 
-	uri, err := cfg.GetDispatcherConfigByName(name)
+		uri, err := cfg.GetDispatcherConfigByName(name)
 
-	if err != nil {
-		t.Fatalf("Failed to get dispatcher config for %s, %v", name, err)
-	}
+		if err != nil {
+			t.Fatalf("Failed to get dispatcher config for %s, %v", name, err)
+		}
 
-	if uri != expected {
-		t.Fatalf("Unexpected value for %s dispatcher: %s", name, uri)
+		if uri != expected {
+			t.Fatalf("Unexpected value for %s dispatcher: %s", name, uri)
+		}
 	}
 }
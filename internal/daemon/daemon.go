@@ -3,34 +3,86 @@ package daemon
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/bobertrublik/webhook-router/internal/logger"
 	"github.com/bobertrublik/webhook-router/internal/webhookd"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/deadletter"
 	"github.com/bobertrublik/webhook-router/internal/dispatcher"
+	"github.com/bobertrublik/webhook-router/internal/metrics"
+	"github.com/bobertrublik/webhook-router/internal/middleware"
+	"github.com/bobertrublik/webhook-router/internal/queue"
 	"github.com/bobertrublik/webhook-router/internal/receiver"
+	"github.com/bobertrublik/webhook-router/internal/routing"
+	"github.com/bobertrublik/webhook-router/internal/tracing"
 	"github.com/bobertrublik/webhook-router/internal/transformation"
 	"github.com/bobertrublik/webhook-router/internal/webhook"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// DeadLetterPath is the path prefix for the administrative dead letter endpoints.
+const DeadLetterPath string = "/admin/dlq"
+
+// checkEndpoint returns an error if 'endpoint' is one of the paths served alongside the webhooks, which are routed
+// before the webhooks and so would make the webhook unreachable.
+func checkEndpoint(endpoint string) error {
+
+	if endpoint == metrics.Path || endpoint == DeadLetterPath || strings.HasPrefix(endpoint, DeadLetterPath+"/") {
+		return fmt.Errorf("Endpoint '%s' is reserved", endpoint)
+	}
+
+	return nil
+}
+
 // type WebhookDaemon is a struct that implements a long-running daemon to listen for	and process webhooks.
 type WebhookDaemon struct {
+	// mu guards `webhooks`, `middleware` and `inflight` which are swapped when the daemon's config is reloaded.
+	mu sync.RWMutex
 	// webhooks is a dictionary of URIs and their corresponding `webhookd.WebhookHandler` instances.
 	webhooks map[string]webhookd.WebhookHandler
+	// middleware is a dictionary of URIs and the `middleware.Middleware` instances applied to requests for that URI.
+	middleware map[string][]middleware.Middleware
+	// inflight counts the requests and deliveries using `webhooks`, so that their dispatchers can be closed once
+	// they have been replaced by reloading the config and are no longer in use.
+	inflight *sync.WaitGroup
+	// adminMiddleware is the list of `middleware.Middleware` instances applied to requests for the administrative endpoints.
+	adminMiddleware []middleware.Middleware
+	// deadLetters is the optional store for messages that dispatchers failed to relay.
+	deadLetters deadletter.Store
+	// deadLetterURI is the URI used to create `deadLetters`.
+	deadLetterURI string
+	// adminConfig is the config used to create `adminMiddleware`.
+	adminConfig config.WebhookAdminConfig
+	// queueConfig contains the settings used to open `queue` when the daemon is started.
+	queueConfig *config.WebhookQueueConfig
+	// queue is the durable queue used to deliver messages for webhooks configured for asynchronous delivery.
+	queue *queue.Queue
+	// cancel stops the workers delivering messages from `queue`.
+	cancel context.CancelFunc
+	// done is closed when the workers delivering messages from `queue` have stopped.
+	done chan struct{}
 }
 
 // NewWebhookDaemonFromConfig() returns a new `WebhookDaemon` derived from configuration data in 'cfg'.
 func NewWebhookDaemonFromConfig(ctx context.Context, cfg *config.WebhookConfig) (*WebhookDaemon, error) {
 
 	webhooks := make(map[string]webhookd.WebhookHandler)
+	mw := make(map[string][]middleware.Middleware)
 
 	d := WebhookDaemon{
-		webhooks: webhooks,
+		webhooks:    webhooks,
+		middleware:  mw,
+		inflight:    new(sync.WaitGroup),
+		adminConfig: cfg.Admin,
 	}
 
 	err := d.AddWebhooksFromConfig(ctx, cfg)
@@ -39,11 +91,213 @@ func NewWebhookDaemonFromConfig(ctx context.Context, cfg *config.WebhookConfig)
 		return nil, fmt.Errorf("Failed to add webhooks to daemon, %w", err)
 	}
 
+	for _, hook := range cfg.Webhooks {
+
+		if hook.Delivery != webhookd.DeliveryAsync {
+			continue
+		}
+
+		if cfg.Queue.Path == "" {
+			return nil, fmt.Errorf("Missing queue path, required for asynchronous delivery")
+		}
+
+		d.queueConfig = &cfg.Queue
+		break
+	}
+
+	if cfg.DeadLetter != "" {
+
+		store, err := deadletter.NewStore(ctx, cfg.DeadLetter)
+
+		if err != nil {
+			return nil, cfg.RedactError(fmt.Errorf("Failed to create dead letter store, %w", err))
+		}
+
+		d.deadLetters = store
+		d.deadLetterURI = cfg.DeadLetter
+
+		adminMw, err := middleware.NewAuthMiddleware(ctx, cfg.Admin.Auth)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create admin auth middleware, %w", err)
+		}
+
+		d.adminMiddleware = adminMw
+	}
+
 	return &d, nil
 }
 
-// AddWebhooksFromConfig() appends the webhooks defined in 'cfg' to 'd'.
+// Start() opens the durable queue and starts the background workers that deliver messages for webhooks configured
+// for asynchronous delivery. It returns immediately; workers run until `Close` is called. If no webhooks use
+// asynchronous delivery this method is a no-op.
+func (d *WebhookDaemon) Start(ctx context.Context) error {
+
+	if d.queueConfig == nil {
+		return nil
+	}
+
+	if d.queue != nil {
+		return fmt.Errorf("Daemon already started")
+	}
+
+	q, err := queue.Open(d.queueConfig.Path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open delivery queue, %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	d.queue = q
+	d.cancel = cancel
+	d.done = make(chan struct{})
+
+	metrics.SetQueueDepth(q.Depth)
+
+	go func() {
+		q.Run(ctx, d.queueConfig.Workers, d.deliver)
+		close(d.done)
+	}()
+
+	return nil
+}
+
+// Close() stops the background delivery workers, waiting for any in-flight deliveries to complete, and closes the
+// delivery queue, dead letter store and dispatchers. Messages which have not been delivered yet will be delivered the
+// next time the daemon starts.
+func (d *WebhookDaemon) Close() error {
+
+	defer func() {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+
+		closeDispatchers(d.webhooks)
+	}()
+
+	if d.queue != nil {
+
+		d.cancel()
+		<-d.done
+
+		metrics.SetQueueDepth(nil)
+
+		err := d.queue.Close()
+
+		if err != nil {
+			return fmt.Errorf("Failed to close delivery queue, %w", err)
+		}
+	}
+
+	if d.deadLetters != nil {
+
+		err := d.deadLetters.Close()
+
+		if err != nil {
+			return fmt.Errorf("Failed to close dead letter store, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deliver dispatches the queued message 'e' to the dispatchers of the webhook it was received by. It returns an error,
+// so that the message stays in the queue and is delivered again later, unless the message was delivered according to
+// the webhook's dispatch policy, matched no route or had its failed dispatches stored as dead letters.
+func (d *WebhookDaemon) deliver(ctx context.Context, e *queue.Entry) error {
+
+	// Restore the ID of the request the message was received in so that the delivery can be
+	// correlated with it.
+
+	request_id := e.Metadata[webhookd.MetadataRequestID]
+
+	if request_id != "" {
+		ctx = webhookd.NewRequestIDContext(ctx, request_id)
+	}
+
+	ctx = logger.With(ctx, "request_id", request_id, "endpoint", e.Endpoint, "queue_id", e.ID)
+	log := logger.FromContext(ctx)
+
+	wh, _, release, ok := d.Acquire(e.Endpoint)
+
+	// The endpoint may have been removed by reloading the config, so the message is kept in case
+	// it is added back rather than being dropped.
+
+	if !ok {
+		log.Error("Queued message is for an unknown endpoint")
+		return fmt.Errorf("Endpoint '%s' is not configured", e.Endpoint)
+	}
+
+	defer release()
+
+	// Continue the trace of the request the message was received by.
+
+	ctx = tracing.Extract(ctx, e.Trace)
+
+	ctx, span := tracing.Tracer().Start(ctx, "deliver "+e.Endpoint, trace.WithAttributes(
+		attribute.String("webhookd.endpoint", e.Endpoint),
+		attribute.String("webhookd.queue.id", e.ID),
+	))
+
+	defer span.End()
+
+	// Messages are routed when they are delivered, rather than when they are queued, so that they
+	// use the routes of the webhook's current config.
+
+	msg := e.Message()
+
+	route_name, targets, ok := route(wh, msg)
+
+	if !ok {
+		metrics.EventProcessed(e.Endpoint, metrics.OutcomeUnrouted)
+		log.Info("No route matched queued message, skipping dispatch")
+		return nil
+	}
+
+	summary := d.dispatch(ctx, wh, msg, route_name, targets)
+
+	// A delivery interrupted by a shutdown is delivered again when the daemon restarts, rather
+	// than being stored as a dead letter.
+
+	if len(summary.Failures()) > 0 && ctx.Err() != nil {
+		span.SetStatus(codes.Error, summary.String())
+		log.Warn("Asynchronous delivery interrupted", "summary", summary.String())
+		return fmt.Errorf("Delivery interrupted, %w", ctx.Err())
+	}
+
+	dlq_err := d.addDeadLetters(ctx, summary, msg, e.Created)
+
+	if !summary.Success {
+
+		span.SetStatus(codes.Error, summary.String())
+		metrics.EventProcessed(e.Endpoint, metrics.OutcomeFailed)
+		log.Error("Asynchronous delivery failed", "summary", summary.String())
+
+		switch {
+		case d.deadLetters == nil:
+			return fmt.Errorf("Delivery failed, %s", summary)
+		case dlq_err != nil:
+			return dlq_err
+		}
+
+		return nil
+	}
+
+	metrics.EventProcessed(e.Endpoint, metrics.OutcomeSucceeded)
+
+	log.Info("Asynchronous delivery complete", "summary", summary.String(), "queued", time.Since(e.Created))
+	return nil
+}
+
+// AddWebhooksFromConfig() appends the webhooks defined in 'cfg' to 'd'. Values resolved from environment variables and
+// files are redacted from the error returned, if any, because the errors returned by receivers, transformations and
+// dispatchers may include their URIs.
 func (d *WebhookDaemon) AddWebhooksFromConfig(ctx context.Context, cfg *config.WebhookConfig) error {
+	return cfg.RedactError(d.addWebhooksFromConfig(ctx, cfg))
+}
+
+// addWebhooksFromConfig appends the webhooks defined in 'cfg' to 'd'.
+func (d *WebhookDaemon) addWebhooksFromConfig(ctx context.Context, cfg *config.WebhookConfig) error {
 
 	if len(cfg.Webhooks) == 0 {
 		return fmt.Errorf("No webhooks defined")
@@ -55,26 +309,59 @@ func (d *WebhookDaemon) AddWebhooksFromConfig(ctx context.Context, cfg *config.W
 			return fmt.Errorf("Missing endpoint at offset %d", i+1)
 		}
 
+		err := checkEndpoint(hook.Endpoint)
+
+		if err != nil {
+			return fmt.Errorf("Invalid endpoint at offset %d, %w", i+1, err)
+		}
+
 		if hook.Receiver == "" {
 			return fmt.Errorf("Missing receiver at offset %d", i+1)
 		}
 
-		if len(hook.Dispatchers) == 0 {
+		if len(hook.Dispatchers) == 0 && len(hook.Routes) == 0 {
 			return fmt.Errorf("Missing dispatchers at offset %d", i+1)
 		}
 
+		if len(hook.Dispatchers) > 0 && len(hook.Routes) > 0 {
+			return fmt.Errorf("Webhook at offset %d defines both dispatchers and routes, list dispatchers in a default route instead", i+1)
+		}
+
+		dispatcherNames := hook.Dispatchers
+
+		var router webhookd.WebhookRouter
+
+		if len(hook.Routes) > 0 {
+
+			r, err := routing.NewRouterFromConfig(hook.Routes)
+
+			if err != nil {
+				return fmt.Errorf("Invalid routes for '%s', %w", hook.Endpoint, err)
+			}
+
+			dispatcherNames = r.Dispatchers()
+			router = r
+		}
+
 		recvUri, err := cfg.GetReceiverConfigByName(hook.Receiver)
 
 		if err != nil {
 			return fmt.Errorf("Failed to get receiver config for '%s', %w", hook.Receiver, err)
 		}
 
+		// Errors refer to receivers, transformations and dispatchers by name rather than URI because URIs
+		// may contain secrets resolved from environment variables or files. The errors they return may
+		// still include their URIs, which is why `AddWebhooksFromConfig` redacts them.
+
 		recv, err := receiver.NewReceiver(ctx, recvUri)
 
 		if err != nil {
-			return fmt.Errorf("Failed to add receiver '%s', %w", recvUri, err)
+			return fmt.Errorf("Failed to add receiver '%s', %w", hook.Receiver, err)
 		}
 
+		recv = metrics.NewInstrumentedReceiver(hook.Endpoint, metrics.Scheme(recvUri), recv)
+		recv = tracing.NewTracedReceiver(hook.Endpoint, metrics.Scheme(recvUri), recv)
+
 		var steps []webhookd.WebhookTransformation
 
 		for _, name := range hook.Transformations {
@@ -92,15 +379,26 @@ func (d *WebhookDaemon) AddWebhooksFromConfig(ctx context.Context, cfg *config.W
 			step, err := transformation.NewTransformation(ctx, transfUri)
 
 			if err != nil {
-				return fmt.Errorf("Failed to create new transformation for '%s', %w", transfUri, err)
+				return fmt.Errorf("Failed to create new transformation for '%s', %w", name, err)
 			}
 
+			step = metrics.NewInstrumentedTransformation(hook.Endpoint, metrics.Scheme(transfUri), step)
+			step = tracing.NewTracedTransformation(hook.Endpoint, metrics.Scheme(transfUri), len(steps), step)
 			steps = append(steps, step)
 		}
 
 		var sendto []webhookd.WebhookDispatcher
+		var names []string
 
-		for _, name := range hook.Dispatchers {
+		// The dispatchers created so far are closed if the webhook can't be added, because nothing
+		// else holds on to them.
+
+		abandon := func(err error) error {
+			closeDispatcherList(hook.Endpoint, names, sendto)
+			return err
+		}
+
+		for _, name := range dispatcherNames {
 
 			if strings.HasPrefix(name, "#") {
 				continue
@@ -109,28 +407,67 @@ func (d *WebhookDaemon) AddWebhooksFromConfig(ctx context.Context, cfg *config.W
 			dispUri, err := cfg.GetDispatcherConfigByName(name)
 
 			if err != nil {
-				return fmt.Errorf("Failed to get dispatcher configuration for '%s', %w", name, err)
+				return abandon(fmt.Errorf("Failed to get dispatcher configuration for '%s', %w", name, err))
 			}
 
 			disp, err := dispatcher.NewDispatcher(ctx, dispUri)
 
 			if err != nil {
-				return fmt.Errorf("Failed to create dispatcher for '%s', %w", dispUri, err)
+				return abandon(fmt.Errorf("Failed to create dispatcher for '%s', %w", name, err))
+			}
+
+			retryCfg, err := cfg.GetDispatcherRetryConfigByName(name)
+
+			if err != nil {
+				return abandon(fmt.Errorf("Failed to get dispatcher retry configuration for '%s', %w", name, err))
 			}
 
+			if retryCfg != nil {
+
+				policy, err := dispatcher.NewRetryPolicyFromConfig(retryCfg)
+
+				if err != nil {
+					webhookd.CloseDispatcher(disp)
+					return abandon(fmt.Errorf("Invalid retry policy for dispatcher '%s', %w", name, err))
+				}
+
+				disp = dispatcher.NewRetryDispatcher(name, disp, policy)
+			}
+
+			disp = metrics.NewInstrumentedDispatcher(hook.Endpoint, name, metrics.Scheme(dispUri), disp)
+			disp = tracing.NewTracedDispatcher(hook.Endpoint, name, metrics.Scheme(dispUri), disp)
+
 			sendto = append(sendto, disp)
+			names = append(names, name)
 		}
 
-		wh, err := webhook.NewWebhook(ctx, hook.Endpoint, recv, steps, sendto)
+		opts := &webhook.WebhookOptions{
+			Endpoint:        hook.Endpoint,
+			Receiver:        recv,
+			Transformations: steps,
+			Dispatchers:     sendto,
+			DispatcherNames: names,
+			DispatchPolicy:  hook.DispatchPolicy,
+			Delivery:        hook.Delivery,
+			Router:          router,
+		}
+
+		wh, err := webhook.NewWebhookFromOptions(ctx, opts)
 
 		if err != nil {
-			return fmt.Errorf("Failed to create new webhook for '%s', %w", hook.Endpoint, err)
+			return abandon(fmt.Errorf("Failed to create new webhook for '%s', %w", hook.Endpoint, err))
 		}
 
-		err = d.AddWebhook(ctx, wh)
+		mw, err := middleware.NewAuthMiddleware(ctx, hook.Auth)
 
 		if err != nil {
-			return fmt.Errorf("Failed to add new webhook for '%s', %w", hook.Endpoint, err)
+			return abandon(fmt.Errorf("Failed to create auth middleware for '%s', %w", hook.Endpoint, err))
+		}
+
+		err = d.AddWebhook(ctx, wh, mw...)
+
+		if err != nil {
+			return abandon(fmt.Errorf("Failed to add new webhook for '%s', %w", hook.Endpoint, err))
 		}
 
 	}
@@ -138,8 +475,11 @@ func (d *WebhookDaemon) AddWebhooksFromConfig(ctx context.Context, cfg *config.W
 	return nil
 }
 
-// AddWebhook() adds 'wh' to 'd'.
-func (d *WebhookDaemon) AddWebhook(ctx context.Context, wh webhook.Webhook) error {
+// AddWebhook() adds 'wh' to 'd'. Any 'mw' will be applied, in order, to requests for the webhook's endpoint.
+func (d *WebhookDaemon) AddWebhook(ctx context.Context, wh webhook.Webhook, mw ...middleware.Middleware) error {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
 	endpoint := wh.Endpoint()
 	_, ok := d.webhooks[endpoint]
@@ -149,27 +489,120 @@ func (d *WebhookDaemon) AddWebhook(ctx context.Context, wh webhook.Webhook) erro
 	}
 
 	d.webhooks[endpoint] = wh
+	d.middleware[endpoint] = mw
 	return nil
 }
 
-// HandlerFuncWithLogger() returns a `http.HandlerFunc` that handles HTTP (webhook) requests and response for 'd'
-// logging events to 'logger'.
-func (d *WebhookDaemon) ProcessRequest(w http.ResponseWriter, r *http.Request) error {
+// Endpoints() returns the sorted list of relative URIs for the webhooks configured in 'd'.
+func (d *WebhookDaemon) Endpoints() []string {
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	endpoints := make([]string, 0, len(d.webhooks))
+
+	for endpoint := range d.webhooks {
+		endpoints = append(endpoints, endpoint)
+	}
+
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// Acquire() returns the webhook configured for 'endpoint' and a single `middleware.Middleware` chaining all the
+// middleware configured for it, both taken from the same version of the daemon's config, along with a function which
+// must be called once they are no longer in use. The dispatchers of a version of the config replaced by `Reload` are
+// closed once everything that acquired them has called that function. The final boolean is false if no webhook is
+// configured for 'endpoint'.
+func (d *WebhookDaemon) Acquire(endpoint string) (webhookd.WebhookHandler, middleware.Middleware, func(), bool) {
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	wh, ok := d.webhooks[endpoint]
+
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	d.inflight.Add(1)
+
+	return wh, middleware.Chain(d.middleware[endpoint]...), d.inflight.Done, true
+}
+
+// NewWebhookContext() returns a copy of 'ctx' carrying 'wh', the webhook returned by `Acquire` for a request, so that
+// `ProcessRequest` uses it rather than looking up the webhook again. Otherwise a reload of the daemon's config between
+// checking a request's authentication and processing it could process it with a different webhook.
+func NewWebhookContext(ctx context.Context, wh webhookd.WebhookHandler) context.Context {
+	return context.WithValue(ctx, webhookKey{}, wh)
+}
+
+// webhookKey is the key for the webhook stored in a context by `NewWebhookContext`.
+type webhookKey struct{}
+
+// webhookFromContext returns the webhook stored in 'ctx' by `NewWebhookContext`, if any.
+func webhookFromContext(ctx context.Context) (webhookd.WebhookHandler, bool) {
+
+	wh, ok := ctx.Value(webhookKey{}).(webhookd.WebhookHandler)
+	return wh, ok
+}
+
+// NewRequestContext() returns a copy of the context of 'r' carrying the ID of the request, accepted from its
+// `webhookd.RequestIDHeader` header or newly generated, and a logger that includes the ID and the request's endpoint
+// in every line. If the context already carries a request ID it is returned unaltered.
+func NewRequestContext(r *http.Request) context.Context {
 
 	ctx := r.Context()
 
+	if webhookd.RequestIDFromContext(ctx) != "" {
+		return ctx
+	}
+
+	id := webhookd.RequestIDFromRequest(r)
+
+	ctx = webhookd.NewRequestIDContext(ctx, id)
+	ctx = logger.With(ctx, "request_id", id, "endpoint", r.URL.Path)
+
+	return ctx
+}
+
+// ProcessRequest() handles the HTTP (webhook) request 'r' for 'd', writing the outcome to 'w'. The request is processed
+// with the webhook stored in its context by `NewWebhookContext`, if any, otherwise the webhook for its endpoint. The ID of the request
+// is returned in the `webhookd.RequestIDHeader` header and carried, in the request's context and the message's
+// metadata, to every stage, dispatcher, log line and dead letter.
+func (d *WebhookDaemon) ProcessRequest(w http.ResponseWriter, r *http.Request) error {
+
+	ctx := NewRequestContext(r)
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	log := logger.FromContext(ctx)
+
+	request_id := webhookd.RequestIDFromContext(ctx)
+	w.Header().Set(webhookd.RequestIDHeader, request_id)
+
 	endpoint := r.URL.Path
 
-	wh, ok := d.webhooks[endpoint]
+	wh, ok := webhookFromContext(ctx)
+
+	if !ok {
+
+		var release func()
+		wh, _, release, ok = d.Acquire(endpoint)
+
+		if ok {
+			defer release()
+		}
+	}
 
 	if !ok {
 		http.Error(w, "404 Not found", http.StatusNotFound)
 		return fmt.Errorf("Endpoint not found, %s", endpoint)
 	}
 
+	metrics.EventReceived(endpoint)
+
 	t1 := time.Now()
 
 	var ta time.Time
@@ -183,7 +616,7 @@ func (d *WebhookDaemon) ProcessRequest(w http.ResponseWriter, r *http.Request) e
 
 	rcvr := wh.Receiver()
 
-	body, err := rcvr.Receive(ctx, r)
+	msg, err := webhookd.ReceiveMessage(ctx, rcvr, r.WithContext(ctx))
 
 	// we use -1 to signal that this is an unhandled event but
 	// not an error, for example when github sends a ping message
@@ -191,9 +624,11 @@ func (d *WebhookDaemon) ProcessRequest(w http.ResponseWriter, r *http.Request) e
 
 	if err != nil {
 
+		metrics.EventProcessed(endpoint, metrics.Outcome(err))
+
 		switch err.Code {
 		case webhookd.UnhandledEvent, webhookd.HaltEvent:
-			logger.Log.Info("Receiver step (%T)  returned non-fatal error and exiting, %v", rcvr, err)
+			log.Info("Receiver step returned non-fatal error and exiting", "receiver", fmt.Sprintf("%T", rcvr), "error", err)
 			return nil
 		default:
 			http.Error(w, err.Error(), err.Code)
@@ -201,6 +636,12 @@ func (d *WebhookDaemon) ProcessRequest(w http.ResponseWriter, r *http.Request) e
 		}
 	}
 
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string)
+	}
+
+	msg.Metadata[webhookd.MetadataRequestID] = request_id
+
 	tb = time.Since(ta)
 
 	ttr = tb
@@ -209,13 +650,15 @@ func (d *WebhookDaemon) ProcessRequest(w http.ResponseWriter, r *http.Request) e
 
 	for idx, step := range wh.Transformations() {
 
-		body, err = step.Transform(ctx, body)
+		msg, err = webhookd.TransformMessage(ctx, step, msg)
 
 		if err != nil {
 
+			metrics.EventProcessed(endpoint, metrics.Outcome(err))
+
 			switch err.Code {
 			case webhookd.UnhandledEvent, webhookd.HaltEvent:
-				logger.Log.Info("Transformation step (%T) at offset %d returned non-fatal error and exiting, %v", step, idx, err)
+				log.Info("Transformation step returned non-fatal error and exiting", "transformation", fmt.Sprintf("%T", step), "offset", idx, "error", err)
 				return nil
 			default:
 				http.Error(w, err.Error(), err.Code)
@@ -233,72 +676,210 @@ func (d *WebhookDaemon) ProcessRequest(w http.ResponseWriter, r *http.Request) e
 	// check to see if there is anything to dispatch
 	// https://github.com/whosonfirst/go-webhookd/v3/issues/7
 
+	route_name, targets, ok := route(wh, msg)
+
+	if !ok {
+		metrics.EventProcessed(endpoint, metrics.OutcomeUnrouted)
+		log.Info("No route matched message, skipping dispatch")
+		return nil
+	}
+
+	if wh.Delivery() == webhookd.DeliveryAsync {
+		return d.enqueue(ctx, w, wh, msg)
+	}
+
 	ta = time.Now()
 
-	wg := new(sync.WaitGroup)
-	ch := make(chan *webhookd.WebhookError)
+	summary := d.dispatch(ctx, wh, msg, route_name, targets)
 
-	for idx, di := range wh.Dispatchers() {
+	// Errors storing dead letters are logged by addDeadLetters and don't change the response.
 
-		wg.Add(1)
+	d.addDeadLetters(ctx, summary, msg, t1)
+
+	tb = time.Since(ta)
+	ttd = tb
 
-		go func(idx int, di webhookd.WebhookDispatcher, body []byte) {
+	t2 := time.Since(t1)
 
-			defer wg.Done()
-			err = di.Dispatch(ctx, body)
+	log.Debug("Time to receive", "duration", ttr)
+	log.Debug("Time to transform", "duration", ttt)
+	log.Debug("Time to dispatch", "duration", ttd)
+	log.Debug("Time to process", "duration", t2)
 
-			if err != nil {
+	w.Header().Set("X-Webhookd-Time-To-Receive", fmt.Sprintf("%v", ttr))
+	w.Header().Set("X-Webhookd-Time-To-Transform", fmt.Sprintf("%v", ttt))
+	w.Header().Set("X-Webhookd-Time-To-Dispatch", fmt.Sprintf("%v", ttd))
+	w.Header().Set("X-Webhookd-Time-To-Process", fmt.Sprintf("%v", t2))
 
-				switch err.Code {
-				case webhookd.UnhandledEvent, webhookd.HaltEvent:
-					logger.Log.Info("Dispatch step (%T) at offset %d returned non-fatal error and exiting, %v", d, idx, err)
-					return
-				default:
-					logger.Log.Error("Dispatch step (%T) at offset %d failed, %v", d, idx, err)
-					ch <- err
-				}
-			}
+	w.Header().Set("Content-Type", "application/json")
 
-		}(idx, di, body)
+	if !summary.Success {
+		metrics.EventProcessed(endpoint, metrics.OutcomeFailed)
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		metrics.EventProcessed(endpoint, metrics.OutcomeSucceeded)
 	}
 
-	// https://github.com/whosonfirst/go-webhookd/issues/14
-	// this is broken as in len(errors) will always be zero even if
-	// there are errors (20190214/thisisaaronland)
+	enc_err := json.NewEncoder(w).Encode(summary)
 
-	errors := make([]string, 0)
+	if enc_err != nil {
+		return fmt.Errorf("Failed to encode dispatch summary, %w", enc_err)
+	}
 
-	go func() {
+	if !summary.Success {
+		return fmt.Errorf("Dispatch failed for '%s', %s", endpoint, summary)
+	}
 
-		for e := range ch {
-			errors = append(errors, e.Error())
-		}
-	}()
+	return nil
 
-	wg.Wait()
+}
 
-	if len(errors) > 0 {
+// enqueue durably queues 'msg' for asynchronous delivery to the dispatchers configured for 'wh' and
+// responds with "202 Accepted".
+func (d *WebhookDaemon) enqueue(ctx context.Context, w http.ResponseWriter, wh webhookd.WebhookHandler, msg *webhookd.Message) error {
 
-		msg := strings.Join(errors, "\n\n")
-		http.Error(w, msg, http.StatusInternalServerError)
-		return fmt.Errorf("Internal Server Error")
+	if d.queue == nil {
+		metrics.EventProcessed(wh.Endpoint(), metrics.OutcomeFailed)
+		http.Error(w, "Asynchronous delivery is not available", http.StatusInternalServerError)
+		return fmt.Errorf("Missing delivery queue for '%s'", wh.Endpoint())
 	}
 
-	tb = time.Since(ta)
-	ttd = tb
+	e, err := d.queue.Enqueue(ctx, wh.Endpoint(), msg)
 
-	t2 := time.Since(t1)
+	if err != nil {
+		metrics.EventProcessed(wh.Endpoint(), metrics.OutcomeFailed)
+		http.Error(w, "Failed to queue message", http.StatusInternalServerError)
+		return fmt.Errorf("Failed to queue message for '%s', %w", wh.Endpoint(), err)
+	}
 
-	logger.Log.Debug("Time to receive: %v", ttr)
-	logger.Log.Debug("Time to transform: %v", ttt)
-	logger.Log.Debug("Time to dispatch: %v", ttd)
-	logger.Log.Debug("Time to process: %v", t2)
+	rsp := map[string]string{
+		"endpoint":   wh.Endpoint(),
+		"id":         e.ID,
+		"request_id": webhookd.RequestIDFromContext(ctx),
+		"status":     "queued",
+	}
 
-	w.Header().Set("X-Webhookd-Time-To-Receive", fmt.Sprintf("%v", ttr))
-	w.Header().Set("X-Webhookd-Time-To-Transform", fmt.Sprintf("%v", ttt))
-	w.Header().Set("X-Webhookd-Time-To-Dispatch", fmt.Sprintf("%v", ttd))
-	w.Header().Set("X-Webhookd-Time-To-Process", fmt.Sprintf("%v", t2))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+
+	err = json.NewEncoder(w).Encode(rsp)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode queue response, %w", err)
+	}
 
 	return nil
+}
+
+// route returns the name of the route 'msg' matches and the offsets of the dispatchers configured for 'wh' it should be
+// relayed to. If 'wh' has no routes the name is empty and every dispatcher is used. The final boolean is false if no
+// route matches.
+func route(wh webhookd.WebhookHandler, msg *webhookd.Message) (string, []int, bool) {
+
+	names := wh.DispatcherNames()
+	router := wh.Router()
+
+	if router == nil {
+
+		targets := make([]int, len(names))
+
+		for idx := range names {
+			targets[idx] = idx
+		}
+
+		return "", targets, true
+	}
+
+	route_name, route_dispatchers, ok := router.Route(msg)
+
+	if !ok {
+		return "", nil, false
+	}
+
+	targets := make([]int, 0, len(route_dispatchers))
+
+	for _, name := range route_dispatchers {
+
+		for idx, n := range names {
+
+			if n == name {
+				targets = append(targets, idx)
+				break
+			}
+		}
+	}
+
+	return route_name, targets, true
+}
+
+// dispatch relays 'msg', received at 'received', to the dispatchers configured for 'wh' at the offsets in 'targets'
+// concurrently and returns a `webhookd.DispatchSummary` describing the outcome of each one, evaluated against the
+// webhook's dispatch policy. 'route_name' is the name of the route used to choose the dispatchers, if any. Failed
+// dispatches are not recorded in the dead letter store; callers use `addDeadLetters` for that.
+func (d *WebhookDaemon) dispatch(ctx context.Context, wh webhookd.WebhookHandler, msg *webhookd.Message, route_name string, targets []int) *webhookd.DispatchSummary {
+
+	dispatchers := wh.Dispatchers()
+	names := wh.DispatcherNames()
+
+	log := logger.FromContext(ctx)
+
+	// Each goroutine writes to its own slot so there is no need for a lock
+	// or channel to collect results.
+
+	results := make([]*webhookd.DispatchResult, len(targets))
+
+	wg := new(sync.WaitGroup)
+
+	for i, target := range targets {
+
+		wg.Add(1)
+
+		go func(i int, idx int, di webhookd.WebhookDispatcher) {
+
+			defer wg.Done()
+
+			t := time.Now()
+			err := webhookd.DispatchMessage(ctx, di, msg)
+
+			r := webhookd.NewDispatchResult(names[idx], time.Since(t), err)
+
+			switch r.Outcome {
+			case webhookd.DispatchOutcomeHalted:
+				log.Info("Dispatch step returned non-fatal error", "dispatcher", r.Dispatcher, "offset", idx, "error", err)
+			case webhookd.DispatchOutcomeFailed:
+				log.Error("Dispatch step failed", "dispatcher", r.Dispatcher, "offset", idx, "error", err)
+			}
 
+			results[i] = r
+
+		}(i, target, dispatchers[target])
+	}
+
+	wg.Wait()
+
+	summary := webhookd.NewDispatchSummary(wh.Endpoint(), wh.DispatchPolicy(), results)
+	summary.Route = route_name
+
+	return summary
+}
+
+// closeDispatchers closes the dispatchers of 'webhooks'. Errors are logged rather than returned.
+func closeDispatchers(webhooks map[string]webhookd.WebhookHandler) {
+
+	for endpoint, wh := range webhooks {
+		closeDispatcherList(endpoint, wh.DispatcherNames(), wh.Dispatchers())
+	}
+}
+
+// closeDispatcherList closes the 'dispatchers', labeled by 'names', of the webhook for 'endpoint', logging any errors.
+func closeDispatcherList(endpoint string, names []string, dispatchers []webhookd.WebhookDispatcher) {
+
+	for idx, disp := range dispatchers {
+
+		err := webhookd.CloseDispatcher(disp)
+
+		if err != nil {
+			logger.Log.Warn("Failed to close dispatcher", "endpoint", endpoint, "dispatcher", names[idx], "error", err)
+		}
+	}
 }
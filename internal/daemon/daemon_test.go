@@ -2,59 +2,808 @@ package daemon
 
 import (
 	"context"
-	"fmt"
-	"github.com/bobertrublik/webhook-router/internal/config"
-	"log"
+	"encoding/json"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/dispatcher"
+	"github.com/bobertrublik/webhook-router/internal/queue"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
 )
 
-const example_config string = "../docs/config/config.json.example"
+// FailDispatcher implements the `webhookd.WebhookDispatcher` interface and always fails.
+type FailDispatcher struct {
+	webhookd.WebhookDispatcher
+}
+
+func (d *FailDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	select {
+	case failures <- body:
+	default:
+	}
+
+	return &webhookd.WebhookError{Code: http.StatusBadGateway, Message: "Bad Gateway"}
+}
+
+// failures receives, if there is room, every message `FailDispatcher` failed to dispatch.
+var failures = make(chan []byte, 10)
+
+// RecordDispatcher implements the `webhookd.WebhookDispatcher` interface and sends every message to a channel.
+type RecordDispatcher struct {
+	webhookd.WebhookDispatcher
+}
+
+func (d *RecordDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+	recorded <- body
+	return nil
+}
+
+// recorded receives every message dispatched by `RecordDispatcher`.
+var recorded = make(chan []byte, 10)
+
+// MessageDispatcher implements the `webhookd.MessageDispatcher` interface and sends every message to a channel.
+type MessageDispatcher struct {
+	webhookd.WebhookDispatcher
+}
+
+func (d *MessageDispatcher) DispatchMessage(ctx context.Context, msg *webhookd.Message) *webhookd.WebhookError {
+	recordedMessages <- msg
+	return nil
+}
+
+// recordedMessages receives every message dispatched by `MessageDispatcher`.
+var recordedMessages = make(chan *webhookd.Message, 10)
+
+func init() {
+
+	ctx := context.Background()
+
+	err := dispatcher.RegisterDispatcher(ctx, "fail", func(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
+		return &FailDispatcher{}, nil
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = dispatcher.RegisterDispatcher(ctx, "record", func(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
+		return &RecordDispatcher{}, nil
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = dispatcher.RegisterDispatcher(ctx, "message", func(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
+		return &MessageDispatcher{}, nil
+	})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func newTestConfig() *config.WebhookConfig {
+
+	return &config.WebhookConfig{
+		Receivers: map[string]string{
+			"passthrough": "passthrough://",
+		},
+		Transformations: map[string]string{
+			"passthrough": "passthrough://",
+		},
+		Dispatchers: map[string]config.WebhookDispatcherConfig{
+			"log":    {URI: "log://"},
+			"fail":   {URI: "fail://"},
+			"record": {URI: "record://"},
+			"message": {
+				URI:   "message://",
+				Retry: &config.WebhookRetryConfig{MaxAttempts: 2},
+			},
+		},
+		Webhooks: []config.WebhookWebhooksConfig{
+			{
+				Endpoint:        "/insecure-test",
+				Receiver:        "passthrough",
+				Transformations: []string{"passthrough"},
+				Dispatchers:     []string{"log"},
+			},
+		},
+	}
+}
 
 func TestNewWebhookDaemonFromConfig(t *testing.T) {
 
 	ctx := context.Background()
 
-	path_config, err := filepath.Abs(example_config)
+	cfg := newTestConfig()
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader("hello world"))
+	rsp := httptest.NewRecorder()
+
+	err = d.ProcessRequest(rsp, req)
+
+	if err != nil {
+		t.Fatalf("Failed to process request, %v", err)
+	}
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("Unexpected HTTP status: %d", rsp.Code)
+	}
+}
+
+func TestNewWebhookDaemonFromConfigRedact(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SECRET", "s33kret-t0ken")
+
+	path_config := filepath.Join(t.TempDir(), "config.yaml")
+
+	body := `
+receivers:
+  passthrough: "passthrough://"
+dispatchers:
+  http: "https://example.com/hooks#timeout=${WEBHOOKD_TEST_SECRET}"
+webhooks:
+  - endpoint: "/redact"
+    receiver: "passthrough"
+    dispatchers:
+      - "http"
+`
+
+	err := os.WriteFile(path_config, []byte(body), 0600)
+
+	if err != nil {
+		t.Fatalf("Failed to write %s, %v", path_config, err)
+	}
+
+	cfg, err := config.NewConfig(path_config)
+
+	if err != nil {
+		t.Fatalf("Failed to create new config, %v", err)
+	}
+
+	// The dispatcher's error quotes the invalid timeout, which is a secret.
+
+	_, err = NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err == nil {
+		t.Fatalf("Expected invalid timeout to fail")
+	}
+
+	if strings.Contains(err.Error(), "s33kret-t0ken") || !strings.Contains(err.Error(), config.Redacted) {
+		t.Fatalf("Expected secret to be redacted from '%v'", err)
+	}
+}
+
+func TestProcessRequestDispatchPolicy(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := map[string]int{
+		webhookd.DispatchPolicyAll:        http.StatusInternalServerError,
+		webhookd.DispatchPolicyAny:        http.StatusOK,
+		webhookd.DispatchPolicyBestEffort: http.StatusOK,
+	}
+
+	for policy, expected := range tests {
+
+		cfg := newTestConfig()
+		cfg.Webhooks[0].Dispatchers = []string{"log", "fail"}
+		cfg.Webhooks[0].DispatchPolicy = policy
+
+		d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+		if err != nil {
+			t.Fatalf("Failed to create new daemon from config, %v", err)
+		}
+
+		req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader("hello world"))
+		rsp := httptest.NewRecorder()
+
+		d.ProcessRequest(rsp, req)
+
+		if rsp.Code != expected {
+			t.Fatalf("Unexpected HTTP status for policy %s: %d", policy, rsp.Code)
+		}
+
+		var summary struct {
+			Status      string `json:"status"`
+			Success     bool   `json:"success"`
+			Dispatchers []struct {
+				Dispatcher string `json:"dispatcher"`
+				Outcome    string `json:"outcome"`
+			} `json:"dispatchers"`
+		}
+
+		err = json.Unmarshal(rsp.Body.Bytes(), &summary)
+
+		if err != nil {
+			t.Fatalf("Failed to decode summary for policy %s, %v", policy, err)
+		}
+
+		if summary.Status != webhookd.DispatchStatusPartial {
+			t.Fatalf("Unexpected status for policy %s: %s", policy, summary.Status)
+		}
+
+		if len(summary.Dispatchers) != 2 || summary.Dispatchers[1].Dispatcher != "fail" || summary.Dispatchers[1].Outcome != webhookd.DispatchOutcomeFailed {
+			t.Fatalf("Unexpected dispatcher results for policy %s: %s", policy, rsp.Body.String())
+		}
+	}
+}
+
+func TestInvalidDispatchPolicy(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := newTestConfig()
+	cfg.Webhooks[0].DispatchPolicy = "chicken"
+
+	_, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err == nil {
+		t.Fatalf("Expected invalid dispatch policy to fail")
+	}
+}
+
+func TestReservedEndpoint(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, endpoint := range []string{"/metrics", "/admin/dlq", "/admin/dlq/123"} {
+
+		cfg := newTestConfig()
+		cfg.Webhooks[0].Endpoint = endpoint
+
+		_, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+		if err == nil {
+			t.Fatalf("Expected reserved endpoint '%s' to fail", endpoint)
+		}
+	}
+
+	cfg := newTestConfig()
+	cfg.Webhooks[0].Endpoint = "/admin/dlqs"
+
+	_, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Expected endpoint outside the reserved paths to succeed, %v", err)
+	}
+}
+
+func TestProcessRequestAsync(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := newTestConfig()
+	cfg.Webhooks[0].Dispatchers = []string{"record"}
+	cfg.Webhooks[0].Delivery = webhookd.DeliveryAsync
+
+	_, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err == nil {
+		t.Fatalf("Expected asynchronous delivery without a queue path to fail")
+	}
+
+	cfg.Queue.Path = t.TempDir()
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	err = d.Start(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to start daemon, %v", err)
+	}
+
+	defer d.Close()
+
+	req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader("hello world"))
+	rsp := httptest.NewRecorder()
+
+	err = d.ProcessRequest(rsp, req)
+
+	if err != nil {
+		t.Fatalf("Failed to process request, %v", err)
+	}
+
+	if rsp.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected HTTP status: %d", rsp.Code)
+	}
+
+	select {
+	case body := <-recorded:
+
+		if string(body) != "hello world" {
+			t.Fatalf("Unexpected dispatched body '%s'", string(body))
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for asynchronous delivery")
+	}
+}
+
+func TestProcessRequestAsyncFailure(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, dlq := range []bool{false, true} {
+
+		cfg := newTestConfig()
+		cfg.Webhooks[0].Dispatchers = []string{"fail"}
+		cfg.Webhooks[0].Delivery = webhookd.DeliveryAsync
+		cfg.Queue.Path = t.TempDir()
+
+		if dlq {
+			cfg.DeadLetter = "file://" + t.TempDir()
+		}
+
+		d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+		if err != nil {
+			t.Fatalf("Failed to create new daemon from config, %v", err)
+		}
+
+		err = d.Start(ctx)
+
+		if err != nil {
+			t.Fatalf("Failed to start daemon, %v", err)
+		}
+
+		for len(failures) > 0 {
+			<-failures
+		}
+
+		req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader("hello world"))
+		rsp := httptest.NewRecorder()
+
+		d.ProcessRequest(rsp, req)
+
+		select {
+		case <-failures:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for asynchronous delivery")
+		}
+
+		// Dead lettered messages are acknowledged; wait for that so that closing the daemon
+		// doesn't interrupt the delivery first.
+
+		deadline := time.Now().Add(5 * time.Second)
+
+		for dlq && d.queue.Depth() > 0 {
+
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for dead lettered delivery to be acknowledged")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		err = d.Close()
+
+		if err != nil {
+			t.Fatalf("Failed to close daemon, %v", err)
+		}
+
+		q, err := queue.Open(cfg.Queue.Path)
+
+		if err != nil {
+			t.Fatalf("Failed to reopen queue, %v", err)
+		}
+
+		depth := q.Depth()
+		q.Close()
+
+		// Without a dead letter store the message must stay in the queue, with one it is moved there.
+
+		switch {
+		case !dlq && depth != 1:
+			t.Fatalf("Expected failed delivery to stay in the queue, depth is %d", depth)
+		case dlq && depth != 0:
+			t.Fatalf("Expected dead lettered delivery to be removed from the queue, depth is %d", depth)
+		}
+	}
+}
+
+func TestProcessRequestAsyncClose(t *testing.T) {
+
+	ctx := context.Background()
+
+	started := make(chan bool, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- true:
+		default:
+		}
+
+		// The body must be read for the server to notice the client going away.
+
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+
+	defer srv.Close()
+
+	cfg := newTestConfig()
+	cfg.Dispatchers["slack"] = config.WebhookDispatcherConfig{URI: "slack://?webhook=" + srv.URL}
+	cfg.Webhooks[0].Dispatchers = []string{"slack"}
+	cfg.Webhooks[0].Delivery = webhookd.DeliveryAsync
+	cfg.Queue.Path = t.TempDir()
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	err = d.Start(ctx)
 
 	if err != nil {
-		t.Fatalf("Failed to derive absolute path for %s, %v", example_config, err)
+		t.Fatalf("Failed to start daemon, %v", err)
 	}
 
-	uri := fmt.Sprintf("file://%s?decoder=string", path_config)
+	req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader(`{"text":"hello world"}`))
+	d.ProcessRequest(httptest.NewRecorder(), req)
 
-	cfg, err := config.NewConfigFromURI(ctx, uri)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for asynchronous delivery")
+	}
+
+	// Closing the daemon interrupts the delivery, which must stay in the queue to be delivered
+	// again the next time the daemon starts.
+
+	err = d.Close()
 
 	if err != nil {
-		t.Fatalf("Failed to create new config for %s, %v", path_config, err)
+		t.Fatalf("Failed to close daemon, %v", err)
 	}
 
+	q, err := queue.Open(cfg.Queue.Path)
+
+	if err != nil {
+		t.Fatalf("Failed to reopen queue, %v", err)
+	}
+
+	defer q.Close()
+
+	if q.Depth() != 1 {
+		t.Fatalf("Expected interrupted delivery to stay in the queue, depth is %d", q.Depth())
+	}
+}
+
+func TestProcessRequestMessage(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := newTestConfig()
+	cfg.Webhooks[0].Dispatchers = []string{"message"}
+	cfg.Queue.Path = t.TempDir()
+
+	async := cfg.Webhooks[0]
+	async.Endpoint = "/async-test"
+	async.Delivery = webhookd.DeliveryAsync
+
+	cfg.Webhooks = append(cfg.Webhooks, async)
+
 	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
 
 	if err != nil {
 		t.Fatalf("Failed to create new daemon from config, %v", err)
 	}
 
-	go func() {
+	err = d.Start(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to start daemon, %v", err)
+	}
+
+	defer d.Close()
+
+	for _, endpoint := range []string{"/insecure-test", "/async-test"} {
+
+		req := httptest.NewRequest("POST", endpoint, strings.NewReader("hello world"))
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("X-GitHub-Event", "push")
+
+		rsp := httptest.NewRecorder()
+
+		err = d.ProcessRequest(rsp, req)
+
+		if err != nil {
+			t.Fatalf("Failed to process request for %s, %v", endpoint, err)
+		}
+
+		select {
+		case msg := <-recordedMessages:
+
+			if string(msg.Body) != "hello world" {
+				t.Fatalf("Unexpected dispatched body '%s'", string(msg.Body))
+			}
+
+			if msg.Get(webhookd.MetadataEndpoint) != endpoint || msg.Get(webhookd.MetadataEventType) != "push" || msg.Get(webhookd.MetadataContentType) != "text/plain" {
+				t.Fatalf("Unexpected metadata for %s, %v", endpoint, msg.Metadata)
+			}
+
+			if msg.Header.Get("X-GitHub-Event") != "push" {
+				t.Fatalf("Missing headers for %s", endpoint)
+			}
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for delivery to %s", endpoint)
+		}
+	}
+}
+
+func TestProcessRequestRoutes(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := newTestConfig()
+	cfg.Webhooks[0].Dispatchers = nil
+	cfg.Webhooks[0].Routes = []config.WebhookRouteConfig{
+		{Name: "critical", Expr: `severity == "Sev0"`, Dispatchers: []string{"record", "log"}},
+		{Name: "info", Expr: `severity == "Informational"`, Dispatchers: []string{"log"}},
+	}
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	tests := map[string]string{
+		`{"severity": "Sev0"}`:          "critical",
+		`{"severity": "Informational"}`: "info",
+		`{"severity": "Sev3"}`:          "",
+	}
+
+	for body, expected := range tests {
+
+		req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader(body))
+		rsp := httptest.NewRecorder()
+
+		err = d.ProcessRequest(rsp, req)
+
+		if err != nil {
+			t.Fatalf("Failed to process request, %v", err)
+		}
+
+		if rsp.Code != http.StatusOK {
+			t.Fatalf("Unexpected HTTP status: %d", rsp.Code)
+		}
+
+		if expected == "" {
+
+			if rsp.Body.Len() != 0 {
+				t.Fatalf("Expected unrouted message not to be dispatched, %s", rsp.Body.String())
+			}
+
+			continue
+		}
+
+		var summary struct {
+			Route string `json:"route"`
+		}
 
-		err := d.Start(ctx)
+		err = json.Unmarshal(rsp.Body.Bytes(), &summary)
 
 		if err != nil {
-			log.Fatalf("Failed to start server, %v", err)
+			t.Fatalf("Failed to decode summary, %v", err)
 		}
-	}()
 
-	body := strings.NewReader("hello world")
+		if summary.Route != expected {
+			t.Fatalf("Unexpected route '%s', expected '%s'", summary.Route, expected)
+		}
+	}
+
+	select {
+	case body := <-recorded:
+
+		if string(body) != `{"severity": "Sev0"}` {
+			t.Fatalf("Unexpected dispatched body '%s'", string(body))
+		}
+
+	default:
+		t.Fatalf("Expected critical message to be recorded")
+	}
+
+	select {
+	case body := <-recorded:
+		t.Fatalf("Unexpected dispatched body '%s'", string(body))
+	default:
+		// pass
+	}
+
+	cfg.Webhooks[0].Dispatchers = []string{"log"}
+
+	_, err = NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err == nil {
+		t.Fatalf("Expected webhook with dispatchers and routes to fail")
+	}
+
+	cfg.Webhooks[0].Dispatchers = nil
+	cfg.Webhooks[0].Routes[0].Dispatchers = []string{"chicken"}
+
+	_, err = NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err == nil {
+		t.Fatalf("Expected route with unknown dispatcher to fail")
+	}
+}
+
+func TestProcessRequestRequestID(t *testing.T) {
+
+	ctx := context.Background()
+
+	forwarded := make(chan string, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Get(webhookd.RequestIDHeader)
+	}))
+
+	defer srv.Close()
+
+	cfg := newTestConfig()
+	cfg.Dispatchers["http"] = config.WebhookDispatcherConfig{URI: srv.URL}
+	cfg.Webhooks[0].Dispatchers = []string{"http", "fail"}
+	cfg.Webhooks[0].DispatchPolicy = webhookd.DispatchPolicyAny
+	cfg.Queue.Path = t.TempDir()
+	cfg.DeadLetter = "file://" + t.TempDir()
+
+	async := cfg.Webhooks[0]
+	async.Endpoint = "/async-test"
+	async.Dispatchers = []string{"http"}
+	async.Delivery = webhookd.DeliveryAsync
+
+	cfg.Webhooks = append(cfg.Webhooks, async)
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	err = d.Start(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to start daemon, %v", err)
+	}
+
+	defer d.Close()
+
+	for _, endpoint := range []string{"/insecure-test", "/async-test"} {
+
+		req := httptest.NewRequest("POST", endpoint, strings.NewReader("hello world"))
+		req.Header.Set(webhookd.RequestIDHeader, "abc123")
+
+		rsp := httptest.NewRecorder()
+
+		d.ProcessRequest(rsp, req)
+
+		if rsp.Header().Get(webhookd.RequestIDHeader) != "abc123" {
+			t.Fatalf("Expected request ID in response for %s, got '%s'", endpoint, rsp.Header().Get(webhookd.RequestIDHeader))
+		}
+
+		select {
+		case id := <-forwarded:
+
+			if id != "abc123" {
+				t.Fatalf("Expected request ID to be forwarded for %s, got '%s'", endpoint, id)
+			}
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for delivery to %s", endpoint)
+		}
+	}
+
+	entries, err := d.DeadLetters().List(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to list dead letters, %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].Dispatcher != "fail" || entries[0].RequestID != "abc123" {
+		t.Fatalf("Expected dead letter with request ID, got %v", entries)
+	}
+
+	// Requests without a (valid) ID are assigned one
+
+	req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader("hello world"))
+	req.Header.Set(webhookd.RequestIDHeader, "not valid")
+
+	rsp := httptest.NewRecorder()
+
+	d.ProcessRequest(rsp, req)
+
+	id := rsp.Header().Get(webhookd.RequestIDHeader)
+
+	if id == "" || id == "not valid" {
+		t.Fatalf("Expected a new request ID, got '%s'", id)
+	}
+
+	if <-forwarded != id {
+		t.Fatalf("Expected generated request ID to be forwarded")
+	}
+}
+
+func TestDeadLetterCredentials(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SECRET", "s33kret")
+
+	cfg := newTestConfig()
+	cfg.Receivers["gitlab"] = "hmac://gitlab?secret_env=WEBHOOKD_TEST_SECRET"
+	cfg.Webhooks[0].Receiver = "gitlab"
+	cfg.Webhooks[0].Dispatchers = []string{"fail"}
+	cfg.DeadLetter = "file://" + t.TempDir()
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	defer d.Close()
+
+	req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader("hello world"))
+	req.Header.Set("X-Gitlab-Token", "s33kret")
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+
+	rsp := httptest.NewRecorder()
+
+	d.ProcessRequest(rsp, req)
+
+	entries, err := d.DeadLetters().List(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to list dead letters, %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("Expected one dead letter, got %d", len(entries))
+	}
+
+	e, err := d.DeadLetters().Get(ctx, entries[0].ID)
+
+	if err != nil {
+		t.Fatalf("Failed to get dead letter, %v", err)
+	}
+
+	if e.Header.Get("X-Gitlab-Event") != "Push Hook" {
+		t.Fatalf("Expected event header to be stored")
+	}
 
-	rsp, err := http.Post("http://localhost:8080/insecure-test", "text/plain", body)
+	enc, err := json.Marshal(e)
 
 	if err != nil {
-		t.Fatalf("Failed to issue webhook request, %v", err)
+		t.Fatalf("Failed to encode dead letter, %v", err)
 	}
 
-	if rsp.StatusCode != http.StatusOK {
-		t.Fatalf("Unexpected HTTP status: %s", rsp.Status)
+	if strings.Contains(string(enc), "s33kret") {
+		t.Fatalf("GitLab token was stored in dead letter: %s", enc)
 	}
 }
@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/deadletter"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/bobertrublik/webhook-router/internal/middleware"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// DeadLetters() returns the store for messages that dispatchers failed to relay or nil if none is configured.
+func (d *WebhookDaemon) DeadLetters() deadletter.Store {
+	return d.deadLetters
+}
+
+// AdminMiddleware() returns a single `middleware.Middleware` chaining all the middleware configured for the administrative endpoints.
+func (d *WebhookDaemon) AdminMiddleware() middleware.Middleware {
+	return middleware.Chain(d.adminMiddleware...)
+}
+
+// HasAdminAuth() returns true if an authentication policy, other than "none", is configured for the administrative endpoints.
+func (d *WebhookDaemon) HasAdminAuth() bool {
+	return len(d.adminMiddleware) > 0
+}
+
+// ReplayDeadLetter() dispatches the dead letter entry 'id' again using the dispatcher that originally failed. If the dispatch
+// succeeds the entry is removed from the store, otherwise the entry is updated with the new error.
+func (d *WebhookDaemon) ReplayDeadLetter(ctx context.Context, id string) (*webhookd.DispatchResult, error) {
+
+	if d.deadLetters == nil {
+		return nil, fmt.Errorf("Dead letter store is not configured")
+	}
+
+	e, err := d.deadLetters.Get(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	wh, _, release, ok := d.Acquire(e.Endpoint)
+
+	if !ok {
+		return nil, fmt.Errorf("Endpoint '%s' is no longer configured", e.Endpoint)
+	}
+
+	defer release()
+
+	var disp webhookd.WebhookDispatcher
+
+	for idx, name := range wh.DispatcherNames() {
+
+		if name == e.Dispatcher {
+			disp = wh.Dispatchers()[idx]
+			break
+		}
+	}
+
+	if disp == nil {
+		return nil, fmt.Errorf("Dispatcher '%s' is no longer configured for endpoint '%s'", e.Dispatcher, e.Endpoint)
+	}
+
+	// Replays are sent with the ID of the original request so that they can be correlated with it.
+
+	if e.RequestID != "" {
+		ctx = webhookd.NewRequestIDContext(ctx, e.RequestID)
+	}
+
+	t := time.Now()
+	dispatch_err := webhookd.DispatchMessage(ctx, disp, e.Message())
+
+	r := webhookd.NewDispatchResult(e.Dispatcher, time.Since(t), dispatch_err)
+
+	if r.Outcome == webhookd.DispatchOutcomeFailed {
+
+		e.Replays += 1
+		e.Code = dispatch_err.Code
+		e.Error = dispatch_err.Error()
+		e.Failed = time.Now()
+
+		err := d.deadLetters.Put(ctx, e)
+
+		if err != nil {
+			return r, fmt.Errorf("Failed to update dead letter entry, %w", err)
+		}
+
+		logger.Log.Warn("Dead letter replay failed", "id", e.ID, "request_id", e.RequestID, "endpoint", e.Endpoint, "dispatcher", e.Dispatcher, "error", dispatch_err)
+		return r, nil
+	}
+
+	err = d.deadLetters.Delete(ctx, e.ID)
+
+	if err != nil {
+		return r, fmt.Errorf("Failed to delete dead letter entry, %w", err)
+	}
+
+	logger.Log.Info("Dead letter replayed", "id", e.ID, "request_id", e.RequestID, "endpoint", e.Endpoint, "dispatcher", e.Dispatcher, "outcome", r.Outcome)
+	return r, nil
+}
+
+// addDeadLetters records each failed dispatch in 'summary' of 'msg', received at 'received', in the dead letter store.
+// It returns an error if any of them could not be stored. If no store is configured this method is a no-op.
+func (d *WebhookDaemon) addDeadLetters(ctx context.Context, summary *webhookd.DispatchSummary, msg *webhookd.Message, received time.Time) error {
+
+	errs := make([]error, 0)
+
+	for _, r := range summary.Failures() {
+
+		err := d.addDeadLetter(ctx, summary.Endpoint, r, msg, received)
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// addDeadLetter records the failed dispatch 'r' of 'msg', received by 'endpoint' at 'received', in the dead letter store.
+func (d *WebhookDaemon) addDeadLetter(ctx context.Context, endpoint string, r *webhookd.DispatchResult, msg *webhookd.Message, received time.Time) error {
+
+	if d.deadLetters == nil {
+		return nil
+	}
+
+	log := logger.FromContext(ctx)
+
+	id, err := deadletter.NewEntryID()
+
+	if err != nil {
+		log.Error("Failed to create dead letter ID", "dispatcher", r.Dispatcher, "error", err)
+		return fmt.Errorf("Failed to create dead letter ID, %w", err)
+	}
+
+	e := &deadletter.Entry{
+		ID:         id,
+		Endpoint:   endpoint,
+		Dispatcher: r.Dispatcher,
+		RequestID:  webhookd.RequestIDFromContext(ctx),
+		Body:       msg.Body,
+		Header:     msg.Header,
+		Metadata:   msg.Metadata,
+		Received:   received,
+		Failed:     time.Now(),
+	}
+
+	if r.Error != nil {
+		e.Code = r.Error.Code
+		e.Error = r.Error.Error()
+	}
+
+	// Use a context that outlives the request, which may be cancelled by the time
+	// dispatching has failed, so that the dead letter is not lost.
+
+	err = d.deadLetters.Put(context.WithoutCancel(ctx), e)
+
+	if err != nil {
+		log.Error("Failed to store dead letter", "dispatcher", r.Dispatcher, "error", err)
+		return fmt.Errorf("Failed to store dead letter for dispatcher '%s', %w", r.Dispatcher, err)
+	}
+
+	log.Warn("Stored dead letter", "id", id, "dispatcher", r.Dispatcher)
+	return nil
+}
@@ -0,0 +1,180 @@
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// The stages of a dry run, in the order they are run.
+const (
+	DryRunStageReceiver       string = "receiver"
+	DryRunStageTransformation string = "transformation"
+	DryRunStageDispatcher     string = "dispatcher"
+)
+
+// type DryRunStep is a struct describing the outcome of a single stage of a dry run.
+type DryRunStep struct {
+	// Stage is one of `DryRunStageReceiver`, `DryRunStageTransformation` or `DryRunStageDispatcher`.
+	Stage string
+	// Offset is the position of the transformation or dispatcher in the webhook's list of transformations or dispatchers.
+	Offset int
+	// Name is the label of the dispatcher. It is empty for other stages.
+	Name string
+	// Message is the message produced by the receiver or transformation or, for dispatchers, the message the dispatcher
+	// is (or would be) sent. It is nil if the stage returned an error.
+	Message *webhookd.Message
+	// Payload is what the dispatcher sends (or would send) to relay `Message`, as returned by `webhookd.PreviewMessage`.
+	// It differs from the body of `Message` for dispatchers, like PagerDuty or Teams, which send a payload derived from
+	// it. It is nil for other stages or if the stage returned an error.
+	Payload []byte
+	// Error is the error returned by the receiver or transformation, or by the dispatcher when previewing its payload,
+	// if any.
+	Error *webhookd.WebhookError
+	// Result is the outcome of relaying the message with the dispatcher. It is nil unless the message was dispatched.
+	Result *webhookd.DispatchResult
+}
+
+// type DryRunResult is a struct describing the outcome of a dry run.
+type DryRunResult struct {
+	// Endpoint is the relative URI of the webhook.
+	Endpoint string
+	// Steps is the list of stages that were run, in order.
+	Steps []*DryRunStep
+	// Halted is true if the receiver or a transformation stopped processing the message with a non-fatal error.
+	Halted bool
+	// Routed is false if the message did not match any of the webhook's routes, so would not be dispatched.
+	Routed bool
+	// Route is the name of the route used to choose the dispatchers, if the webhook has routes.
+	Route string
+	// Summary describes the outcome of each dispatch. It is nil unless the message was dispatched.
+	Summary *webhookd.DispatchSummary
+}
+
+// Failed() returns the first error returned by the receiver, a transformation or a dispatcher previewing its payload, or
+// nil if there is none. Non-fatal errors which halt processing are not failures.
+func (r *DryRunResult) Failed() *webhookd.WebhookError {
+
+	if r.Halted {
+		return nil
+	}
+
+	for _, step := range r.Steps {
+
+		if step.Error != nil {
+			return step.Error
+		}
+	}
+
+	return nil
+}
+
+// DryRun() processes 'r' with the webhook configured for its endpoint in the same way as `ProcessRequest`, recording the
+// message after each stage. Each dispatcher the message would be relayed to is asked for the payload it would send, so
+// nothing leaves the process unless 'dispatch' is true. In that case the message is also relayed to the dispatchers for
+// real, synchronously regardless of the webhook's delivery mode. Authentication is not applied. An error is only
+// returned if there is no webhook for the endpoint; the outcome of each stage is recorded in the result.
+func (d *WebhookDaemon) DryRun(r *http.Request, dispatch bool) (*DryRunResult, error) {
+
+	ctx := NewRequestContext(r)
+
+	endpoint := r.URL.Path
+
+	wh, _, release, ok := d.Acquire(endpoint)
+
+	if !ok {
+		return nil, fmt.Errorf("No webhook configured for endpoint '%s'", endpoint)
+	}
+
+	defer release()
+
+	result := &DryRunResult{
+		Endpoint: endpoint,
+		Steps:    make([]*DryRunStep, 0),
+	}
+
+	halted := func(err *webhookd.WebhookError) bool {
+		return err.Code == webhookd.UnhandledEvent || err.Code == webhookd.HaltEvent
+	}
+
+	msg, err := webhookd.ReceiveMessage(ctx, wh.Receiver(), r.WithContext(ctx))
+
+	if err != nil {
+		result.Steps = append(result.Steps, &DryRunStep{Stage: DryRunStageReceiver, Error: err})
+		result.Halted = halted(err)
+		return result, nil
+	}
+
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string)
+	}
+
+	msg.Metadata[webhookd.MetadataRequestID] = webhookd.RequestIDFromContext(ctx)
+
+	result.Steps = append(result.Steps, &DryRunStep{Stage: DryRunStageReceiver, Message: msg.Clone()})
+
+	for idx, step := range wh.Transformations() {
+
+		msg, err = webhookd.TransformMessage(ctx, step, msg)
+
+		if err != nil {
+			result.Steps = append(result.Steps, &DryRunStep{Stage: DryRunStageTransformation, Offset: idx, Error: err})
+			result.Halted = halted(err)
+			return result, nil
+		}
+
+		result.Steps = append(result.Steps, &DryRunStep{Stage: DryRunStageTransformation, Offset: idx, Message: msg.Clone()})
+	}
+
+	route_name, targets, ok := route(wh, msg)
+
+	result.Route = route_name
+	result.Routed = ok
+
+	if !ok {
+		return result, nil
+	}
+
+	names := wh.DispatcherNames()
+	dispatchers := wh.Dispatchers()
+
+	for _, idx := range targets {
+
+		// Each dispatcher previews its own copy, so that one modifying the message can't affect the others.
+
+		step := &DryRunStep{Stage: DryRunStageDispatcher, Offset: idx, Name: names[idx]}
+		sent := msg.Clone()
+
+		payload, err := webhookd.PreviewMessage(ctx, dispatchers[idx], sent)
+
+		if err != nil {
+			step.Error = err
+		} else {
+			step.Message = sent
+			step.Payload = payload
+		}
+
+		result.Steps = append(result.Steps, step)
+	}
+
+	if !dispatch {
+		return result, nil
+	}
+
+	received := time.Now()
+
+	result.Summary = d.dispatch(ctx, wh, msg, route_name, targets)
+	d.addDeadLetters(ctx, result.Summary, msg, received)
+
+	// The summary's results are in the same order as 'targets', like the dispatcher steps at the end of the list.
+
+	offset := len(result.Steps) - len(targets)
+
+	for i, r := range result.Summary.Results {
+		result.Steps[offset+i].Result = r
+	}
+
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package daemon
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func TestDryRun(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := newTestConfig()
+	cfg.Transformations["noise"] = `filter://?exclude=status == "Resolved"`
+	cfg.Webhooks[0].Transformations = []string{"passthrough", "#disabled", "noise"}
+	cfg.Webhooks[0].Dispatchers = nil
+	cfg.Webhooks[0].Routes = []config.WebhookRouteConfig{
+		{Name: "critical", Expr: `sev == "0"`, Dispatchers: []string{"log", "record"}},
+	}
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	dry_run := func(body string, dispatch bool) *DryRunResult {
+
+		req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader(body))
+
+		result, err := d.DryRun(req, dispatch)
+
+		if err != nil {
+			t.Fatalf("Failed to dry run '%s', %v", body, err)
+		}
+
+		return result
+	}
+
+	result := dry_run(`{"sev":"0"}`, false)
+
+	stages := []string{DryRunStageReceiver, DryRunStageTransformation, DryRunStageTransformation, DryRunStageDispatcher, DryRunStageDispatcher}
+
+	if len(result.Steps) != len(stages) {
+		t.Fatalf("Expected %d steps, got %d", len(stages), len(result.Steps))
+	}
+
+	for i, stage := range stages {
+
+		step := result.Steps[i]
+
+		if step.Stage != stage || step.Error != nil || string(step.Message.Body) != `{"sev":"0"}` {
+			t.Fatalf("Unexpected step %d, %v", i, step)
+		}
+	}
+
+	if result.Route != "critical" || result.Steps[3].Name != "log" || result.Steps[4].Name != "record" {
+		t.Fatalf("Unexpected route or dispatchers, %v", result)
+	}
+
+	if result.Summary != nil || result.Failed() != nil {
+		t.Fatalf("Expected dry run not to dispatch or fail")
+	}
+
+	select {
+	case <-recorded:
+		t.Fatalf("Expected dry run not to dispatch message")
+	default:
+	}
+
+	result = dry_run(`{"sev":"0"}`, true)
+
+	if result.Summary == nil || !result.Summary.Success || result.Steps[4].Result.Outcome != webhookd.DispatchOutcomeOK {
+		t.Fatalf("Expected message to be dispatched, %v", result.Summary)
+	}
+
+	if string(<-recorded) != `{"sev":"0"}` {
+		t.Fatalf("Unexpected dispatched message")
+	}
+
+	result = dry_run(`{"sev":"3"}`, false)
+
+	if result.Routed || len(result.Steps) != 3 {
+		t.Fatalf("Expected message not to be routed, %v", result)
+	}
+
+	result = dry_run(`{"sev":"0","status":"Resolved"}`, false)
+
+	if !result.Halted || result.Failed() != nil || len(result.Steps) != 3 || result.Steps[2].Error == nil {
+		t.Fatalf("Expected message to be halted by filter, %v", result)
+	}
+
+	_, err = d.DryRun(httptest.NewRequest("POST", "/missing", nil), false)
+
+	if err == nil {
+		t.Fatalf("Expected dry run for unknown endpoint to fail")
+	}
+}
+
+func TestDryRunPreview(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := newTestConfig()
+	cfg.Dispatchers["teams"] = config.WebhookDispatcherConfig{URI: "teams://?webhook=https://example.com/hook"}
+	cfg.Webhooks[0].Dispatchers = []string{"teams", "log"}
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/insecure-test", strings.NewReader(`{"text":"hello world"}`))
+
+	result, err := d.DryRun(req, false)
+
+	if err != nil {
+		t.Fatalf("Failed to dry run, %v", err)
+	}
+
+	// The Teams dispatcher wraps the message in an Adaptive Card, the log dispatcher sends it as it is.
+
+	steps := result.Steps
+
+	teams := steps[len(steps)-2]
+	log := steps[len(steps)-1]
+
+	if teams.Stage != DryRunStageDispatcher || teams.Name != "teams" || log.Name != "log" {
+		t.Fatalf("Unexpected dispatcher steps, %v", steps)
+	}
+
+	if teams.Error != nil || string(teams.Message.Body) != `{"text":"hello world"}` || !strings.Contains(string(teams.Payload), "AdaptiveCard") {
+		t.Fatalf("Unexpected Teams step, %v", teams)
+	}
+
+	if log.Error != nil || string(log.Payload) != `{"text":"hello world"}` {
+		t.Fatalf("Unexpected log step, %v", log)
+	}
+}
@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/bobertrublik/webhook-router/internal/middleware"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// Reload() replaces the webhooks configured for 'd' with those defined in 'cfg'. Every receiver, transformation,
+// dispatcher and middleware is created, and so validated, before any changes are made. If that fails an error is
+// returned and 'd' keeps its current webhooks. Otherwise the new webhooks are swapped in atomically; requests which are
+// already in flight finish using the webhooks they started with, after which the old webhooks' dispatchers are closed.
+//
+// The delivery queue, dead letter store and admin settings can not be changed without restarting the daemon. Changes
+// to them are logged and otherwise ignored.
+func (d *WebhookDaemon) Reload(ctx context.Context, cfg *config.WebhookConfig) error {
+
+	next := WebhookDaemon{
+		webhooks:   make(map[string]webhookd.WebhookHandler),
+		middleware: make(map[string][]middleware.Middleware),
+		inflight:   new(sync.WaitGroup),
+	}
+
+	err := next.AddWebhooksFromConfig(ctx, cfg)
+
+	// The dispatchers created for 'next' are never used if it is rejected, so they must be closed
+	// here rather than by the goroutine below.
+
+	if err != nil {
+		closeDispatchers(next.webhooks)
+		return fmt.Errorf("Failed to add webhooks from config, %w", err)
+	}
+
+	for _, hook := range cfg.Webhooks {
+
+		if hook.Delivery == webhookd.DeliveryAsync && d.queueConfig == nil {
+			closeDispatchers(next.webhooks)
+			return fmt.Errorf("Webhook '%s' uses asynchronous delivery but the delivery queue was not configured when the daemon started", hook.Endpoint)
+		}
+	}
+
+	if d.queueConfig != nil && *d.queueConfig != cfg.Queue {
+		logger.Log.Warn("Changes to the queue settings require a restart and will be ignored")
+	}
+
+	if cfg.DeadLetter != d.deadLetterURI || !reflect.DeepEqual(cfg.Admin, d.adminConfig) {
+		logger.Log.Warn("Changes to the dead letter settings require a restart and will be ignored")
+	}
+
+	d.mu.Lock()
+
+	previous := d.webhooks
+	inflight := d.inflight
+
+	d.webhooks = next.webhooks
+	d.middleware = next.middleware
+	d.inflight = next.inflight
+
+	d.mu.Unlock()
+
+	// Nothing can acquire the previous webhooks once they have been swapped out, so once those
+	// in use are released their dispatchers can be closed.
+
+	go func() {
+		inflight.Wait()
+		closeDispatchers(previous)
+	}()
+
+	logger.Log.Info("Reloaded webhooks", "endpoints", next.Endpoints())
+	return nil
+}
@@ -0,0 +1,246 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/dispatcher"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// hasEndpoint reports whether a webhook is configured for 'endpoint' in 'd'.
+func hasEndpoint(d *WebhookDaemon, endpoint string) bool {
+
+	_, _, release, ok := d.Acquire(endpoint)
+
+	if ok {
+		release()
+	}
+
+	return ok
+}
+
+// BlockDispatcher implements the `webhookd.WebhookDispatcher` interface and waits for `unblock` before returning.
+type BlockDispatcher struct {
+	webhookd.WebhookDispatcher
+}
+
+func (d *BlockDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+	blocked <- true
+	<-unblock
+	return nil
+}
+
+func (d *BlockDispatcher) Close() error {
+	closed <- true
+	return nil
+}
+
+// blocked receives a value every time `BlockDispatcher` starts dispatching a message.
+var blocked = make(chan bool, 1)
+
+// unblock releases messages being dispatched by `BlockDispatcher`.
+var unblock = make(chan bool)
+
+// closed receives a value every time a `BlockDispatcher` is closed.
+var closed = make(chan bool, 1)
+
+func init() {
+
+	ctx := context.Background()
+
+	err := dispatcher.RegisterDispatcher(ctx, "block", func(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
+		return &BlockDispatcher{}, nil
+	})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := newTestConfig()
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	before := d.Endpoints()
+
+	next := newTestConfig()
+	next.Webhooks = append(next.Webhooks, config.WebhookWebhooksConfig{
+		Endpoint:    "/reloaded",
+		Receiver:    "passthrough",
+		Dispatchers: []string{"log"},
+	})
+
+	err = d.Reload(ctx, next)
+
+	if err != nil {
+		t.Fatalf("Failed to reload daemon, %v", err)
+	}
+
+	if !hasEndpoint(d, "/reloaded") || len(d.Endpoints()) != len(before)+1 {
+		t.Fatalf("Expected reloaded endpoint, got %v", d.Endpoints())
+	}
+
+	// An invalid config is rejected in full and the previous webhooks are kept.
+
+	invalid := newTestConfig()
+	invalid.Webhooks = append(invalid.Webhooks, config.WebhookWebhooksConfig{
+		Endpoint:    "/invalid",
+		Receiver:    "passthrough",
+		Dispatchers: []string{"chicken"},
+	})
+
+	err = d.Reload(ctx, invalid)
+
+	if err == nil {
+		t.Fatalf("Expected reload with unknown dispatcher to fail")
+	}
+
+	if hasEndpoint(d, "/invalid") || !hasEndpoint(d, "/reloaded") {
+		t.Fatalf("Expected previous webhooks to be kept, got %v", d.Endpoints())
+	}
+
+	// Asynchronous delivery can not be enabled without a restart.
+
+	async := newTestConfig()
+	async.Queue.Path = t.TempDir()
+	async.Webhooks[0].Delivery = webhookd.DeliveryAsync
+
+	err = d.Reload(ctx, async)
+
+	if err == nil {
+		t.Fatalf("Expected reload enabling asynchronous delivery to fail")
+	}
+
+	if !reflect.DeepEqual(d.Endpoints(), append(before, "/reloaded")) {
+		t.Fatalf("Expected previous webhooks to be kept, got %v", d.Endpoints())
+	}
+}
+
+func TestReloadRejectedClosesDispatchers(t *testing.T) {
+
+	ctx := context.Background()
+
+	d, err := NewWebhookDaemonFromConfig(ctx, newTestConfig())
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	// A webhook added before a later one fails, a dispatcher created before a later one fails for the same
+	// webhook, and a webhook rejected after all of them were created.
+
+	tests := map[string][]config.WebhookWebhooksConfig{
+		"later webhook": {
+			{Endpoint: "/block", Receiver: "passthrough", Dispatchers: []string{"block"}},
+			{Endpoint: "/invalid", Receiver: "passthrough", Dispatchers: []string{"chicken"}},
+		},
+		"later dispatcher": {
+			{Endpoint: "/block", Receiver: "passthrough", Dispatchers: []string{"block", "chicken"}},
+		},
+		"async": {
+			{Endpoint: "/block", Receiver: "passthrough", Dispatchers: []string{"block"}, Delivery: webhookd.DeliveryAsync},
+		},
+	}
+
+	for label, webhooks := range tests {
+
+		next := newTestConfig()
+		next.Dispatchers["block"] = config.WebhookDispatcherConfig{URI: "block://"}
+		next.Webhooks = append(next.Webhooks, webhooks...)
+
+		err = d.Reload(ctx, next)
+
+		if err == nil {
+			t.Fatalf("Expected reload (%s) to fail", label)
+		}
+
+		select {
+		case <-closed:
+			// pass
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for rejected dispatcher (%s) to be closed", label)
+		}
+	}
+}
+
+func TestReloadInFlight(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := newTestConfig()
+	cfg.Dispatchers["block"] = config.WebhookDispatcherConfig{URI: "block://"}
+	cfg.Webhooks = append(cfg.Webhooks, config.WebhookWebhooksConfig{
+		Endpoint:    "/block",
+		Receiver:    "passthrough",
+		Dispatchers: []string{"block"},
+	})
+
+	d, err := NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	rsp := httptest.NewRecorder()
+	done := make(chan error)
+
+	go func() {
+		req := httptest.NewRequest("POST", "/block", strings.NewReader("hello world"))
+		done <- d.ProcessRequest(rsp, req)
+	}()
+
+	<-blocked
+
+	// Remove the endpoint while a request for it is in flight.
+
+	err = d.Reload(ctx, newTestConfig())
+
+	if err != nil {
+		t.Fatalf("Failed to reload daemon, %v", err)
+	}
+
+	if hasEndpoint(d, "/block") {
+		t.Fatalf("Expected /block to be removed")
+	}
+
+	// The removed dispatcher is still in use so it must not be closed yet.
+
+	select {
+	case <-closed:
+		t.Fatalf("Expected dispatcher to stay open while a request is in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unblock <- true
+
+	err = <-done
+
+	if err != nil {
+		t.Fatalf("Expected in-flight request to complete, %v", err)
+	}
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code for in-flight request: %d", rsp.Code)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for removed dispatcher to be closed")
+	}
+}
@@ -0,0 +1,281 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/deadletter"
+	"github.com/bobertrublik/webhook-router/internal/dispatcher"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/bobertrublik/webhook-router/internal/middleware"
+	"github.com/bobertrublik/webhook-router/internal/receiver"
+	"github.com/bobertrublik/webhook-router/internal/routing"
+	"github.com/bobertrublik/webhook-router/internal/server"
+	"github.com/bobertrublik/webhook-router/internal/tracing"
+	"github.com/bobertrublik/webhook-router/internal/transformation"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// ValidateConfig() checks 'cfg' without creating a daemon and returns every problem found, rather than just the first.
+// Each receiver, transformation and dispatcher is instantiated so that unknown schemes, invalid options and unreadable
+// files (for example JSON schemas and templates) are reported. This means any secrets they read must be available.
+// Stores and servers are not opened; dispatchers which use a store, like the Slack Web API dispatcher, only check its
+// scheme until they dispatch a message.
+func ValidateConfig(ctx context.Context, cfg *config.WebhookConfig) []error {
+
+	errs := make([]error, 0)
+
+	report := func(msg string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(msg, args...))
+	}
+
+	for _, name := range sortedKeys(cfg.Receivers) {
+
+		uri := cfg.Receivers[name]
+		err := checkScheme(uri, receiver.Schemes())
+
+		if err == nil {
+			_, err = receiver.NewReceiver(ctx, uri)
+		}
+
+		if err != nil {
+			report("Invalid receiver '%s', %w", name, err)
+		}
+	}
+
+	for _, name := range sortedKeys(cfg.Transformations) {
+
+		uri := cfg.Transformations[name]
+		err := checkScheme(uri, transformation.Schemes())
+
+		if err == nil {
+			_, err = transformation.NewTransformation(ctx, uri)
+		}
+
+		if err != nil {
+			report("Invalid transformation '%s', %w", name, err)
+		}
+	}
+
+	for _, name := range sortedKeys(cfg.Dispatchers) {
+
+		dispatcher_cfg := cfg.Dispatchers[name]
+		uri, err := dispatcher_cfg.URIWithOptions()
+
+		if err == nil {
+			err = checkScheme(uri, dispatcher.Schemes())
+		}
+
+		if err == nil {
+			_, err = dispatcher.NewDispatcher(ctx, uri)
+		}
+
+		if err != nil {
+			report("Invalid dispatcher '%s', %w", name, err)
+		}
+
+		if dispatcher_cfg.Retry != nil {
+
+			_, err := dispatcher.NewRetryPolicyFromConfig(dispatcher_cfg.Retry)
+
+			if err != nil {
+				report("Invalid retry policy for dispatcher '%s', %w", name, err)
+			}
+		}
+	}
+
+	if len(cfg.Webhooks) == 0 {
+		report("No webhooks defined")
+	}
+
+	endpoints := make(map[string]int)
+	async := false
+
+	for i, hook := range cfg.Webhooks {
+
+		label := hook.Endpoint
+
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+			report("Missing endpoint for webhook %s", label)
+		}
+
+		if hook.Endpoint != "" {
+
+			err := checkEndpoint(hook.Endpoint)
+
+			if err != nil {
+				report("Invalid endpoint for webhook #%d, %v", i+1, err)
+			}
+
+			first, exists := endpoints[hook.Endpoint]
+
+			if exists {
+				report("Duplicate endpoint '%s' for webhooks #%d and #%d", hook.Endpoint, first, i+1)
+			} else {
+				endpoints[hook.Endpoint] = i + 1
+			}
+		}
+
+		if hook.Receiver == "" {
+			report("Missing receiver for webhook '%s'", label)
+		} else if _, ok := cfg.Receivers[hook.Receiver]; !ok {
+			report("Webhook '%s' refers to undefined receiver '%s'", label, hook.Receiver)
+		}
+
+		for _, name := range hook.Transformations {
+
+			if strings.HasPrefix(name, "#") {
+				continue
+			}
+
+			if _, ok := cfg.Transformations[name]; !ok {
+				report("Webhook '%s' refers to undefined transformation '%s'", label, name)
+			}
+		}
+
+		dispatcher_names := hook.Dispatchers
+
+		switch {
+		case len(hook.Dispatchers) == 0 && len(hook.Routes) == 0:
+			report("Missing dispatchers for webhook '%s'", label)
+		case len(hook.Dispatchers) > 0 && len(hook.Routes) > 0:
+			report("Webhook '%s' defines both dispatchers and routes, list dispatchers in a default route instead", label)
+		case len(hook.Routes) > 0:
+
+			r, err := routing.NewRouterFromConfig(hook.Routes)
+
+			if err != nil {
+				report("Invalid routes for webhook '%s', %w", label, err)
+			} else {
+				dispatcher_names = r.Dispatchers()
+			}
+		}
+
+		for _, name := range dispatcher_names {
+
+			if strings.HasPrefix(name, "#") {
+				continue
+			}
+
+			if _, ok := cfg.Dispatchers[name]; !ok {
+				report("Webhook '%s' refers to undefined dispatcher '%s'", label, name)
+			}
+		}
+
+		if hook.DispatchPolicy != "" && !webhookd.IsValidDispatchPolicy(hook.DispatchPolicy) {
+			report("Invalid dispatch policy '%s' for webhook '%s'", hook.DispatchPolicy, label)
+		}
+
+		switch hook.Delivery {
+		case "", webhookd.DeliverySync:
+			// pass
+		case webhookd.DeliveryAsync:
+			async = true
+		default:
+			report("Invalid delivery '%s' for webhook '%s'", hook.Delivery, label)
+		}
+
+		_, err := middleware.NewAuthMiddleware(ctx, hook.Auth)
+
+		if err != nil {
+			report("Invalid auth for webhook '%s', %w", label, err)
+		}
+	}
+
+	if async && cfg.Queue.Path == "" {
+		report("Missing queue path, required for asynchronous delivery")
+	}
+
+	if cfg.DeadLetter != "" {
+
+		err := checkScheme(cfg.DeadLetter, deadletter.Schemes())
+
+		if err != nil {
+			report("Invalid dead_letter store, %w", err)
+		}
+
+		_, err = middleware.NewAuthMiddleware(ctx, cfg.Admin.Auth)
+
+		if err != nil {
+			report("Invalid admin auth, %w", err)
+		}
+	}
+
+	_, err := server.NewServerFromConfig(cfg.Server, nil)
+
+	if err != nil {
+		report("Invalid server settings, %w", err)
+	}
+
+	if cfg.Tracing.Exporter != "" {
+
+		err := checkScheme(cfg.Tracing.Exporter, tracing.Schemes())
+
+		if err != nil {
+			report("Invalid tracing exporter, %w", err)
+		}
+	}
+
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		report("Invalid tracing sample_ratio, must be between 0.0 and 1.0")
+	}
+
+	_, err = logger.ParseLevel(cfg.Logging.Level)
+
+	if err != nil {
+		report("Invalid logging settings, %w", err)
+	}
+
+	switch strings.ToLower(cfg.Logging.Format) {
+	case "", logger.FormatJSON, logger.FormatText:
+		// pass
+	default:
+		report("Invalid logging settings, invalid log format '%s'", cfg.Logging.Format)
+	}
+
+	return errs
+}
+
+// checkScheme returns an error if the scheme of 'uri' is not one of 'schemes', as returned by the `Schemes` function
+// of the package that instantiates it.
+func checkScheme(uri string, schemes []string) error {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	if u.Scheme == "" {
+		return fmt.Errorf("Missing scheme in '%s'", uri)
+	}
+
+	// Scheme names are registered in upper case.
+
+	for _, s := range schemes {
+
+		if strings.EqualFold(s, u.Scheme+"://") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Unknown scheme '%s://', must be one of %s", u.Scheme, strings.ToLower(strings.Join(schemes, ", ")))
+}
+
+// sortedKeys returns the keys of 'm' in alphabetical order, so that problems are reported in a stable order.
+func sortedKeys[V any](m map[string]V) []string {
+
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func TestValidateConfig(t *testing.T) {
+
+	ctx := context.Background()
+
+	errs := ValidateConfig(ctx, newTestConfig())
+
+	if len(errs) != 0 {
+		t.Fatalf("Expected test config to be valid, got %v", errs)
+	}
+
+	cfg := newTestConfig()
+	cfg.Receivers["github"] = "github://"
+	cfg.Transformations["schema"] = "jsonschema://?schema=/does/not/exist.json"
+	cfg.Dispatchers["pigeon"] = config.WebhookDispatcherConfig{URI: "pigeon://coop"}
+
+	cfg.Webhooks[0].Transformations = []string{"passthrough", "#disabled", "missing"}
+	cfg.Webhooks[0].Dispatchers = []string{"log", "slakc"}
+
+	cfg.Webhooks = append(cfg.Webhooks, config.WebhookWebhooksConfig{
+		Endpoint:    "/insecure-test",
+		Receiver:    "nope",
+		Dispatchers: []string{"log"},
+		Delivery:    webhookd.DeliveryAsync,
+	})
+
+	cfg.Webhooks = append(cfg.Webhooks, config.WebhookWebhooksConfig{
+		Endpoint:    "/admin/dlq/hooks",
+		Receiver:    "passthrough",
+		Dispatchers: []string{"log"},
+	})
+
+	cfg.Logging.Level = "loud"
+
+	errs = ValidateConfig(ctx, cfg)
+
+	expected := []string{
+		"Invalid receiver 'github', Unknown scheme 'github://'",
+		"Invalid transformation 'schema', Failed to compile schema '/does/not/exist.json'",
+		"Invalid dispatcher 'pigeon', Unknown scheme 'pigeon://'",
+		"Webhook '/insecure-test' refers to undefined transformation 'missing'",
+		"Webhook '/insecure-test' refers to undefined dispatcher 'slakc'",
+		"Duplicate endpoint '/insecure-test' for webhooks #1 and #2",
+		"Webhook '/insecure-test' refers to undefined receiver 'nope'",
+		"Invalid endpoint for webhook #3, Endpoint '/admin/dlq/hooks' is reserved",
+		"Missing queue path, required for asynchronous delivery",
+		"Invalid logging settings, Invalid log level 'loud'",
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(errs), errs)
+	}
+
+	for i, prefix := range expected {
+
+		if !strings.HasPrefix(errs[i].Error(), prefix) {
+			t.Fatalf("Expected problem %d to start with \"%s\", got \"%v\"", i, prefix, errs[i])
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package deadletter provides an interface for storing, inspecting and replaying webhook messages that could not be dispatched.
+package deadletter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/aaronland/go-roster"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// ErrNotFound is returned when a dead letter entry does not exist.
+var ErrNotFound = errors.New("dead letter not found")
+
+// type Entry is a struct containing a webhook message that a dispatcher failed to relay.
+type Entry struct {
+	// ID is the unique identifier for the entry.
+	ID string `json:"id"`
+	// Endpoint is the relative URI of the webhook the message was received by.
+	Endpoint string `json:"endpoint"`
+	// Dispatcher is the label of the dispatcher that failed.
+	Dispatcher string `json:"dispatcher"`
+	// RequestID is the ID of the request the message was received in.
+	RequestID string `json:"request_id,omitempty"`
+	// Body is the (transformed) body of the message that failed to dispatch.
+	Body []byte `json:"body,omitempty"`
+	// Header contains the headers of the request the message was received in.
+	Header http.Header `json:"header,omitempty"`
+	// Metadata contains the metadata of the message.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Code is the code of the error returned by the dispatcher.
+	Code int `json:"code"`
+	// Error is the error message returned by the dispatcher.
+	Error string `json:"error"`
+	// Received is the time the message was received.
+	Received time.Time `json:"received"`
+	// Failed is the time of the most recent failure.
+	Failed time.Time `json:"failed"`
+	// Replays is the number of times the message has been replayed (unsuccessfully).
+	Replays int `json:"replays"`
+}
+
+// Message returns the `webhookd.Message` stored in 'e'.
+func (e *Entry) Message() *webhookd.Message {
+
+	msg := webhookd.NewMessage(e.Body)
+
+	if e.Header != nil {
+		msg.Header = e.Header
+	}
+
+	if e.Metadata != nil {
+		msg.Metadata = e.Metadata
+	}
+
+	return msg
+}
+
+// NewEntryID returns a new unique, time-ordered identifier for an `Entry`.
+func NewEntryID() (string, error) {
+
+	b := make([]byte, 4)
+
+	_, err := rand.Read(b)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate random ID, %w", err)
+	}
+
+	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
+
+// Store is an interface for storing dead letter entries.
+type Store interface {
+	// Put() stores 'e', replacing any existing entry with the same ID.
+	Put(context.Context, *Entry) error
+	// Get() returns the entry with the ID 'id' or `ErrNotFound`.
+	Get(context.Context, string) (*Entry, error)
+	// List() returns all the entries in the store, oldest failure first.
+	List(context.Context) ([]*Entry, error)
+	// Delete() removes the entry with the ID 'id' or returns `ErrNotFound`.
+	Delete(context.Context, string) error
+	// Close() releases any resources held by the store.
+	Close() error
+}
+
+// stores is a `aaronland/go-roster.Roster` instance used to maintain a list of registered `Store` initialization functions.
+var stores roster.Roster
+
+// StoreInitializationFunc is a function used to initialize an implementation of the `Store` interface.
+type StoreInitializationFunc func(ctx context.Context, uri string) (Store, error)
+
+// NewStore() returns a new `Store` instance derived from 'uri'. The semantics of and requirements for
+// 'uri' as specific to the package implementing the interface.
+func NewStore(ctx context.Context, uri string) (Store, error) {
+
+	err := ensureStoreRoster()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to ensure store roster, %w", err)
+	}
+
+	parsed, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	scheme := parsed.Scheme
+
+	i, err := stores.Driver(ctx, scheme)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find initialization function for '%s', %w", scheme, err)
+	}
+
+	init_func := i.(StoreInitializationFunc)
+	return init_func(ctx, uri)
+}
+
+// RegisterStore() associates 'scheme' with 'init_func' in an internal list of avilable `Store` implementations.
+func RegisterStore(ctx context.Context, scheme string, init_func StoreInitializationFunc) error {
+
+	err := ensureStoreRoster()
+
+	if err != nil {
+		return fmt.Errorf("Failed to ensure store roster, %w", err)
+	}
+
+	return stores.Register(ctx, scheme, init_func)
+}
+
+// ensureStoreRoster() ensures that a `aaronland/go-roster.Roster` instance used to maintain a list of registered `Store`
+// initialization functions is present
+func ensureStoreRoster() error {
+
+	if stores == nil {
+
+		r, err := roster.NewDefaultRoster()
+
+		if err != nil {
+			return fmt.Errorf("Failed to create new roster, %w", err)
+		}
+
+		stores = r
+	}
+
+	return nil
+}
+
+// Schemes() returns the list of schemes that have been "registered".
+func Schemes() []string {
+	ctx := context.Background()
+	drivers := stores.Drivers(ctx)
+
+	schemes := make([]string, len(drivers))
+
+	for idx, dr := range drivers {
+		schemes[idx] = fmt.Sprintf("%s://", dr)
+	}
+
+	sort.Strings(schemes)
+	return schemes
+}
@@ -0,0 +1,205 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterStore(ctx, "file", NewFileStore)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// FileStore implements the `Store` interface for storing dead letter entries as JSON files in a local directory.
+type FileStore struct {
+	Store
+	// root is the directory where entries are stored.
+	root string
+}
+
+// NewFileStore returns a new `FileStore` instance configured by 'uri' in the form of:
+//
+//	file:///path/to/directory
+//
+// The directory is created if it does not exist.
+func NewFileStore(ctx context.Context, uri string) (Store, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	root := u.Path
+
+	if root == "" {
+		return nil, fmt.Errorf("Missing directory path")
+	}
+
+	err = os.MkdirAll(root, 0700)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create directory '%s', %w", root, err)
+	}
+
+	s := FileStore{
+		root: root,
+	}
+
+	return &s, nil
+}
+
+// Put writes 'e' to a file named after its ID. The file is written to a temporary location and then renamed
+// so that readers never see a partial entry.
+func (s *FileStore) Put(ctx context.Context, e *Entry) error {
+
+	path, err := s.path(e.ID)
+
+	if err != nil {
+		return err
+	}
+
+	enc, err := json.MarshalIndent(e, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode entry, %w", err)
+	}
+
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, enc, 0600)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write entry, %w", err)
+	}
+
+	err = os.Rename(tmp, path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to rename entry, %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the entry with the ID 'id'.
+func (s *FileStore) Get(ctx context.Context, id string) (*Entry, error) {
+
+	path, err := s.path(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.read(path)
+}
+
+// List returns every entry in the store, oldest failure first.
+func (s *FileStore) List(ctx context.Context) ([]*Entry, error) {
+
+	paths, err := filepath.Glob(filepath.Join(s.root, "*.json"))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list entries, %w", err)
+	}
+
+	entries := make([]*Entry, 0, len(paths))
+
+	for _, path := range paths {
+
+		e, err := s.read(path)
+
+		if err != nil {
+
+			// The entry may have been deleted since the directory was listed.
+
+			if err == ErrNotFound {
+				continue
+			}
+
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Failed.Before(entries[j].Failed)
+	})
+
+	return entries, nil
+}
+
+// Delete removes the entry with the ID 'id'.
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+
+	path, err := s.path(id)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+
+	if err != nil {
+
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+
+		return fmt.Errorf("Failed to delete entry, %w", err)
+	}
+
+	return nil
+}
+
+// Close is a no-op.
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// path returns the path of the file for the entry with the ID 'id', ensuring it can not escape the store's root directory.
+func (s *FileStore) path(id string) (string, error) {
+
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("Invalid entry ID '%s'", id)
+	}
+
+	return filepath.Join(s.root, id+".json"), nil
+}
+
+// read decodes the entry stored at 'path'.
+func (s *FileStore) read(path string) (*Entry, error) {
+
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("Failed to read entry, %w", err)
+	}
+
+	var e *Entry
+
+	err = json.Unmarshal(b, &e)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode entry '%s', %w", path, err)
+	}
+
+	return e, nil
+}
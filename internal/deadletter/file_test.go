@@ -0,0 +1,92 @@
+package deadletter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+
+	ctx := context.Background()
+
+	s, err := NewStore(ctx, "file://"+t.TempDir())
+
+	if err != nil {
+		t.Fatalf("Failed to create new store, %v", err)
+	}
+
+	defer s.Close()
+
+	now := time.Now()
+
+	for i, dispatcher := range []string{"slack", "echo"} {
+
+		id, err := NewEntryID()
+
+		if err != nil {
+			t.Fatalf("Failed to create entry ID, %v", err)
+		}
+
+		e := &Entry{
+			ID:         id,
+			Endpoint:   "/api",
+			Dispatcher: dispatcher,
+			Body:       []byte("hello world"),
+			Code:       502,
+			Error:      "502 Bad Gateway",
+			Received:   now,
+			Failed:     now.Add(time.Duration(i) * time.Second),
+		}
+
+		err = s.Put(ctx, e)
+
+		if err != nil {
+			t.Fatalf("Failed to put entry, %v", err)
+		}
+	}
+
+	entries, err := s.List(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to list entries, %v", err)
+	}
+
+	if len(entries) != 2 || entries[0].Dispatcher != "slack" {
+		t.Fatalf("Unexpected entries, %v", entries)
+	}
+
+	e, err := s.Get(ctx, entries[1].ID)
+
+	if err != nil {
+		t.Fatalf("Failed to get entry, %v", err)
+	}
+
+	if string(e.Body) != "hello world" {
+		t.Fatalf("Unexpected body '%s'", string(e.Body))
+	}
+
+	err = s.Delete(ctx, e.ID)
+
+	if err != nil {
+		t.Fatalf("Failed to delete entry, %v", err)
+	}
+
+	_, err = s.Get(ctx, e.ID)
+
+	if err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	err = s.Delete(ctx, e.ID)
+
+	if err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	_, err = s.Get(ctx, "../etc/passwd")
+
+	if err == nil {
+		t.Fatalf("Expected invalid ID to fail")
+	}
+}
@@ -0,0 +1,209 @@
+package dispatcher
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/tracing"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// sharedTransport is the tuned `http.Transport` instance shared by HTTP-based dispatchers so that connections
+// to the same host are pooled and reused across dispatchers and requests.
+var sharedTransport = newTransport()
+
+// sharedClient is the `http.Client` instance used by HTTP-based dispatchers that do not require custom TLS settings.
+// Per-request timeouts are set using contexts so the client itself has no timeout. Trace context and request IDs are
+// propagated to the services messages are relayed to.
+var sharedClient = &http.Client{
+	Transport: tracing.Transport(&requestIDTransport{next: sharedTransport}),
+}
+
+// type requestIDTransport is a `http.RoundTripper` that adds the request ID carried by the context of each request
+// to its `webhookd.RequestIDHeader` header, unless the header is already set.
+type requestIDTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip executes 'req' using the transport's underlying `http.RoundTripper`.
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	id := webhookd.RequestIDFromContext(req.Context())
+
+	if id == "" || req.Header.Get(webhookd.RequestIDHeader) != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the request they are given.
+
+	req = req.Clone(req.Context())
+	req.Header.Set(webhookd.RequestIDHeader, id)
+
+	return t.next.RoundTrip(req)
+}
+
+// newTransport returns a new `http.Transport` with timeouts and connection pooling suitable for relaying webhooks.
+func newTransport() *http.Transport {
+
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return t
+}
+
+// type tlsOptions is a struct containing custom TLS settings for an HTTP-based dispatcher.
+type tlsOptions struct {
+	// CAFile is the path to a PEM-encoded bundle of certificate authorities to trust, in addition to the system pool.
+	CAFile string
+	// CertFile is the path to a PEM-encoded client certificate.
+	CertFile string
+	// KeyFile is the path to the PEM-encoded private key for `CertFile`.
+	KeyFile string
+	// InsecureSkipVerify disables verification of the server's certificate. You should not use this in production.
+	InsecureSkipVerify bool
+}
+
+// isZero returns true if 'o' does not define any custom settings.
+func (o tlsOptions) isZero() bool {
+	return o == tlsOptions{}
+}
+
+// newClient returns `sharedClient` if 'opts' does not define any custom settings, or a new `http.Client` whose
+// transport is a copy of `sharedTransport` configured with 'opts'.
+func newClient(opts tlsOptions) (*http.Client, error) {
+
+	if opts.isZero() {
+		return sharedClient, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CAFile != "" {
+
+		pem, err := os.ReadFile(opts.CAFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA file, %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Failed to parse any certificates from CA file '%s'", opts.CAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate, %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	t := sharedTransport.Clone()
+	t.TLSClientConfig = tlsConfig
+
+	cl := &http.Client{
+		Transport: tracing.Transport(&requestIDTransport{next: t}),
+	}
+
+	return cl, nil
+}
+
+// type statusRange is a struct defining an inclusive range of HTTP status codes.
+type statusRange struct {
+	min int
+	max int
+}
+
+// type statusCodes is a list of `statusRange` instances considered to be successful responses.
+type statusCodes []statusRange
+
+// parseStatusCodes parses a comma-separated list of status codes and ranges, for example "200-299,409".
+func parseStatusCodes(str string) (statusCodes, error) {
+
+	codes := make(statusCodes, 0)
+
+	for _, part := range strings.Split(str, ",") {
+
+		part = strings.TrimSpace(part)
+
+		if part == "" {
+			continue
+		}
+
+		lo, hi, is_range := strings.Cut(part, "-")
+
+		min, err := strconv.Atoi(strings.TrimSpace(lo))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid status code '%s'", part)
+		}
+
+		max := min
+
+		if is_range {
+
+			max, err = strconv.Atoi(strings.TrimSpace(hi))
+
+			if err != nil || max < min {
+				return nil, fmt.Errorf("Invalid status code range '%s'", part)
+			}
+		}
+
+		codes = append(codes, statusRange{min: min, max: max})
+	}
+
+	return codes, nil
+}
+
+// Contains returns true if 'code' is in 'c'. An empty list contains all 2xx codes.
+func (c statusCodes) Contains(code int) bool {
+
+	if len(c) == 0 {
+		return code >= 200 && code < 300
+	}
+
+	for _, r := range c {
+
+		if code >= r.min && code <= r.max {
+			return true
+		}
+	}
+
+	return false
+}
@@ -9,10 +9,10 @@ func TestRegisterDispatcher(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := RegisterDispatcher(ctx, "null", NewNullDispatcher)
+	err := RegisterDispatcher(ctx, "log", NewLogDispatcher)
 
 	if err == nil {
-		t.Fatalf("Expected NewNullDispatcher to be registered already")
+		t.Fatalf("Expected NewLogDispatcher to be registered already")
 	}
 }
 
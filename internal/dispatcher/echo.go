@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/bobertrublik/webhook-router/internal/webhookd"
-	"io"
 	"net/http"
 	"net/url"
 )
@@ -45,27 +44,22 @@ func NewEchoDispatcher(ctx context.Context, uri string) (webhookd.WebhookDispatc
 
 // Dispatch sends 'body' to nowhere.
 func (d *EchoDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
-	responseBody := bytes.NewBuffer(body)
-	// Create a new HTTP request
-	resp, err := http.Post(d.endpoint, "application/json", responseBody)
-	//Handle Error
-	if err != nil {
-		code := 999
-		message := err.Error()
 
-		err := &webhookd.WebhookError{Code: code, Message: message}
-		return err
-	}
-	defer resp.Body.Close()
-	//Read the response body
-	body, err = io.ReadAll(resp.Body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint, bytes.NewReader(body))
+
 	if err != nil {
-		code := 999
-		message := err.Error()
+		return &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
 
-		err := &webhookd.WebhookError{Code: code, Message: message}
-		return err
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sharedClient.Do(req)
+
+	if err != nil {
+		return newTransportError(err)
 	}
 
-	return nil
+	defer resp.Body.Close()
+
+	return checkResponse(resp, nil)
 }
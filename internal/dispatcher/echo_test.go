@@ -0,0 +1,52 @@
+package dispatcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestEchoDispatcherStatus(t *testing.T) {
+
+	ctx := context.Background()
+
+	status := http.StatusOK
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+
+	d, err := NewDispatcher(ctx, "echo://"+u.Host)
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	err2 := d.Dispatch(ctx, []byte("hello world"))
+
+	if err2 != nil {
+		t.Fatalf("Failed to dispatch message, %v", err2)
+	}
+
+	status = http.StatusBadGateway
+
+	err2 = d.Dispatch(ctx, []byte("hello world"))
+
+	if err2 == nil || err2.Code != http.StatusBadGateway {
+		t.Fatalf("Expected 502 error, got %v", err2)
+	}
+
+	srv.Close()
+
+	err2 = d.Dispatch(ctx, []byte("hello world"))
+
+	if err2 == nil || err2.Code != http.StatusBadGateway {
+		t.Fatalf("Expected 502 error for closed server, got %v", err2)
+	}
+}
@@ -0,0 +1,47 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// maxErrorBodySize is the maximum number of bytes of a failed response body included in an error message.
+const maxErrorBodySize int64 = 512
+
+// newTransportError returns a `webhookd.WebhookError` for an error that occurred before a response was received.
+// Timeouts are reported as "504 Gateway Timeout" and all other errors as "502 Bad Gateway".
+func newTransportError(err error) *webhookd.WebhookError {
+
+	code := http.StatusBadGateway
+
+	var timeout interface{ Timeout() bool }
+
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &timeout) && timeout.Timeout()) {
+		code = http.StatusGatewayTimeout
+	}
+
+	return &webhookd.WebhookError{Code: code, Message: err.Error()}
+}
+
+// checkResponse returns a `webhookd.WebhookError` whose code is the response's status code if 'rsp' has a status code
+// that is not in 'success'. The response body is always consumed so that the underlying connection can be reused.
+func checkResponse(rsp *http.Response, success statusCodes) *webhookd.WebhookError {
+
+	if success.Contains(rsp.StatusCode) {
+		io.Copy(io.Discard, rsp.Body)
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(rsp.Body, maxErrorBodySize))
+	io.Copy(io.Discard, rsp.Body)
+
+	return &webhookd.WebhookError{
+		Code:    rsp.StatusCode,
+		Message: fmt.Sprintf("Unexpected response %s: %s", rsp.Status, string(body)),
+	}
+}
@@ -0,0 +1,354 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/secret"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/tidwall/gjson"
+)
+
+func init() {
+
+	ctx := context.Background()
+
+	for _, scheme := range []string{"http", "https"} {
+
+		err := RegisterDispatcher(ctx, scheme, NewHTTPDispatcher)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// DefaultHTTPTimeout is the default time allowed for an `HTTPDispatcher` request, including reading the response.
+const DefaultHTTPTimeout time.Duration = 30 * time.Second
+
+// type httpHeader is a struct containing a header to add to every request. If `tmpl` is not nil the header's value
+// is rendered for each message.
+type httpHeader struct {
+	name  string
+	value string
+	tmpl  *template.Template
+}
+
+// type headerTemplateData is the data passed to templated header values.
+type headerTemplateData struct {
+	body []byte
+}
+
+// Get returns the string value of the gjson 'path' in the message body.
+func (d headerTemplateData) Get(path string) string {
+	return gjson.GetBytes(d.body, path).String()
+}
+
+// Body returns the message body as a string.
+func (d headerTemplateData) Body() string {
+	return string(d.body)
+}
+
+// HTTPDispatcher implements the `webhookd.WebhookDispatcher` interface for relaying messages to arbitrary HTTP(S) endpoints.
+type HTTPDispatcher struct {
+	webhookd.WebhookDispatcher
+	// endpoint is the URL that messages are sent to.
+	endpoint string
+	// method is the HTTP method used to send messages.
+	method string
+	// headers is the list of headers added to every request.
+	headers []*httpHeader
+	// client is the `http.Client` instance used to send messages.
+	client *http.Client
+	// timeout is the time allowed for each request.
+	timeout time.Duration
+	// success is the list of status codes considered a successful response.
+	success statusCodes
+	// bearer is the static token sent in the "Authorization" header, if any.
+	bearer string
+	// username is the username for HTTP basic authentication, if any.
+	username string
+	// password is the password for HTTP basic authentication, if any.
+	password string
+	// oauth2 is the OAuth2 client credentials token source, if any.
+	oauth2 *clientCredentials
+}
+
+// NewHTTPDispatcher returns a new `HTTPDispatcher` instance configured by 'uri' in the form of:
+//
+//	http(s)://{HOST}/{PATH}?{QUERY}#{OPTIONS}
+//
+// Messages are sent to the URI, minus its fragment. Options are encoded as query parameters in the URI's fragment
+// (or defined in the `options` block of the dispatcher's config) and may be:
+//
+//   - method: The HTTP method. Default is POST.
+//   - content_type: The value of the "Content-Type" header. Default is "application/json".
+//   - header: Zero or more "Name: Value" headers. Values may contain Go template expressions, for example
+//     `{{ .Get "data.essentials.alertId" }}`, which are rendered against each message.
+//   - auth: One of "none" (default), "bearer", "basic" or "oauth2".
+//   - token_env, token_file: Where to read the token for "bearer" auth.
+//   - username, password_env, password_file: The credentials for "basic" auth.
+//   - token_url, client_id, client_secret_env, client_secret_file, scope, audience: The client credentials for "oauth2" auth.
+//   - ca_file, cert_file, key_file, insecure_skip_verify: Custom TLS settings.
+//   - timeout: The time allowed for each request. Default is 30s.
+//   - success_codes: A comma-separated list of status codes, or ranges, considered successful. Default is "200-299".
+func NewHTTPDispatcher(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	opts, err := url.ParseQuery(u.EscapedFragment())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse options, %w", err)
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("Missing host")
+	}
+
+	d := HTTPDispatcher{
+		endpoint: u.String(),
+		method:   http.MethodPost,
+		timeout:  DefaultHTTPTimeout,
+	}
+
+	if opts.Has("method") {
+		d.method = strings.ToUpper(opts.Get("method"))
+	}
+
+	content_type := "application/json"
+
+	if opts.Has("content_type") {
+		content_type = opts.Get("content_type")
+	}
+
+	d.headers = append(d.headers, &httpHeader{name: "Content-Type", value: content_type})
+
+	funcs := template.FuncMap{
+		"env": os.Getenv,
+	}
+
+	for _, h := range opts["header"] {
+
+		name, value, ok := strings.Cut(h, ":")
+
+		if !ok {
+			return nil, fmt.Errorf("Invalid header '%s', expected 'Name: Value'", h)
+		}
+
+		hdr := &httpHeader{
+			name:  strings.TrimSpace(name),
+			value: strings.TrimSpace(value),
+		}
+
+		if strings.Contains(hdr.value, "{{") {
+
+			t, err := template.New(hdr.name).Funcs(funcs).Option("missingkey=zero").Parse(hdr.value)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse template for header '%s', %w", hdr.name, err)
+			}
+
+			hdr.tmpl = t
+		}
+
+		d.headers = append(d.headers, hdr)
+	}
+
+	if opts.Has("timeout") {
+
+		t, err := time.ParseDuration(opts.Get("timeout"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timeout, %w", err)
+		}
+
+		d.timeout = t
+	}
+
+	if opts.Has("success_codes") {
+
+		codes, err := parseStatusCodes(opts.Get("success_codes"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid success_codes, %w", err)
+		}
+
+		d.success = codes
+	}
+
+	tls_opts := tlsOptions{
+		CAFile:   opts.Get("ca_file"),
+		CertFile: opts.Get("cert_file"),
+		KeyFile:  opts.Get("key_file"),
+	}
+
+	if opts.Has("insecure_skip_verify") {
+
+		skip, err := strconv.ParseBool(opts.Get("insecure_skip_verify"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid insecure_skip_verify, %w", err)
+		}
+
+		tls_opts.InsecureSkipVerify = skip
+	}
+
+	client, err := newClient(tls_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create HTTP client, %w", err)
+	}
+
+	d.client = client
+
+	switch opts.Get("auth") {
+	case "", "none":
+		// pass
+	case "bearer":
+
+		token, err := secret.Read(opts.Get("token_env"), opts.Get("token_file"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read bearer token, %w", err)
+		}
+
+		d.bearer = token
+
+	case "basic":
+
+		if opts.Get("username") == "" {
+			return nil, fmt.Errorf("Missing username for basic auth")
+		}
+
+		password, err := secret.Read(opts.Get("password_env"), opts.Get("password_file"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read basic auth password, %w", err)
+		}
+
+		d.username = opts.Get("username")
+		d.password = password
+
+	case "oauth2":
+
+		if opts.Get("token_url") == "" || opts.Get("client_id") == "" {
+			return nil, fmt.Errorf("Missing token_url or client_id for oauth2 auth")
+		}
+
+		client_secret, err := secret.Read(opts.Get("client_secret_env"), opts.Get("client_secret_file"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read oauth2 client secret, %w", err)
+		}
+
+		d.oauth2 = &clientCredentials{
+			tokenURL:     opts.Get("token_url"),
+			clientID:     opts.Get("client_id"),
+			clientSecret: client_secret,
+			scopes:       opts["scope"],
+			audience:     opts.Get("audience"),
+			client:       client,
+			timeout:      d.timeout,
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid auth '%s'", opts.Get("auth"))
+	}
+
+	return &d, nil
+}
+
+// Close closes the idle connections of the dispatcher's HTTP client, if it has its own client for custom TLS settings.
+// The client shared by other dispatchers is left alone.
+func (d *HTTPDispatcher) Close() error {
+
+	if d.client != sharedClient {
+		d.client.CloseIdleConnections()
+	}
+
+	return nil
+}
+
+// Dispatch sends 'body' to the dispatcher's endpoint.
+func (d *HTTPDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, d.method, d.endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	data := headerTemplateData{body: body}
+
+	for _, h := range d.headers {
+
+		value := h.value
+
+		if h.tmpl != nil {
+
+			var buf bytes.Buffer
+
+			err := h.tmpl.Execute(&buf, data)
+
+			if err != nil {
+				return &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to render header '%s', %v", h.name, err)}
+			}
+
+			value = buf.String()
+		}
+
+		req.Header.Set(h.name, value)
+	}
+
+	switch {
+	case d.bearer != "":
+		req.Header.Set("Authorization", "Bearer "+d.bearer)
+	case d.username != "":
+		req.SetBasicAuth(d.username, d.password)
+	case d.oauth2 != nil:
+
+		token, err := d.oauth2.Token(ctx)
+
+		if err != nil {
+			return &webhookd.WebhookError{Code: err.Code, Message: fmt.Sprintf("Failed to get oauth2 token, %s", err.Message)}
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rsp, err := d.client.Do(req)
+
+	if err != nil {
+		return newTransportError(err)
+	}
+
+	defer rsp.Body.Close()
+
+	// The token may have been revoked before it expired so make sure a new one is
+	// fetched for the next attempt.
+
+	if rsp.StatusCode == http.StatusUnauthorized && d.oauth2 != nil {
+		d.oauth2.Invalidate()
+	}
+
+	return checkResponse(rsp, d.success)
+}
@@ -0,0 +1,487 @@
+package dispatcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func TestHTTPDispatcher(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_TOKEN", "s33kret")
+
+	var got *http.Request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	defer srv.Close()
+
+	cfg := config.WebhookDispatcherConfig{
+		URI: srv.URL + "/hooks?source=webhookd",
+		Options: config.WebhookOptions{
+			"method": []string{"put"},
+			"header": []string{
+				"X-Static: hello",
+				`X-Alert-ID: {{ .Get "data.id" }}`,
+			},
+			"auth":      []string{"bearer"},
+			"token_env": []string{"WEBHOOKD_TEST_TOKEN"},
+		},
+	}
+
+	uri, err := cfg.URIWithOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to derive URI, %v", err)
+	}
+
+	d, err := NewDispatcher(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	err2 := d.Dispatch(ctx, []byte(`{"data":{"id":"abc-123"}}`))
+
+	if err2 != nil {
+		t.Fatalf("Failed to dispatch message, %v", err2)
+	}
+
+	if got.Method != http.MethodPut {
+		t.Fatalf("Unexpected method %s", got.Method)
+	}
+
+	if got.URL.Path != "/hooks" || got.URL.Query().Get("source") != "webhookd" {
+		t.Fatalf("Unexpected URL %s", got.URL)
+	}
+
+	expected := map[string]string{
+		"Content-Type":  "application/json",
+		"X-Static":      "hello",
+		"X-Alert-Id":    "abc-123",
+		"Authorization": "Bearer s33kret",
+	}
+
+	for k, v := range expected {
+
+		if got.Header.Get(k) != v {
+			t.Fatalf("Unexpected value for header %s: '%s'", k, got.Header.Get(k))
+		}
+	}
+}
+
+func TestHTTPDispatcherRequestID(t *testing.T) {
+
+	var got *http.Request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+
+	defer srv.Close()
+
+	ctx := webhookd.NewRequestIDContext(context.Background(), "abc123")
+
+	d, err := NewDispatcher(ctx, srv.URL)
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	err2 := d.Dispatch(ctx, []byte("hello world"))
+
+	if err2 != nil {
+		t.Fatalf("Failed to dispatch message, %v", err2)
+	}
+
+	if got.Header.Get(webhookd.RequestIDHeader) != "abc123" {
+		t.Fatalf("Expected request ID to be forwarded, got '%s'", got.Header.Get(webhookd.RequestIDHeader))
+	}
+
+	// An explicitly configured header takes precedence
+
+	d2, err := NewDispatcher(ctx, srv.URL+"#header=X-Request-ID:+static")
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	err2 = d2.Dispatch(ctx, []byte("hello world"))
+
+	if err2 != nil {
+		t.Fatalf("Failed to dispatch message, %v", err2)
+	}
+
+	if got.Header.Get(webhookd.RequestIDHeader) != "static" {
+		t.Fatalf("Expected configured header to be kept, got '%s'", got.Header.Get(webhookd.RequestIDHeader))
+	}
+}
+
+func TestHTTPDispatcherBasicAuth(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_PASSWORD", "hunter2")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		user, pass, ok := r.BasicAuth()
+
+		if !ok || user != "bob" || pass != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}))
+
+	defer srv.Close()
+
+	d, err := NewDispatcher(ctx, srv.URL+"#auth=basic&username=bob&password_env=WEBHOOKD_TEST_PASSWORD")
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	err2 := d.Dispatch(ctx, []byte("{}"))
+
+	if err2 != nil {
+		t.Fatalf("Failed to dispatch message, %v", err2)
+	}
+}
+
+func TestHTTPDispatcherOAuth2(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_CLIENT_SECRET", "client-s33kret")
+
+	token_requests := 0
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+
+		id, secret, ok := r.BasicAuth()
+
+		if !ok || id != "webhookd" || secret != "client-s33kret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		r.ParseForm()
+
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "alerts.write" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		token_requests += 1
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"t0ken","token_type":"Bearer","expires_in":3600}`))
+	})
+
+	mux.HandleFunc("/hooks", func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	uri := srv.URL + "/hooks#auth=oauth2&client_id=webhookd&client_secret_env=WEBHOOKD_TEST_CLIENT_SECRET&scope=alerts.write&token_url=" + srv.URL + "/token"
+
+	d, err := NewDispatcher(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+
+		err2 := d.Dispatch(ctx, []byte("{}"))
+
+		if err2 != nil {
+			t.Fatalf("Failed to dispatch message, %v", err2)
+		}
+	}
+
+	if token_requests != 1 {
+		t.Fatalf("Expected token to be cached, got %d token requests", token_requests)
+	}
+}
+
+func TestHTTPDispatcherOAuth2Errors(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_CLIENT_SECRET", "client-s33kret")
+
+	mu := new(sync.Mutex)
+	status := http.StatusServiceUnavailable
+	token_requests := 0
+
+	release := make(chan bool)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+
+		mu.Lock()
+		token_requests += 1
+		code := status
+		mu.Unlock()
+
+		if code == http.StatusOK {
+			<-release
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"t0ken","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+
+		w.WriteHeader(code)
+	})
+
+	mux.HandleFunc("/hooks", func(w http.ResponseWriter, r *http.Request) {})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	uri := srv.URL + "/hooks#auth=oauth2&client_id=webhookd&client_secret_env=WEBHOOKD_TEST_CLIENT_SECRET&token_url=" + srv.URL + "/token"
+
+	d, err := NewDispatcher(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	// The token endpoint being unavailable is retryable, rejecting the credentials is not.
+
+	err2 := d.Dispatch(ctx, []byte("{}"))
+
+	if err2 == nil || err2.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 error for unavailable token endpoint, got %v", err2)
+	}
+
+	mu.Lock()
+	status = http.StatusBadRequest
+	mu.Unlock()
+
+	err2 = d.Dispatch(ctx, []byte("{}"))
+
+	if err2 == nil || err2.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 error for rejected credentials, got %v", err2)
+	}
+
+	// Concurrent dispatches share a single token request.
+
+	mu.Lock()
+	status = http.StatusOK
+	token_requests = 0
+	mu.Unlock()
+
+	wg := new(sync.WaitGroup)
+	errs := make(chan *webhookd.WebhookError, 5)
+
+	for i := 0; i < 5; i++ {
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs <- d.Dispatch(ctx, []byte("{}"))
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	wg.Wait()
+	close(errs)
+
+	for err2 := range errs {
+
+		if err2 != nil {
+			t.Fatalf("Failed to dispatch message, %v", err2)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if token_requests != 1 {
+		t.Fatalf("Expected concurrent dispatches to share a token request, got %d token requests", token_requests)
+	}
+}
+
+func TestHTTPDispatcherOAuth2Cancel(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_CLIENT_SECRET", "client-s33kret")
+
+	mu := new(sync.Mutex)
+	token_requests := 0
+
+	requested := make(chan bool, 1)
+	release := make(chan bool)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+
+		mu.Lock()
+		token_requests += 1
+		mu.Unlock()
+
+		requested <- true
+		<-release
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"t0ken","token_type":"Bearer","expires_in":3600}`))
+	})
+
+	mux.HandleFunc("/hooks", func(w http.ResponseWriter, r *http.Request) {})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	uri := srv.URL + "/hooks#auth=oauth2&client_id=webhookd&client_secret_env=WEBHOOKD_TEST_CLIENT_SECRET&token_url=" + srv.URL + "/token"
+
+	d, err := NewDispatcher(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	// Cancelling the dispatch which started the token request fails that dispatch, but not the
+	// others waiting for the same token.
+
+	first_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	first := make(chan *webhookd.WebhookError, 1)
+	second := make(chan *webhookd.WebhookError, 1)
+
+	go func() {
+		first <- d.Dispatch(first_ctx, []byte("{}"))
+	}()
+
+	<-requested
+
+	go func() {
+		second <- d.Dispatch(ctx, []byte("{}"))
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err2 := <-first:
+
+		if err2 == nil || err2.Code != http.StatusBadGateway {
+			t.Fatalf("Expected 502 error for cancelled dispatch, got %v", err2)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for cancelled dispatch")
+	}
+
+	close(release)
+
+	select {
+	case err2 := <-second:
+
+		if err2 != nil {
+			t.Fatalf("Failed to dispatch message, %v", err2)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for dispatch")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if token_requests != 1 {
+		t.Fatalf("Expected dispatches to share a token request, got %d token requests", token_requests)
+	}
+}
+
+func TestHTTPDispatcherSuccessCodes(t *testing.T) {
+
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+
+	defer srv.Close()
+
+	d, err := NewDispatcher(ctx, srv.URL)
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	err2 := d.Dispatch(ctx, []byte("{}"))
+
+	if err2 == nil || err2.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 error, got %v", err2)
+	}
+
+	d, err = NewDispatcher(ctx, srv.URL+"#success_codes=200-299,409")
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	err2 = d.Dispatch(ctx, []byte("{}"))
+
+	if err2 != nil {
+		t.Fatalf("Expected 409 to be treated as success, got %v", err2)
+	}
+}
+
+func TestHTTPDispatcherInvalidOptions(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_PASSWORD", "hunter2")
+
+	uris := []string{
+		"https://example.com#auth=magic",
+		"https://example.com#header=no-colon",
+		"https://example.com#timeout=soon",
+		"https://example.com#success_codes=abc",
+		"https://example.com#auth=oauth2",
+		"https://example.com#auth=basic&password_env=WEBHOOKD_TEST_PASSWORD",
+	}
+
+	for _, uri := range uris {
+
+		_, err := NewDispatcher(ctx, uri)
+
+		if err == nil {
+			t.Fatalf("Expected %s to fail", uri)
+		}
+
+		if strings.Contains(err.Error(), "Invalid scheme") {
+			t.Fatalf("Expected option error for %s, got %v", uri, err)
+		}
+	}
+}
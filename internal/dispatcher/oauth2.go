@@ -0,0 +1,183 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"golang.org/x/sync/singleflight"
+)
+
+// clientCredentials fetches and caches OAuth2 access tokens using the client credentials grant (RFC 6749, section 4.4).
+type clientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	audience     string
+	client       *http.Client
+	// timeout is the time allowed for each request to the token endpoint. Defaults to `DefaultHTTPTimeout`.
+	timeout time.Duration
+	// fetch ensures that concurrent dispatches waiting for a new token share a single request to the token endpoint.
+	fetch singleflight.Group
+	// mu guards `token` and `expiry`. It is not held while a token is being fetched.
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Token returns a cached access token or, if there is none or it is about to expire, fetches a new one. Failing to
+// fetch a token is reported as "401 Unauthorized" if the token endpoint rejected the request, and otherwise as a
+// retryable error ("502 Bad Gateway", "503 Service Unavailable" or "504 Gateway Timeout"). If 'ctx' is cancelled
+// while a token is being fetched the error is returned straight away, but the request continues for other callers.
+func (c *clientCredentials) Token(ctx context.Context) (string, *webhookd.WebhookError) {
+
+	c.mu.Lock()
+	token := c.token
+	expiry := c.expiry
+	c.mu.Unlock()
+
+	if token != "" && time.Now().Before(expiry) {
+		return token, nil
+	}
+
+	// The token is fetched on behalf of every caller waiting for it, so it must not be cancelled
+	// along with the context of whichever caller happened to start the request.
+
+	ch := c.fetch.DoChan("token", func() (interface{}, error) {
+
+		timeout := c.timeout
+
+		if timeout <= 0 {
+			timeout = DefaultHTTPTimeout
+		}
+
+		fetch_ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+
+		token, expires_in, err := c.fetchToken(fetch_ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.token = token
+		c.expiry = time.Now().Add(expires_in)
+		c.mu.Unlock()
+
+		return token, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		token_err := newTransportError(ctx.Err())
+		token_err.Message = fmt.Sprintf("Failed to request token, %s", token_err.Message)
+		return "", token_err
+	case res := <-ch:
+
+		if res.Err != nil {
+			return "", res.Err.(*webhookd.WebhookError)
+		}
+
+		return res.Val.(string), nil
+	}
+}
+
+// fetchToken requests a new access token from the token endpoint, returning the token and how long it should be used for.
+func (c *clientCredentials) fetchToken(ctx context.Context) (string, time.Duration, error) {
+
+	params := url.Values{}
+	params.Set("grant_type", "client_credentials")
+
+	if len(c.scopes) > 0 {
+		params.Set("scope", strings.Join(c.scopes, " "))
+	}
+
+	if c.audience != "" {
+		params.Set("audience", c.audience)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(params.Encode()))
+
+	if err != nil {
+		return "", 0, &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to create token request, %v", err)}
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	rsp, err := c.client.Do(req)
+
+	if err != nil {
+		token_err := newTransportError(err)
+		token_err.Message = fmt.Sprintf("Failed to request token, %s", token_err.Message)
+		return "", 0, token_err
+	}
+
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(rsp.Body, 1<<20))
+
+	if err != nil {
+		return "", 0, &webhookd.WebhookError{Code: http.StatusBadGateway, Message: fmt.Sprintf("Failed to read token response, %v", err)}
+	}
+
+	// Only a rejected request means the credentials are wrong; the token endpoint being
+	// unavailable or rate limiting requests is worth retrying.
+
+	switch {
+	case rsp.StatusCode == http.StatusOK:
+		// pass
+	case rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= 500:
+		return "", 0, &webhookd.WebhookError{Code: http.StatusServiceUnavailable, Message: fmt.Sprintf("Token endpoint returned %s", rsp.Status)}
+	case rsp.StatusCode >= 400:
+		return "", 0, &webhookd.WebhookError{Code: http.StatusUnauthorized, Message: fmt.Sprintf("Token endpoint returned %s", rsp.Status)}
+	default:
+		return "", 0, &webhookd.WebhookError{Code: http.StatusBadGateway, Message: fmt.Sprintf("Token endpoint returned %s", rsp.Status)}
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	err = json.Unmarshal(body, &tok)
+
+	if err != nil {
+		return "", 0, &webhookd.WebhookError{Code: http.StatusBadGateway, Message: fmt.Sprintf("Failed to decode token response, %v", err)}
+	}
+
+	if tok.AccessToken == "" {
+		return "", 0, &webhookd.WebhookError{Code: http.StatusBadGateway, Message: "Token response is missing access_token"}
+	}
+
+	expires_in := time.Duration(tok.ExpiresIn) * time.Second
+
+	if expires_in <= 0 {
+		expires_in = time.Hour
+	}
+
+	// Refresh a little early so that a token does not expire in flight.
+	expires_in -= expires_in / 10
+
+	return tok.AccessToken, expires_in, nil
+}
+
+// Invalidate discards the cached access token so the next call to `Token` fetches a new one.
+func (c *clientCredentials) Invalidate() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = ""
+}
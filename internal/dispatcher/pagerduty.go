@@ -0,0 +1,406 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/secret"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/tidwall/gjson"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterDispatcher(ctx, "pagerduty", NewPagerDutyDispatcher)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// DefaultPagerDutyEndpoint is the URL of the PagerDuty Events API v2.
+const DefaultPagerDutyEndpoint string = "https://events.pagerduty.com/v2/enqueue"
+
+// The event actions of the PagerDuty Events API v2.
+const (
+	PagerDutyTrigger     string = "trigger"
+	PagerDutyAcknowledge string = "acknowledge"
+	PagerDutyResolve     string = "resolve"
+)
+
+// DefaultPagerDutySeverityMap maps the severities of Azure Monitor alerts to PagerDuty severities.
+var DefaultPagerDutySeverityMap = map[string]string{
+	"sev0": "critical",
+	"sev1": "error",
+	"sev2": "warning",
+	"sev3": "info",
+	"sev4": "info",
+}
+
+// pagerDutySeverities is the set of severities accepted by the PagerDuty Events API v2.
+var pagerDutySeverities = map[string]bool{
+	"critical": true,
+	"error":    true,
+	"warning":  true,
+	"info":     true,
+}
+
+// The limits of the PagerDuty Events API v2 on the length of a summary and a dedup key.
+const (
+	maxPagerDutySummary  int = 1024
+	maxPagerDutyDedupKey int = 255
+)
+
+// type pagerDutyEvent is a struct containing an event sent to the PagerDuty Events API v2.
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key,omitempty"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+// type pagerDutyPayload is a struct containing the details of a "trigger" event.
+type pagerDutyPayload struct {
+	Summary       string          `json:"summary"`
+	Source        string          `json:"source"`
+	Severity      string          `json:"severity"`
+	Component     string          `json:"component,omitempty"`
+	Group         string          `json:"group,omitempty"`
+	Class         string          `json:"class,omitempty"`
+	CustomDetails json.RawMessage `json:"custom_details,omitempty"`
+}
+
+// PagerDutyDispatcher implements the `webhookd.WebhookDispatcher` interface for triggering, acknowledging and
+// resolving PagerDuty incidents using the Events API v2.
+type PagerDutyDispatcher struct {
+	webhookd.WebhookDispatcher
+	// endpoint is the URL that events are sent to.
+	endpoint string
+	// routingKey is the integration key of the PagerDuty service events are sent to.
+	routingKey string
+	// paths is the map of event fields to the gjson paths their values are read from.
+	paths map[string]string
+	// defaultSource is the source used when the source path is not defined or has no value.
+	defaultSource string
+	// defaultSeverity is the severity used when the severity path is not defined or its value can not be mapped.
+	defaultSeverity string
+	// severities maps lower-cased values of the severity path to PagerDuty severities.
+	severities map[string]string
+	// actions maps lower-cased values of the action path to event actions other than "trigger".
+	actions map[string]string
+	// timeout is the time allowed for each request.
+	timeout time.Duration
+}
+
+// NewPagerDutyDispatcher returns a new `PagerDutyDispatcher` instance configured by 'uri' in the form of:
+//
+//	pagerduty://#{OPTIONS}
+//
+// Options are encoded as query parameters in the URI's fragment (or defined in the `options` block of the dispatcher's
+// config) and may be:
+//
+//   - routing_key_env, routing_key_file: Where to read the integration key of the PagerDuty service. Required.
+//   - summary, source, severity, component, group, class, dedup_key: The gjson paths the values of each event field
+//     are read from. Only summary is required.
+//   - action: The gjson path of the value that decides whether an event triggers, acknowledges or resolves an incident.
+//   - resolve_values, acknowledge_values: Comma-separated lists of action values, compared case-insensitively, that
+//     resolve or acknowledge an incident. Defaults are "Resolved" and "Acknowledged". Any other value triggers one.
+//   - severity_map: A comma-separated list of "value:severity" pairs. Default maps Azure's "Sev0" - "Sev4".
+//   - default_severity: The severity used if a value can not be mapped. Default is "error".
+//   - default_source: The source used if the source path has no value. Default is "webhookd".
+//   - endpoint: The URL of the Events API. Default is "https://events.pagerduty.com/v2/enqueue".
+//   - timeout: The time allowed for each request. Default is 30s.
+func NewPagerDutyDispatcher(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	opts, err := url.ParseQuery(u.EscapedFragment())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse options, %w", err)
+	}
+
+	routing_key, err := secret.Read(opts.Get("routing_key_env"), opts.Get("routing_key_file"))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read routing key, %w", err)
+	}
+
+	d := PagerDutyDispatcher{
+		endpoint:        DefaultPagerDutyEndpoint,
+		routingKey:      routing_key,
+		paths:           make(map[string]string),
+		defaultSource:   "webhookd",
+		defaultSeverity: "error",
+		severities:      make(map[string]string),
+		actions:         make(map[string]string),
+		timeout:         DefaultHTTPTimeout,
+	}
+
+	for _, k := range []string{"summary", "source", "severity", "component", "group", "class", "dedup_key", "action"} {
+
+		if opts.Get(k) != "" {
+			d.paths[k] = opts.Get(k)
+		}
+	}
+
+	if d.paths["summary"] == "" {
+		return nil, fmt.Errorf("Missing summary path")
+	}
+
+	if opts.Has("endpoint") {
+
+		endpoint_u, err := url.Parse(opts.Get("endpoint"))
+
+		if err != nil || (endpoint_u.Scheme != "https" && endpoint_u.Scheme != "http") || endpoint_u.Host == "" {
+			return nil, fmt.Errorf("Invalid endpoint '%s'", opts.Get("endpoint"))
+		}
+
+		d.endpoint = endpoint_u.String()
+	}
+
+	if opts.Has("default_source") {
+		d.defaultSource = opts.Get("default_source")
+	}
+
+	if opts.Has("default_severity") {
+
+		severity := strings.ToLower(opts.Get("default_severity"))
+
+		if !pagerDutySeverities[severity] {
+			return nil, fmt.Errorf("Invalid default_severity '%s'", opts.Get("default_severity"))
+		}
+
+		d.defaultSeverity = severity
+	}
+
+	if opts.Has("severity_map") {
+
+		for _, pair := range strings.Split(opts.Get("severity_map"), ",") {
+
+			value, severity, ok := strings.Cut(pair, ":")
+			severity = strings.ToLower(strings.TrimSpace(severity))
+
+			if !ok || !pagerDutySeverities[severity] {
+				return nil, fmt.Errorf("Invalid severity_map entry '%s', expected 'value:severity'", pair)
+			}
+
+			d.severities[strings.ToLower(strings.TrimSpace(value))] = severity
+		}
+
+	} else {
+
+		for k, v := range DefaultPagerDutySeverityMap {
+			d.severities[k] = v
+		}
+	}
+
+	resolve_values := "Resolved"
+	acknowledge_values := "Acknowledged"
+
+	if opts.Has("resolve_values") {
+		resolve_values = opts.Get("resolve_values")
+	}
+
+	if opts.Has("acknowledge_values") {
+		acknowledge_values = opts.Get("acknowledge_values")
+	}
+
+	for action, values := range map[string]string{PagerDutyResolve: resolve_values, PagerDutyAcknowledge: acknowledge_values} {
+
+		for _, v := range strings.Split(values, ",") {
+
+			v = strings.ToLower(strings.TrimSpace(v))
+
+			if v != "" {
+				d.actions[v] = action
+			}
+		}
+	}
+
+	if opts.Has("timeout") {
+
+		t, err := time.ParseDuration(opts.Get("timeout"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timeout, %w", err)
+		}
+
+		d.timeout = t
+	}
+
+	return &d, nil
+}
+
+// Dispatch sends a PagerDuty event derived from 'body' to the Events API.
+func (d *PagerDutyDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	enc, err2 := d.payload(body, d.routingKey)
+
+	if err2 != nil {
+		return err2
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint, bytes.NewReader(enc))
+
+	if err != nil {
+		return &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := sharedClient.Do(req)
+
+	if err != nil {
+		return newTransportError(err)
+	}
+
+	defer rsp.Body.Close()
+
+	return checkResponse(rsp, nil)
+}
+
+// Preview returns the JSON encoded PagerDuty event that would be sent for 'msg', with its routing key redacted.
+func (d *PagerDutyDispatcher) Preview(ctx context.Context, msg *webhookd.Message) ([]byte, *webhookd.WebhookError) {
+	return d.payload(msg.Body, config.Redacted)
+}
+
+// payload returns the JSON encoded `pagerDutyEvent` for 'body', sent with 'routing_key'.
+func (d *PagerDutyDispatcher) payload(body []byte, routing_key string) ([]byte, *webhookd.WebhookError) {
+
+	ev, err := d.event(body)
+
+	if err != nil {
+		return nil, &webhookd.WebhookError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Failed to create PagerDuty event, %v", err)}
+	}
+
+	ev.RoutingKey = routing_key
+
+	enc, err := json.Marshal(ev)
+
+	if err != nil {
+		return nil, &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return enc, nil
+}
+
+// event returns the `pagerDutyEvent` for 'body'.
+func (d *PagerDutyDispatcher) event(body []byte) (*pagerDutyEvent, error) {
+
+	action := PagerDutyTrigger
+
+	if d.paths["action"] != "" {
+
+		v := strings.ToLower(d.get(body, "action"))
+
+		if a, ok := d.actions[v]; ok {
+			action = a
+		}
+	}
+
+	ev := &pagerDutyEvent{
+		EventAction: action,
+		DedupKey:    truncate(d.get(body, "dedup_key"), maxPagerDutyDedupKey),
+	}
+
+	// Incidents are closed by sending the dedup key of the event that opened them
+	// so there is nothing to acknowledge or resolve without one.
+
+	if action != PagerDutyTrigger {
+
+		if ev.DedupKey == "" {
+			return nil, fmt.Errorf("Missing dedup key for %s event", action)
+		}
+
+		return ev, nil
+	}
+
+	summary := d.get(body, "summary")
+
+	if summary == "" {
+		return nil, fmt.Errorf("Missing summary")
+	}
+
+	source := d.get(body, "source")
+
+	if source == "" {
+		source = d.defaultSource
+	}
+
+	p := &pagerDutyPayload{
+		Summary:   truncate(summary, maxPagerDutySummary),
+		Source:    source,
+		Severity:  d.severity(d.get(body, "severity")),
+		Component: d.get(body, "component"),
+		Group:     d.get(body, "group"),
+		Class:     d.get(body, "class"),
+	}
+
+	if gjson.ValidBytes(body) && gjson.ParseBytes(body).IsObject() {
+		p.CustomDetails = json.RawMessage(body)
+	}
+
+	ev.Payload = p
+	return ev, nil
+}
+
+// get returns the string value of the gjson path configured for 'field' in 'body', or an empty string if there is none.
+func (d *PagerDutyDispatcher) get(body []byte, field string) string {
+
+	path := d.paths[field]
+
+	if path == "" {
+		return ""
+	}
+
+	return gjson.GetBytes(body, path).String()
+}
+
+// severity returns the PagerDuty severity for 'value'.
+func (d *PagerDutyDispatcher) severity(value string) string {
+
+	value = strings.ToLower(value)
+
+	if s, ok := d.severities[value]; ok {
+		return s
+	}
+
+	if pagerDutySeverities[value] {
+		return value
+	}
+
+	return d.defaultSeverity
+}
+
+// truncate returns 'str' shortened to at most 'max' bytes without splitting a multi-byte character.
+func truncate(str string, max int) string {
+
+	if len(str) <= max {
+		return str
+	}
+
+	str = str[:max]
+
+	for len(str) > 0 && !utf8.ValidString(str) {
+		str = str[:len(str)-1]
+	}
+
+	return str
+}
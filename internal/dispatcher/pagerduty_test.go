@@ -0,0 +1,171 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func TestPagerDutyDispatcher(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_PAGERDUTY", "r0ut1ng")
+
+	events := make([]map[string]interface{}, 0)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var ev map[string]interface{}
+
+		body, _ := io.ReadAll(r.Body)
+
+		err := json.Unmarshal(body, &ev)
+
+		if err != nil || ev["routing_key"] != "r0ut1ng" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		events = append(events, ev)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	defer srv.Close()
+
+	cfg := config.WebhookDispatcherConfig{
+		URI: "pagerduty://",
+		Options: config.WebhookOptions{
+			"routing_key_env": []string{"WEBHOOKD_TEST_PAGERDUTY"},
+			"endpoint":        []string{srv.URL + "/v2/enqueue"},
+			"summary":         []string{"data.essentials.alertRule"},
+			"severity":        []string{"data.essentials.severity"},
+			"source":          []string{"data.essentials.configurationItems.0"},
+			"component":       []string{"data.essentials.monitoringService"},
+			"dedup_key":       []string{"data.essentials.alertId"},
+			"action":          []string{"data.essentials.monitorCondition"},
+		},
+	}
+
+	uri, err := cfg.URIWithOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to derive URI, %v", err)
+	}
+
+	d, err := NewDispatcher(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	fired := `{"data":{"essentials":{"alertId":"/subscriptions/123/alerts/abc","alertRule":"High CPU","severity":"Sev1","monitorCondition":"Fired","monitoringService":"Platform","configurationItems":["vm-01"]}}}`
+	resolved := `{"data":{"essentials":{"alertId":"/subscriptions/123/alerts/abc","alertRule":"High CPU","severity":"Sev1","monitorCondition":"Resolved","monitoringService":"Platform","configurationItems":["vm-01"]}}}`
+
+	for _, body := range []string{fired, resolved} {
+
+		err2 := d.Dispatch(ctx, []byte(body))
+
+		if err2 != nil {
+			t.Fatalf("Failed to dispatch message, %v", err2)
+		}
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	trigger := events[0]
+	resolve := events[1]
+
+	if trigger["event_action"] != PagerDutyTrigger || resolve["event_action"] != PagerDutyResolve {
+		t.Fatalf("Unexpected event actions '%v' and '%v'", trigger["event_action"], resolve["event_action"])
+	}
+
+	if trigger["dedup_key"] != "/subscriptions/123/alerts/abc" || resolve["dedup_key"] != trigger["dedup_key"] {
+		t.Fatalf("Unexpected dedup keys '%v' and '%v'", trigger["dedup_key"], resolve["dedup_key"])
+	}
+
+	payload, ok := trigger["payload"].(map[string]interface{})
+
+	if !ok {
+		t.Fatalf("Missing payload for trigger event")
+	}
+
+	expected := map[string]string{
+		"summary":   "High CPU",
+		"severity":  "error",
+		"source":    "vm-01",
+		"component": "Platform",
+	}
+
+	for k, v := range expected {
+
+		if payload[k] != v {
+			t.Fatalf("Unexpected value for %s: '%v'", k, payload[k])
+		}
+	}
+
+	if _, ok := payload["custom_details"].(map[string]interface{}); !ok {
+		t.Fatalf("Expected message to be included as custom details")
+	}
+
+	if _, ok := resolve["payload"]; ok {
+		t.Fatalf("Unexpected payload for resolve event")
+	}
+
+	err2 := d.Dispatch(ctx, []byte(`{"data":{"essentials":{"alertRule":"High CPU","monitorCondition":"Resolved"}}}`))
+
+	if err2 == nil || err2.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 error for resolve event without a dedup key, got %v", err2)
+	}
+
+	// A preview is the event that would be sent, without the routing key.
+
+	preview, err2 := webhookd.PreviewMessage(ctx, d, webhookd.NewMessage([]byte(fired)))
+
+	if err2 != nil {
+		t.Fatalf("Failed to preview message, %v", err2)
+	}
+
+	var ev map[string]interface{}
+
+	err = json.Unmarshal(preview, &ev)
+
+	if err != nil || ev["event_action"] != PagerDutyTrigger || ev["routing_key"] != config.Redacted {
+		t.Fatalf("Unexpected preview, %s", preview)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected preview not to send an event")
+	}
+}
+
+func TestNewPagerDutyDispatcherErrors(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_PAGERDUTY", "r0ut1ng")
+
+	for _, opts := range []string{
+		"summary=title",
+		"routing_key_env=WEBHOOKD_TEST_PAGERDUTY",
+		"routing_key_env=WEBHOOKD_TEST_PAGERDUTY&summary=title&default_severity=urgent",
+		"routing_key_env=WEBHOOKD_TEST_PAGERDUTY&summary=title&severity_map=" + url.QueryEscape("P1:high"),
+		"routing_key_env=WEBHOOKD_TEST_PAGERDUTY&summary=title&endpoint=events.pagerduty.com",
+	} {
+
+		_, err := NewDispatcher(ctx, "pagerduty://#"+opts)
+
+		if err == nil {
+			t.Fatalf("Expected options '%s' to fail", opts)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// DefaultRetryStatusCodes is the list of error codes considered retryable if none are configured.
+var DefaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooEarly,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// type RetryPolicy is a struct defining how failed dispatches are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a message will be dispatched, including the first attempt.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for each subsequent retry.
+	BaseDelay time.Duration
+	// MaxDelay is the upper bound for the delay between retries.
+	MaxDelay time.Duration
+	// Jitter is the fraction (0.0 - 1.0) of each delay that is randomized.
+	Jitter float64
+	// StatusCodes is the set of error codes that are considered retryable.
+	StatusCodes map[int]bool
+}
+
+// NewRetryPolicyFromConfig returns a new `RetryPolicy` derived from 'cfg', applying defaults for any missing values.
+func NewRetryPolicyFromConfig(cfg *config.WebhookRetryConfig) (*RetryPolicy, error) {
+
+	p := &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		Jitter:      cfg.Jitter,
+		StatusCodes: make(map[int]bool),
+	}
+
+	if cfg.MaxAttempts != 0 {
+		p.MaxAttempts = cfg.MaxAttempts
+	}
+
+	if p.MaxAttempts < 1 {
+		return nil, fmt.Errorf("Invalid max_attempts %d, must be at least 1", p.MaxAttempts)
+	}
+
+	if cfg.BaseDelay != "" {
+
+		d, err := time.ParseDuration(cfg.BaseDelay)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid base_delay, %w", err)
+		}
+
+		p.BaseDelay = d
+	}
+
+	if cfg.MaxDelay != "" {
+
+		d, err := time.ParseDuration(cfg.MaxDelay)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid max_delay, %w", err)
+		}
+
+		p.MaxDelay = d
+	}
+
+	if p.BaseDelay < 0 || p.MaxDelay < p.BaseDelay {
+		return nil, fmt.Errorf("Invalid delays, max_delay must be greater than or equal to base_delay")
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return nil, fmt.Errorf("Invalid jitter %f, must be between 0 and 1", p.Jitter)
+	}
+
+	codes := cfg.StatusCodes
+
+	if len(codes) == 0 {
+		codes = DefaultRetryStatusCodes
+	}
+
+	for _, c := range codes {
+		p.StatusCodes[c] = true
+	}
+
+	return p, nil
+}
+
+// Retryable returns a boolean value indicating whether 'err' should be retried.
+func (p *RetryPolicy) Retryable(err *webhookd.WebhookError) bool {
+	return p.StatusCodes[err.Code]
+}
+
+// Delay returns the time to wait before making attempt number 'attempt' (where the first retry is attempt 2).
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+
+	d := p.BaseDelay
+
+	for i := 2; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && d > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+
+	return d
+}
+
+// RetryDispatcher implements the `webhookd.WebhookDispatcher` interface for retrying another `webhookd.WebhookDispatcher`
+// instance, with exponential backoff, until it succeeds or a `RetryPolicy` is exhausted.
+type RetryDispatcher struct {
+	webhookd.WebhookDispatcher
+	// name is the label of the dispatcher being retried, used for logging.
+	name string
+	// dispatcher is the `webhookd.WebhookDispatcher` instance being retried.
+	dispatcher webhookd.WebhookDispatcher
+	// policy is the `RetryPolicy` used to decide whether and when to retry.
+	policy *RetryPolicy
+}
+
+// NewRetryDispatcher returns a new `RetryDispatcher` instance that retries 'd', labeled 'name', according to 'policy'.
+func NewRetryDispatcher(name string, d webhookd.WebhookDispatcher, policy *RetryPolicy) webhookd.WebhookDispatcher {
+
+	r := RetryDispatcher{
+		name:       name,
+		dispatcher: d,
+		policy:     policy,
+	}
+
+	return &r
+}
+
+// Close closes the underlying dispatcher.
+func (r *RetryDispatcher) Close() error {
+	return webhookd.CloseDispatcher(r.dispatcher)
+}
+
+// Preview returns the payload the underlying dispatcher would send for 'msg'.
+func (r *RetryDispatcher) Preview(ctx context.Context, msg *webhookd.Message) ([]byte, *webhookd.WebhookError) {
+	return webhookd.PreviewMessage(ctx, r.dispatcher, msg)
+}
+
+// Dispatch relays 'body' using the underlying dispatcher, retrying retryable errors until the retry policy is exhausted
+// or 'ctx' is cancelled.
+func (r *RetryDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+	return r.DispatchMessage(ctx, webhookd.NewMessage(body))
+}
+
+// DispatchMessage relays 'msg' using the underlying dispatcher, retrying retryable errors until the retry policy is
+// exhausted or 'ctx' is cancelled.
+func (r *RetryDispatcher) DispatchMessage(ctx context.Context, msg *webhookd.Message) *webhookd.WebhookError {
+
+	log := logger.FromContext(ctx)
+
+	var err *webhookd.WebhookError
+
+	for attempt := 1; attempt <= r.policy.MaxAttempts; attempt++ {
+
+		if attempt > 1 {
+
+			delay := r.policy.Delay(attempt)
+
+			log.Warn("Retrying dispatch", "dispatcher", r.name, "attempt", attempt, "max_attempts", r.policy.MaxAttempts, "delay", delay, "error", err)
+
+			select {
+			case <-ctx.Done():
+				log.Error("Abandoning dispatch retries, context cancelled", "dispatcher", r.name, "attempt", attempt, "error", err)
+				return err
+			case <-time.After(delay):
+				// pass
+			}
+		}
+
+		err = webhookd.DispatchMessage(ctx, r.dispatcher, msg)
+
+		if err == nil {
+
+			if attempt > 1 {
+				log.Info("Dispatch succeeded after retrying", "dispatcher", r.name, "attempt", attempt)
+			}
+
+			return nil
+		}
+
+		switch err.Code {
+		case webhookd.UnhandledEvent, webhookd.HaltEvent:
+			return err
+		}
+
+		log.Warn("Dispatch attempt failed", "dispatcher", r.name, "attempt", attempt, "code", err.Code, "error", err)
+
+		if !r.policy.Retryable(err) {
+			log.Error("Dispatch failed with non-retryable error", "dispatcher", r.name, "attempt", attempt, "error", err)
+			return err
+		}
+	}
+
+	log.Error("Dispatch failed, retries exhausted", "dispatcher", r.name, "attempts", r.policy.MaxAttempts, "error", err)
+	return err
+}
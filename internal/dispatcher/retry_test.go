@@ -0,0 +1,106 @@
+package dispatcher
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// flakyDispatcher implements the `webhookd.WebhookDispatcher` interface and returns each of its errors in turn before succeeding.
+type flakyDispatcher struct {
+	webhookd.WebhookDispatcher
+	errors   []*webhookd.WebhookError
+	attempts int
+}
+
+func (d *flakyDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	d.attempts += 1
+
+	if d.attempts <= len(d.errors) {
+		return d.errors[d.attempts-1]
+	}
+
+	return nil
+}
+
+func TestRetryDispatcher(t *testing.T) {
+
+	ctx := context.Background()
+
+	policy, err := NewRetryPolicyFromConfig(&config.WebhookRetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   "1ms",
+		MaxDelay:    "5ms",
+		Jitter:      0.5,
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create retry policy, %v", err)
+	}
+
+	badGateway := &webhookd.WebhookError{Code: http.StatusBadGateway, Message: "Bad Gateway"}
+	badRequest := &webhookd.WebhookError{Code: http.StatusBadRequest, Message: "Bad Request"}
+
+	tests := []struct {
+		errors   []*webhookd.WebhookError
+		attempts int
+		fail     bool
+	}{
+		{[]*webhookd.WebhookError{badGateway}, 2, false},
+		{[]*webhookd.WebhookError{badGateway, badGateway, badGateway}, 3, true},
+		{[]*webhookd.WebhookError{badRequest}, 1, true},
+	}
+
+	for idx, test := range tests {
+
+		flaky := &flakyDispatcher{errors: test.errors}
+		d := NewRetryDispatcher("flaky", flaky, policy)
+
+		err := d.Dispatch(ctx, []byte("hello world"))
+
+		if (err != nil) != test.fail {
+			t.Fatalf("Unexpected result for test %d: %v", idx, err)
+		}
+
+		if flaky.attempts != test.attempts {
+			t.Fatalf("Unexpected number of attempts for test %d: %d", idx, flaky.attempts)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+
+	policy, err := NewRetryPolicyFromConfig(&config.WebhookRetryConfig{
+		BaseDelay: "100ms",
+		MaxDelay:  "300ms",
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create retry policy, %v", err)
+	}
+
+	expected := map[int]time.Duration{
+		2: 100 * time.Millisecond,
+		3: 200 * time.Millisecond,
+		4: 300 * time.Millisecond,
+		9: 300 * time.Millisecond,
+	}
+
+	for attempt, d := range expected {
+
+		if policy.Delay(attempt) != d {
+			t.Fatalf("Unexpected delay for attempt %d: %v", attempt, policy.Delay(attempt))
+		}
+	}
+
+	_, err = NewRetryPolicyFromConfig(&config.WebhookRetryConfig{BaseDelay: "1s", MaxDelay: "1ms"})
+
+	if err == nil {
+		t.Fatalf("Expected max_delay less than base_delay to fail")
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/bobertrublik/webhook-router/internal/webhookd"
-	"io"
 	"net/http"
 
 	"net/url"
@@ -26,6 +25,12 @@ type SlackDispatcher struct {
 	incomingWebhook string
 }
 
+// NewSlackDispatcher returns a new `SlackDispatcher` instance configured by 'uri' in the form of:
+//
+//	slack://?webhook={URL}
+//
+// If the URI's fragment contains a "token_env" or "token_file" option a `SlackAPIDispatcher` using the Slack Web API
+// is returned instead.
 func NewSlackDispatcher(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
 
 	u, err := url.Parse(uri)
@@ -34,6 +39,16 @@ func NewSlackDispatcher(ctx context.Context, uri string) (webhookd.WebhookDispat
 		return nil, fmt.Errorf("Failed to parse URI, %v", err)
 	}
 
+	opts, err := url.ParseQuery(u.EscapedFragment())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse options, %w", err)
+	}
+
+	if opts.Has("token_env") || opts.Has("token_file") {
+		return NewSlackAPIDispatcher(ctx, uri)
+	}
+
 	q := u.Query()
 
 	slack := SlackDispatcher{
@@ -45,34 +60,31 @@ func NewSlackDispatcher(ctx context.Context, uri string) (webhookd.WebhookDispat
 
 func (sl *SlackDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
 
+	// A cancelled dispatch has not been delivered, so it must be reported as a (retryable)
+	// failure for queued messages to be delivered again rather than acknowledged.
+
 	select {
 	case <-ctx.Done():
-		return nil
+		return newTransportError(ctx.Err())
 	default:
 		// pass
 	}
 
-	responseBody := bytes.NewBuffer(body)
-	// Create a new HTTP request
-	resp, err := http.Post(sl.incomingWebhook, "application/json", responseBody)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sl.incomingWebhook, bytes.NewReader(body))
 
 	if err != nil {
-		code := 999
-		message := err.Error()
-
-		err := &webhookd.WebhookError{Code: code, Message: message}
-		return err
+		return &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
 	}
-	defer resp.Body.Close()
-	//Read the response body
-	body, err = io.ReadAll(resp.Body)
-	if err != nil {
-		code := 999
-		message := err.Error()
 
-		err := &webhookd.WebhookError{Code: code, Message: message}
-		return err
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sharedClient.Do(req)
+
+	if err != nil {
+		return newTransportError(err)
 	}
 
-	return nil
+	defer resp.Body.Close()
+
+	return checkResponse(resp, nil)
 }
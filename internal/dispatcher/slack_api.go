@@ -0,0 +1,512 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/bobertrublik/webhook-router/internal/secret"
+	"github.com/bobertrublik/webhook-router/internal/threads"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/tidwall/gjson"
+)
+
+// DefaultSlackAPIURL is the base URL of the Slack Web API.
+const DefaultSlackAPIURL string = "https://slack.com/api/"
+
+// The ways a `SlackAPIDispatcher` can post updates to an existing thread.
+const (
+	// SlackUpdateThread posts updates as replies in the thread of the first message.
+	SlackUpdateThread string = "thread"
+	// SlackUpdateEdit replaces the first message with each update.
+	SlackUpdateEdit string = "edit"
+	// SlackUpdateBoth replaces the first message with each update and also posts it as a reply.
+	SlackUpdateBoth string = "both"
+)
+
+// slackAPIErrorCodes maps the errors returned by the Slack Web API to HTTP status codes so that retry policies
+// can tell temporary failures from permanent ones. Errors which are not listed are "400 Bad Request", except for
+// "message_not_found" from `chat.update` which is "404 Not Found".
+var slackAPIErrorCodes = map[string]int{
+	"ratelimited":         http.StatusTooManyRequests,
+	"internal_error":      http.StatusServiceUnavailable,
+	"fatal_error":         http.StatusServiceUnavailable,
+	"service_unavailable": http.StatusServiceUnavailable,
+	"request_timeout":     http.StatusGatewayTimeout,
+	"not_authed":          http.StatusUnauthorized,
+	"invalid_auth":        http.StatusUnauthorized,
+	"account_inactive":    http.StatusUnauthorized,
+	"token_revoked":       http.StatusUnauthorized,
+	"token_expired":       http.StatusUnauthorized,
+	"missing_scope":       http.StatusForbidden,
+	"not_in_channel":      http.StatusForbidden,
+}
+
+// type slackAPIResponse is a struct containing the parts of a Slack Web API response used by `SlackAPIDispatcher`.
+type slackAPIResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+// SlackAPIDispatcher implements the `webhookd.WebhookDispatcher` interface for posting messages with the Slack Web API.
+// Messages that share a correlation key are threaded under, or replace, the first message posted for that key.
+type SlackAPIDispatcher struct {
+	webhookd.WebhookDispatcher
+	// apiURL is the base URL of the Slack Web API.
+	apiURL string
+	// token is the bot token used to authenticate requests.
+	token string
+	// channel is the ID or name of the channel messages are posted to.
+	channel string
+	// correlationKey is the gjson path of the value that identifies messages about the same event.
+	correlationKey string
+	// update is the way updates to an existing thread are posted.
+	update string
+	// broadcast is true if thread replies are also posted to the channel.
+	broadcast bool
+	// store is the `threads.Store` instance used to remember the first message for each correlation key. It is shared
+	// with every other dispatcher using the same store URI, and is opened the first time a message with a correlation
+	// key is dispatched.
+	store threads.Store
+	// storeMu guards `store`.
+	storeMu sync.Mutex
+	// storeURI is the URI of `store`.
+	storeURI string
+	// timeout is the time allowed for each request.
+	timeout time.Duration
+}
+
+// slackThreadLocks makes sure that only one message is posted at a time for each thread, across every dispatcher
+// sharing a store, so that two messages with the same correlation key can not both start a new thread. Messages for
+// other threads are not held up.
+var slackThreadLocks = newKeyedMutex()
+
+// NewSlackAPIDispatcher returns a new `SlackAPIDispatcher` instance configured by 'uri' in the form of:
+//
+//	slack://#token_env={VARIABLE}&channel={CHANNEL}&correlation_key={PATH}
+//
+// Options are encoded as query parameters in the URI's fragment (or defined in the `options` block of the dispatcher's
+// config) and may be:
+//
+//   - token_env, token_file: Where to read the bot token. Required.
+//   - channel: The ID or name of the channel messages are posted to. Required.
+//   - correlation_key: The gjson path of the value that identifies messages about the same event, for example
+//     `data.essentials.alertId`. If it is not set, or has no value, every message starts a new thread.
+//   - update: One of "thread" (default), "edit" or "both".
+//   - reply_broadcast: Whether thread replies are also posted to the channel. Default is false.
+//   - store: The URI of the `threads.Store` used to remember threads. Default is "memory://". Dispatchers with the same
+//     store URI share one store.
+//   - api_url: The base URL of the Slack Web API. Default is "https://slack.com/api/".
+//   - timeout: The time allowed for each request. Default is 30s.
+func NewSlackAPIDispatcher(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	opts, err := url.ParseQuery(u.EscapedFragment())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse options, %w", err)
+	}
+
+	token, err := secret.Read(opts.Get("token_env"), opts.Get("token_file"))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read bot token, %w", err)
+	}
+
+	if opts.Get("channel") == "" {
+		return nil, fmt.Errorf("Missing channel")
+	}
+
+	d := SlackAPIDispatcher{
+		apiURL:         DefaultSlackAPIURL,
+		token:          token,
+		channel:        opts.Get("channel"),
+		correlationKey: opts.Get("correlation_key"),
+		update:         SlackUpdateThread,
+		timeout:        DefaultHTTPTimeout,
+	}
+
+	if opts.Has("update") {
+
+		switch opts.Get("update") {
+		case SlackUpdateThread, SlackUpdateEdit, SlackUpdateBoth:
+			d.update = opts.Get("update")
+		default:
+			return nil, fmt.Errorf("Invalid update '%s'", opts.Get("update"))
+		}
+	}
+
+	if opts.Has("reply_broadcast") {
+
+		broadcast, err := strconv.ParseBool(opts.Get("reply_broadcast"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid reply_broadcast, %w", err)
+		}
+
+		d.broadcast = broadcast
+	}
+
+	if opts.Has("api_url") {
+		d.apiURL = opts.Get("api_url")
+	}
+
+	if !strings.HasSuffix(d.apiURL, "/") {
+		d.apiURL = d.apiURL + "/"
+	}
+
+	if opts.Has("timeout") {
+
+		t, err := time.ParseDuration(opts.Get("timeout"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timeout, %w", err)
+		}
+
+		d.timeout = t
+	}
+
+	store_uri := "memory://"
+
+	if opts.Has("store") {
+		store_uri = opts.Get("store")
+	}
+
+	// The store is not opened until it is needed so that validating a config does not
+	// create or read any files.
+
+	err = threads.CheckURI(store_uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid thread store, %w", err)
+	}
+
+	d.storeURI = store_uri
+
+	return &d, nil
+}
+
+// Dispatch posts 'body' to the dispatcher's channel. If 'body' is a JSON object it is used as the arguments of the API
+// call (for example `blocks` and `text`), otherwise it is posted as text. If a message has already been posted for the
+// correlation key of 'body' the new message is posted as a reply in its thread, or replaces it, or both.
+func (d *SlackAPIDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	args, err := newSlackAPIArgs(body)
+
+	if err != nil {
+		return &webhookd.WebhookError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	correlation_key := ""
+
+	if d.correlationKey != "" {
+		correlation_key = gjson.GetBytes(body, d.correlationKey).String()
+	}
+
+	if correlation_key == "" {
+
+		args["channel"] = d.channel
+
+		_, err2 := d.call(ctx, "chat.postMessage", args)
+		return err2
+	}
+
+	store_key := d.channel + "/" + correlation_key
+
+	unlock := slackThreadLocks.Lock(d.storeURI + " " + store_key)
+	defer unlock()
+
+	store, err := d.threadStore(ctx)
+
+	if err != nil {
+		return &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to open thread store, %v", err)}
+	}
+
+	thr, err := store.Get(ctx, store_key)
+
+	if err != nil && !errors.Is(err, threads.ErrNotFound) {
+		return &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to get thread, %v", err)}
+	}
+
+	if thr == nil {
+		return d.postThread(ctx, store_key, args)
+	}
+
+	if d.update == SlackUpdateEdit || d.update == SlackUpdateBoth {
+
+		update_args := copySlackAPIArgs(args)
+		update_args["channel"] = thr.Channel
+		update_args["ts"] = thr.TS
+
+		_, err2 := d.call(ctx, "chat.update", update_args)
+
+		// The first message may have been deleted so start a new thread instead.
+
+		if err2 != nil && err2.Code == http.StatusNotFound {
+			return d.postThread(ctx, store_key, args)
+		}
+
+		if err2 != nil {
+			return err2
+		}
+	}
+
+	if d.update == SlackUpdateThread || d.update == SlackUpdateBoth {
+
+		reply_args := copySlackAPIArgs(args)
+		reply_args["channel"] = thr.Channel
+		reply_args["thread_ts"] = thr.TS
+
+		if d.broadcast {
+			reply_args["reply_broadcast"] = true
+		}
+
+		_, err2 := d.call(ctx, "chat.postMessage", reply_args)
+
+		if err2 != nil {
+			return err2
+		}
+	}
+
+	d.putThread(ctx, store_key, &threads.Thread{Channel: thr.Channel, TS: thr.TS, Updated: time.Now()})
+	return nil
+}
+
+// Preview returns the arguments of the "chat.postMessage" API call that would post 'msg' as a new message. The thread
+// store is not consulted, so updates to an existing thread are previewed as new messages; replies and edits use the
+// same arguments along with the thread's "thread_ts" or "ts".
+func (d *SlackAPIDispatcher) Preview(ctx context.Context, msg *webhookd.Message) ([]byte, *webhookd.WebhookError) {
+
+	args, err := newSlackAPIArgs(msg.Body)
+
+	if err != nil {
+		return nil, &webhookd.WebhookError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	args["channel"] = d.channel
+
+	enc, err := json.Marshal(args)
+
+	if err != nil {
+		return nil, &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return enc, nil
+}
+
+// threadStore returns the dispatcher's `threads.Store`, opening it (or finding the instance already opened for the same
+// store URI) the first time it is called.
+func (d *SlackAPIDispatcher) threadStore(ctx context.Context) (threads.Store, error) {
+
+	d.storeMu.Lock()
+	defer d.storeMu.Unlock()
+
+	if d.store != nil {
+		return d.store, nil
+	}
+
+	store, err := threads.NewSharedStore(ctx, d.storeURI)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.store = store
+	return d.store, nil
+}
+
+// postThread posts 'args' as a new message and remembers it as the thread for 'store_key'.
+func (d *SlackAPIDispatcher) postThread(ctx context.Context, store_key string, args map[string]interface{}) *webhookd.WebhookError {
+
+	post_args := copySlackAPIArgs(args)
+	post_args["channel"] = d.channel
+
+	rsp, err := d.call(ctx, "chat.postMessage", post_args)
+
+	if err != nil {
+		return err
+	}
+
+	d.putThread(ctx, store_key, &threads.Thread{Channel: rsp.Channel, TS: rsp.TS, Updated: time.Now()})
+	return nil
+}
+
+// putThread stores 'thr' for 'store_key'. Failures are logged rather than returned because the message has already
+// been posted and retrying the dispatch would post it again.
+func (d *SlackAPIDispatcher) putThread(ctx context.Context, store_key string, thr *threads.Thread) {
+
+	err := d.store.Put(ctx, store_key, thr)
+
+	if err != nil {
+		logger.FromContext(ctx).Warn("Failed to store Slack thread", "key", store_key, "error", err)
+	}
+}
+
+// call invokes the Slack Web API method 'method' with 'args'.
+func (d *SlackAPIDispatcher) call(ctx context.Context, method string, args map[string]interface{}) (*slackAPIResponse, *webhookd.WebhookError) {
+
+	enc, err := json.Marshal(args)
+
+	if err != nil {
+		return nil, &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.apiURL+method, bytes.NewReader(enc))
+
+	if err != nil {
+		return nil, &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+d.token)
+
+	rsp, err := sharedClient.Do(req)
+
+	if err != nil {
+		return nil, newTransportError(err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, checkResponse(rsp, nil)
+	}
+
+	var api_rsp *slackAPIResponse
+
+	err = json.NewDecoder(rsp.Body).Decode(&api_rsp)
+
+	if err != nil {
+		return nil, &webhookd.WebhookError{Code: http.StatusBadGateway, Message: fmt.Sprintf("Failed to decode %s response, %v", method, err)}
+	}
+
+	if !api_rsp.OK {
+
+		code, ok := slackAPIErrorCodes[api_rsp.Error]
+
+		if !ok {
+			code = http.StatusBadRequest
+		}
+
+		if method == "chat.update" && api_rsp.Error == "message_not_found" {
+			code = http.StatusNotFound
+		}
+
+		return nil, &webhookd.WebhookError{Code: code, Message: fmt.Sprintf("Slack API %s failed, %s", method, api_rsp.Error)}
+	}
+
+	return api_rsp, nil
+}
+
+// newSlackAPIArgs returns the arguments for a Slack Web API call derived from 'body'.
+func newSlackAPIArgs(body []byte) (map[string]interface{}, error) {
+
+	r := gjson.ParseBytes(body)
+
+	if !gjson.ValidBytes(body) || !r.IsObject() {
+
+		if len(bytes.TrimSpace(body)) == 0 {
+			return nil, fmt.Errorf("Message is empty")
+		}
+
+		return map[string]interface{}{"text": string(body)}, nil
+	}
+
+	var args map[string]interface{}
+
+	err := json.Unmarshal(body, &args)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode message, %w", err)
+	}
+
+	return args, nil
+}
+
+// copySlackAPIArgs returns a shallow copy of 'args'.
+func copySlackAPIArgs(args map[string]interface{}) map[string]interface{} {
+
+	c := make(map[string]interface{}, len(args)+2)
+
+	for k, v := range args {
+		c[k] = v
+	}
+
+	return c
+}
+
+// keyedMutex is a set of mutexes, one for each key, which are created when they are first locked and removed once
+// nothing holds or is waiting for them.
+type keyedMutex struct {
+	// mu guards `locks`.
+	mu sync.Mutex
+	// locks is the map of keys to the mutexes currently in use.
+	locks map[string]*keyedLock
+}
+
+// keyedLock is a mutex in a `keyedMutex` along with the number of callers holding or waiting for it.
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// newKeyedMutex returns a new, empty `keyedMutex` instance.
+func newKeyedMutex() *keyedMutex {
+
+	k := &keyedMutex{
+		locks: make(map[string]*keyedLock),
+	}
+
+	return k
+}
+
+// Lock locks the mutex for 'key', blocking until it is available, and returns the function that unlocks it.
+func (k *keyedMutex) Lock(key string) func() {
+
+	k.mu.Lock()
+
+	l, ok := k.locks[key]
+
+	if !ok {
+		l = new(keyedLock)
+		k.locks[key] = l
+	}
+
+	l.refs += 1
+	k.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+
+		l.mu.Unlock()
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+
+		l.refs -= 1
+
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// type slackAPICall is a struct containing a call received by the stand-in Slack Web API in `newSlackAPIServer`.
+type slackAPICall struct {
+	method string
+	args   map[string]interface{}
+}
+
+// newSlackAPIServer returns a stand-in for the Slack Web API which records every call to 'calls'.
+func newSlackAPIServer(t *testing.T, calls *[]slackAPICall) *httptest.Server {
+
+	count := 0
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			return
+		}
+
+		var args map[string]interface{}
+
+		err := json.NewDecoder(r.Body).Decode(&args)
+
+		if err != nil {
+			t.Errorf("Failed to decode request, %v", err)
+		}
+
+		method := strings.TrimPrefix(r.URL.Path, "/api/")
+		*calls = append(*calls, slackAPICall{method: method, args: args})
+
+		switch method {
+		case "chat.postMessage":
+			count += 1
+			fmt.Fprintf(w, `{"ok":true,"channel":"C123","ts":"1700000000.00%04d"}`, count)
+		case "chat.update":
+			fmt.Fprintf(w, `{"ok":true,"channel":"C123","ts":"%s"}`, args["ts"])
+		default:
+			w.Write([]byte(`{"ok":false,"error":"unknown_method"}`))
+		}
+	}))
+}
+
+// newThreadStoreURI returns the escaped URI of a new `threads.FileStore` for a single test, because thread stores are
+// shared by every dispatcher in the process with the same store URI.
+func newThreadStoreURI(t *testing.T) string {
+	return url.QueryEscape("file://" + filepath.Join(t.TempDir(), "threads.json"))
+}
+
+func TestSlackAPIDispatcher(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SLACK", "xoxb-test")
+
+	calls := make([]slackAPICall, 0)
+
+	srv := newSlackAPIServer(t, &calls)
+	defer srv.Close()
+
+	d, err := NewDispatcher(ctx, "slack://#token_env=WEBHOOKD_TEST_SLACK&channel=alerts&correlation_key=metadata.event_payload.alert_id&api_url="+srv.URL+"/api&store="+newThreadStoreURI(t))
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	if _, ok := d.(*SlackAPIDispatcher); !ok {
+		t.Fatalf("Expected token_env to create a SlackAPIDispatcher, got %T", d)
+	}
+
+	messages := []string{
+		`{"text":"Active","metadata":{"event_type":"azure_alert","event_payload":{"alert_id":"abc"}}}`,
+		`{"text":"Resolved","metadata":{"event_type":"azure_alert","event_payload":{"alert_id":"abc"}}}`,
+		`{"text":"Active","metadata":{"event_type":"azure_alert","event_payload":{"alert_id":"def"}}}`,
+		`hello world`,
+	}
+
+	for _, body := range messages {
+
+		err2 := d.Dispatch(ctx, []byte(body))
+
+		if err2 != nil {
+			t.Fatalf("Failed to dispatch '%s', %v", body, err2)
+		}
+	}
+
+	if len(calls) != 4 {
+		t.Fatalf("Expected 4 calls, got %d", len(calls))
+	}
+
+	if calls[0].args["channel"] != "alerts" || calls[0].args["thread_ts"] != nil {
+		t.Fatalf("Expected first message to start a thread, got %v", calls[0].args)
+	}
+
+	if calls[1].method != "chat.postMessage" || calls[1].args["channel"] != "C123" || calls[1].args["thread_ts"] != "1700000000.000001" {
+		t.Fatalf("Expected update to be posted in thread, got %s %v", calls[1].method, calls[1].args)
+	}
+
+	if calls[2].args["thread_ts"] != nil {
+		t.Fatalf("Expected message with a different key to start a new thread, got %v", calls[2].args)
+	}
+
+	if calls[3].args["text"] != "hello world" || calls[3].args["thread_ts"] != nil {
+		t.Fatalf("Expected plain text message to be posted as text, got %v", calls[3].args)
+	}
+}
+
+func TestSlackAPIDispatcherEdit(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SLACK", "xoxb-test")
+
+	calls := make([]slackAPICall, 0)
+
+	srv := newSlackAPIServer(t, &calls)
+	defer srv.Close()
+
+	d, err := NewDispatcher(ctx, "slack://#token_env=WEBHOOKD_TEST_SLACK&channel=C123&correlation_key=id&update=both&api_url="+srv.URL+"/api/&store="+newThreadStoreURI(t))
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	for _, body := range []string{`{"id":"abc","text":"Active"}`, `{"id":"abc","text":"Resolved"}`} {
+
+		err2 := d.Dispatch(ctx, []byte(body))
+
+		if err2 != nil {
+			t.Fatalf("Failed to dispatch '%s', %v", body, err2)
+		}
+	}
+
+	expected := []string{"chat.postMessage", "chat.update", "chat.postMessage"}
+
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected %d calls, got %d", len(expected), len(calls))
+	}
+
+	for i, method := range expected {
+
+		if calls[i].method != method {
+			t.Fatalf("Expected call %d to be %s, got %s", i, method, calls[i].method)
+		}
+	}
+
+	if calls[1].args["ts"] != "1700000000.000001" || calls[1].args["text"] != "Resolved" {
+		t.Fatalf("Unexpected update, %v", calls[1].args)
+	}
+
+	if calls[2].args["thread_ts"] != "1700000000.000001" {
+		t.Fatalf("Expected reply in thread, %v", calls[2].args)
+	}
+
+	// A bad token is not retryable
+
+	t.Setenv("WEBHOOKD_TEST_SLACK", "xoxb-wrong")
+
+	d2, err := NewDispatcher(ctx, "slack://#token_env=WEBHOOKD_TEST_SLACK&channel=C123&api_url="+srv.URL+"/api/")
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	err2 := d2.Dispatch(ctx, []byte("hello world"))
+
+	if err2 == nil || err2.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 error for invalid token, got %v", err2)
+	}
+}
+
+func TestSlackAPIDispatcherSharedStore(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SLACK", "xoxb-test")
+
+	calls := make([]slackAPICall, 0)
+
+	srv := newSlackAPIServer(t, &calls)
+	defer srv.Close()
+
+	// Each webhook using a dispatcher, and each reload of the config, creates a new instance of it.
+
+	uri := "slack://#token_env=WEBHOOKD_TEST_SLACK&channel=C123&correlation_key=id&api_url=" + srv.URL + "/api/&store=" + newThreadStoreURI(t)
+
+	for _, body := range []string{`{"id":"abc","text":"Active"}`, `{"id":"abc","text":"Resolved"}`} {
+
+		d, err := NewDispatcher(ctx, uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create new dispatcher, %v", err)
+		}
+
+		err2 := d.Dispatch(ctx, []byte(body))
+
+		if err2 != nil {
+			t.Fatalf("Failed to dispatch '%s', %v", body, err2)
+		}
+	}
+
+	if len(calls) != 2 || calls[1].args["thread_ts"] != "1700000000.000001" {
+		t.Fatalf("Expected second dispatcher to reply in the first one's thread, got %v", calls)
+	}
+}
+
+func TestSlackAPIDispatcherStore(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SLACK", "xoxb-test")
+
+	calls := make([]slackAPICall, 0)
+
+	srv := newSlackAPIServer(t, &calls)
+	defer srv.Close()
+
+	_, err := NewDispatcher(ctx, "slack://#token_env=WEBHOOKD_TEST_SLACK&channel=C123&store="+url.QueryEscape("chicken://"))
+
+	if err == nil {
+		t.Fatalf("Expected unknown thread store scheme to fail")
+	}
+
+	// The store is not opened until a message with a correlation key is dispatched.
+
+	path := filepath.Join(t.TempDir(), "threads", "threads.json")
+
+	d, err := NewDispatcher(ctx, "slack://#token_env=WEBHOOKD_TEST_SLACK&channel=C123&correlation_key=id&api_url="+srv.URL+"/api/&store="+url.QueryEscape("file://"+path))
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Fatalf("Expected thread store not to be opened by the constructor, %v", err)
+	}
+
+	err2 := d.Dispatch(ctx, []byte(`{"id":"abc","text":"Active"}`))
+
+	if err2 != nil {
+		t.Fatalf("Failed to dispatch message, %v", err2)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected thread to be stored, %v", err)
+	}
+}
+
+func TestKeyedMutex(t *testing.T) {
+
+	k := newKeyedMutex()
+
+	unlock := k.Lock("a")
+
+	// A different key is not held up.
+
+	done := make(chan struct{})
+
+	go func() {
+		k.Lock("b")()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for lock on a different key")
+	}
+
+	// The same key is.
+
+	mu := new(sync.Mutex)
+	locked := false
+
+	done = make(chan struct{})
+
+	go func() {
+
+		k.Lock("a")()
+
+		mu.Lock()
+		locked = true
+		mu.Unlock()
+
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+
+	if locked {
+		t.Fatalf("Expected lock on the same key to wait")
+	}
+
+	mu.Unlock()
+
+	unlock()
+	<-done
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if len(k.locks) != 0 {
+		t.Fatalf("Expected unused locks to be removed, got %d", len(k.locks))
+	}
+}
@@ -0,0 +1,49 @@
+package dispatcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+)
+
+func TestSlackDispatcherCancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	requests := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+	}))
+
+	defer srv.Close()
+
+	d, err := NewDispatcher(ctx, "slack://?webhook="+srv.URL)
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	cancel()
+
+	// A cancelled dispatch has not been delivered so it must not be reported as a success.
+
+	err2 := d.Dispatch(ctx, []byte(`{"text":"hello world"}`))
+
+	policy, err := NewRetryPolicyFromConfig(&config.WebhookRetryConfig{})
+
+	if err != nil {
+		t.Fatalf("Failed to create retry policy, %v", err)
+	}
+
+	if err2 == nil || !policy.Retryable(err2) {
+		t.Fatalf("Expected retryable error for cancelled dispatch, got %v", err2)
+	}
+
+	if requests != 0 {
+		t.Fatalf("Expected cancelled dispatch not to be sent")
+	}
+}
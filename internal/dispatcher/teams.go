@@ -0,0 +1,249 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/secret"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/tidwall/gjson"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterDispatcher(ctx, "teams", NewTeamsDispatcher)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// AdaptiveCardContentType is the content type of an Adaptive Card attached to a Teams message.
+const AdaptiveCardContentType string = "application/vnd.microsoft.card.adaptive"
+
+// AdaptiveCardVersion is the Adaptive Card schema version used for cards created by the `TeamsDispatcher`.
+const AdaptiveCardVersion string = "1.4"
+
+// teamsErrorPattern matches the body of a "200 OK" response which legacy Office 365 connectors use to report
+// that a message was rejected, for example "Microsoft Teams endpoint returned HTTP error 429 ...".
+var teamsErrorPattern = regexp.MustCompile(`returned HTTP error (\d{3})`)
+
+// TeamsDispatcher implements the `webhookd.WebhookDispatcher` interface for relaying messages to Microsoft Teams
+// incoming webhooks or Power Automate Workflows URLs.
+type TeamsDispatcher struct {
+	webhookd.WebhookDispatcher
+	// webhook is the URL that messages are posted to.
+	webhook string
+	// timeout is the time allowed for each request.
+	timeout time.Duration
+}
+
+// NewTeamsDispatcher returns a new `TeamsDispatcher` instance configured by 'uri' in the form of:
+//
+//	teams://?webhook={URL}#{OPTIONS}
+//
+// Options are encoded as query parameters in the URI's fragment (or defined in the `options` block of the dispatcher's
+// config) and may be:
+//
+//   - webhook_env, webhook_file: Where to read the webhook URL from, instead of the `webhook` query parameter.
+//     Teams webhook URLs contain a signature so they should be treated as secrets.
+//   - timeout: The time allowed for each request. Default is 30s.
+func NewTeamsDispatcher(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	opts, err := url.ParseQuery(u.EscapedFragment())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse options, %w", err)
+	}
+
+	webhook := u.Query().Get("webhook")
+
+	if opts.Has("webhook_env") || opts.Has("webhook_file") {
+
+		if webhook != "" {
+			return nil, fmt.Errorf("Webhook must be defined in the URI or read from a secret, not both")
+		}
+
+		v, err := secret.Read(opts.Get("webhook_env"), opts.Get("webhook_file"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read webhook URL, %w", err)
+		}
+
+		webhook = v
+	}
+
+	if webhook == "" {
+		return nil, fmt.Errorf("Missing webhook")
+	}
+
+	webhook_u, err := url.Parse(webhook)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse webhook URL, %w", err)
+	}
+
+	if webhook_u.Scheme != "https" && webhook_u.Scheme != "http" {
+		return nil, fmt.Errorf("Invalid webhook URL scheme '%s'", webhook_u.Scheme)
+	}
+
+	d := TeamsDispatcher{
+		webhook: webhook,
+		timeout: DefaultHTTPTimeout,
+	}
+
+	if opts.Has("timeout") {
+
+		t, err := time.ParseDuration(opts.Get("timeout"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timeout, %w", err)
+		}
+
+		d.timeout = t
+	}
+
+	return &d, nil
+}
+
+// Dispatch posts 'body' to the dispatcher's webhook URL. Teams messages (with "type": "message") and legacy
+// MessageCards are sent as they are, Adaptive Cards are attached to a new message and anything else is treated as
+// text and wrapped in an Adaptive Card.
+func (d *TeamsDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	payload, err := NewTeamsMessage(body)
+
+	if err != nil {
+		return &webhookd.WebhookError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Failed to create Teams message, %v", err)}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.webhook, bytes.NewReader(payload))
+
+	if err != nil {
+		return &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := sharedClient.Do(req)
+
+	if err != nil {
+		return newTransportError(err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return checkResponse(rsp, nil)
+	}
+
+	// Incoming webhooks created with the legacy Office 365 connector report throttling and
+	// other errors in the body of a "200 OK" response so treat those as failures.
+
+	rsp_body, _ := io.ReadAll(io.LimitReader(rsp.Body, maxErrorBodySize))
+	io.Copy(io.Discard, rsp.Body)
+
+	m := teamsErrorPattern.FindSubmatch(rsp_body)
+
+	if m == nil {
+		return nil
+	}
+
+	code, _ := strconv.Atoi(string(m[1]))
+
+	return &webhookd.WebhookError{
+		Code:    code,
+		Message: fmt.Sprintf("Unexpected response: %s", string(rsp_body)),
+	}
+}
+
+// Preview returns the Teams message that would be posted for 'msg'.
+func (d *TeamsDispatcher) Preview(ctx context.Context, msg *webhookd.Message) ([]byte, *webhookd.WebhookError) {
+
+	payload, err := NewTeamsMessage(msg.Body)
+
+	if err != nil {
+		return nil, &webhookd.WebhookError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Failed to create Teams message, %v", err)}
+	}
+
+	return payload, nil
+}
+
+// NewTeamsMessage returns the JSON encoded Teams message for 'body'. If 'body' is a Teams message (with "type":
+// "message") or a legacy MessageCard it is returned unaltered. If it is an Adaptive Card it is attached to a new message.
+// A JSON object with a "text" property is wrapped in an Adaptive Card containing that text, and any other
+// value is wrapped in an Adaptive Card containing 'body' as text.
+func NewTeamsMessage(body []byte) ([]byte, error) {
+
+	text := string(body)
+
+	if gjson.ValidBytes(body) {
+
+		r := gjson.ParseBytes(body)
+
+		switch {
+		case r.Get("type").String() == "message", r.Get("@type").String() == "MessageCard":
+			return body, nil
+		case r.Get("type").String() == "AdaptiveCard":
+			return newTeamsAttachmentMessage(json.RawMessage(body))
+		case r.IsObject() && r.Get("text").Type == gjson.String:
+			text = r.Get("text").String()
+		case r.Type == gjson.String:
+			text = r.String()
+		}
+	}
+
+	if text == "" {
+		return nil, fmt.Errorf("Message is empty")
+	}
+
+	card := map[string]interface{}{
+		"type":    "AdaptiveCard",
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"version": AdaptiveCardVersion,
+		"body": []interface{}{
+			map[string]interface{}{
+				"type": "TextBlock",
+				"text": text,
+				"wrap": true,
+			},
+		},
+	}
+
+	return newTeamsAttachmentMessage(card)
+}
+
+// newTeamsAttachmentMessage returns a JSON encoded Teams message with 'card' as its only attachment.
+func newTeamsAttachmentMessage(card interface{}) ([]byte, error) {
+
+	msg := map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": AdaptiveCardContentType,
+				"contentUrl":  nil,
+				"content":     card,
+			},
+		},
+	}
+
+	return json.Marshal(msg)
+}
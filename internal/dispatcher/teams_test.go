@@ -0,0 +1,116 @@
+package dispatcher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestTeamsDispatcher(t *testing.T) {
+
+	ctx := context.Background()
+
+	var got []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	defer srv.Close()
+
+	t.Setenv("WEBHOOKD_TEST_TEAMS", srv.URL+"/workflows/invoke?sig=abc")
+
+	d, err := NewDispatcher(ctx, "teams://#webhook_env=WEBHOOKD_TEST_TEAMS")
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	tests := map[string]string{
+		"hello world":            "hello world",
+		`{"text":"hello world"}`: "hello world",
+		`{"type":"AdaptiveCard","body":[{"type":"TextBlock","text":"hello world"}]}`: "hello world",
+	}
+
+	for body, expected := range tests {
+
+		err2 := d.Dispatch(ctx, []byte(body))
+
+		if err2 != nil {
+			t.Fatalf("Failed to dispatch '%s', %v", body, err2)
+		}
+
+		r := gjson.ParseBytes(got)
+
+		if r.Get("type").String() != "message" {
+			t.Fatalf("Unexpected message type for '%s': %s", body, got)
+		}
+
+		if r.Get("attachments.0.contentType").String() != AdaptiveCardContentType {
+			t.Fatalf("Unexpected content type for '%s': %s", body, got)
+		}
+
+		if r.Get("attachments.0.content.body.0.text").String() != expected {
+			t.Fatalf("Unexpected card for '%s': %s", body, got)
+		}
+	}
+
+	msg := `{"type":"message","attachments":[]}`
+
+	err2 := d.Dispatch(ctx, []byte(msg))
+
+	if err2 != nil {
+		t.Fatalf("Failed to dispatch message, %v", err2)
+	}
+
+	if string(got) != msg {
+		t.Fatalf("Expected message to be sent unaltered, got %s", got)
+	}
+}
+
+func TestTeamsDispatcherErrors(t *testing.T) {
+
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Microsoft Teams endpoint returned HTTP error 429 with ContextId tcid=0"))
+	}))
+
+	defer srv.Close()
+
+	d, err := NewDispatcher(ctx, "teams://?webhook="+url.QueryEscape(srv.URL))
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	err2 := d.Dispatch(ctx, []byte("hello world"))
+
+	if err2 == nil {
+		t.Fatalf("Expected throttled message to fail")
+	}
+
+	if err2.Code != http.StatusTooManyRequests {
+		t.Fatalf("Unexpected error code %d", err2.Code)
+	}
+
+	for _, uri := range []string{
+		"teams://",
+		"teams://?webhook=ftp://example.com",
+		"teams://?webhook=https://example.com#webhook_env=WEBHOOKD_TEST_TEAMS",
+	} {
+
+		_, err := NewDispatcher(ctx, uri)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail", uri)
+		}
+	}
+}
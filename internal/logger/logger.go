@@ -1,14 +1,149 @@
+// Package logger provides the structured logger used by `webhookd` and methods for carrying request-scoped loggers in a context.
 package logger
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 )
 
+// Log is the default logger. It writes JSON to STDOUT at the "info" level until `Setup` is called.
 var Log *slog.Logger
 
+// The formats supported by `New`.
+const (
+	FormatJSON string = "json"
+	FormatText string = "text"
+)
+
+// The outputs supported by `New`, in addition to the path of a file.
+const (
+	OutputStdout string = "stdout"
+	OutputStderr string = "stderr"
+)
+
 func init() {
-	// Initialize the Log variable
-	jsonHandler := slog.NewJSONHandler(os.Stdout, nil) // 👈
-	Log = slog.New(jsonHandler)
+	Log = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+}
+
+// type Options is a struct containing the settings for a new logger.
+type Options struct {
+	// Level is the minimum level of messages that are logged: "debug", "info", "warn" or "error". Defaults to "info".
+	Level string
+	// Format is the format of log lines: "json" or "text". Defaults to "json".
+	Format string
+	// Output is where log lines are written: "stdout", "stderr" or the path of a file that lines are appended to.
+	// Defaults to "stdout".
+	Output string
+}
+
+// ParseLevel returns the `slog.Level` for 'str'. An empty string is "info".
+func ParseLevel(str string) (slog.Level, error) {
+
+	var level slog.Level
+
+	if str == "" {
+		return slog.LevelInfo, nil
+	}
+
+	err := level.UnmarshalText([]byte(str))
+
+	if err != nil {
+		return level, fmt.Errorf("Invalid log level '%s'", str)
+	}
+
+	return level, nil
+}
+
+// New returns a new `slog.Logger` configured by 'opts' and an `io.Closer` for its output. Closing the output is a no-op
+// unless 'opts.Output' is the path of a file.
+func New(opts *Options) (*slog.Logger, io.Closer, error) {
+
+	level, err := ParseLevel(opts.Level)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var wr io.Writer
+	var closer io.Closer = io.NopCloser(nil)
+
+	switch strings.ToLower(opts.Output) {
+	case "", OutputStdout:
+		wr = os.Stdout
+	case OutputStderr:
+		wr = os.Stderr
+	default:
+
+		f, err := os.OpenFile(opts.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to open log file '%s', %w", opts.Output, err)
+		}
+
+		wr = f
+		closer = f
+	}
+
+	handler_opts := &slog.HandlerOptions{
+		Level: level,
+	}
+
+	var h slog.Handler
+
+	switch strings.ToLower(opts.Format) {
+	case "", FormatJSON:
+		h = slog.NewJSONHandler(wr, handler_opts)
+	case FormatText:
+		h = slog.NewTextHandler(wr, handler_opts)
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("Invalid log format '%s'", opts.Format)
+	}
+
+	return slog.New(h), closer, nil
+}
+
+// Setup replaces `Log`, and the default `slog` logger, with a new logger configured by 'opts'. It returns a function
+// that closes the logger's output, which should be called when the program exits.
+func Setup(opts *Options) (func() error, error) {
+
+	l, closer, err := New(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	Log = l
+	slog.SetDefault(l)
+
+	return closer.Close, nil
+}
+
+// loggerKey is the key used to store a logger in a context.
+type loggerKey struct{}
+
+// NewContext returns a copy of 'ctx' carrying 'l'.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by 'ctx', or `Log` if there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+
+	l, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+
+	if !ok {
+		return Log
+	}
+
+	return l
+}
+
+// With returns a copy of 'ctx' carrying a child of its logger that includes 'args', as key/value pairs, in every line.
+func With(ctx context.Context, args ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(args...))
 }
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "webhookd.log")
+
+	l, closer, err := New(&Options{Level: "warn", Format: "text", Output: path})
+
+	if err != nil {
+		t.Fatalf("Failed to create logger, %v", err)
+	}
+
+	l.Info("hidden")
+	l.Warn("visible", "endpoint", "/github")
+
+	err = closer.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close log file, %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Failed to read log file, %v", err)
+	}
+
+	out := string(b)
+
+	if strings.Contains(out, "hidden") || !strings.Contains(out, "msg=visible endpoint=/github") {
+		t.Fatalf("Unexpected log output '%s'", out)
+	}
+
+	for _, opts := range []*Options{{Level: "loud"}, {Format: "xml"}} {
+
+		_, _, err := New(opts)
+
+		if err == nil {
+			t.Fatalf("Expected options %v to fail", opts)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+
+	ctx := context.Background()
+
+	if FromContext(ctx) != Log {
+		t.Fatalf("Expected default logger for context without one")
+	}
+
+	var buf strings.Builder
+
+	ctx = NewContext(ctx, slog.New(slog.NewJSONHandler(&buf, nil)))
+	ctx = With(ctx, "request_id", "abc123", "endpoint", "/github")
+
+	FromContext(ctx).Info("Webhook request received")
+
+	var line map[string]interface{}
+
+	err := json.Unmarshal([]byte(buf.String()), &line)
+
+	if err != nil {
+		t.Fatalf("Failed to decode log line, %v", err)
+	}
+
+	if line["request_id"] != "abc123" || line["endpoint"] != "/github" {
+		t.Fatalf("Expected request-scoped fields in log line, got %s", buf.String())
+	}
+}
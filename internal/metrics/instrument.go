@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// Scheme() returns the scheme of 'uri', used to label metrics by the kind of receiver, transformation or dispatcher.
+func Scheme(uri string) string {
+
+	u, err := url.Parse(uri)
+
+	if err != nil || u.Scheme == "" {
+		return "unknown"
+	}
+
+	return u.Scheme
+}
+
+// InstrumentedReceiver implements the `webhookd.WebhookReceiver` interface, recording the duration and outcome
+// of every call to another receiver.
+type InstrumentedReceiver struct {
+	webhookd.WebhookReceiver
+	endpoint string
+	scheme   string
+	receiver webhookd.WebhookReceiver
+}
+
+// NewInstrumentedReceiver returns a new `InstrumentedReceiver` instance for 'r', with the scheme 'scheme', used by 'endpoint'.
+func NewInstrumentedReceiver(endpoint string, scheme string, r webhookd.WebhookReceiver) webhookd.WebhookReceiver {
+
+	i := InstrumentedReceiver{
+		endpoint: endpoint,
+		scheme:   scheme,
+		receiver: r,
+	}
+
+	return &i
+}
+
+// Receive calls the underlying receiver and records how long it took.
+func (i *InstrumentedReceiver) Receive(ctx context.Context, req *http.Request) ([]byte, *webhookd.WebhookError) {
+
+	t := time.Now()
+	body, err := i.receiver.Receive(ctx, req)
+
+	receiveDuration.WithLabelValues(i.endpoint, i.scheme, Outcome(err)).Observe(time.Since(t).Seconds())
+	return body, err
+}
+
+// ReceiveMessage calls the underlying receiver, using `webhookd.ReceiveMessage`, and records how long it took.
+func (i *InstrumentedReceiver) ReceiveMessage(ctx context.Context, req *http.Request) (*webhookd.Message, *webhookd.WebhookError) {
+
+	t := time.Now()
+	msg, err := webhookd.ReceiveMessage(ctx, i.receiver, req)
+
+	receiveDuration.WithLabelValues(i.endpoint, i.scheme, Outcome(err)).Observe(time.Since(t).Seconds())
+	return msg, err
+}
+
+// InstrumentedTransformation implements the `webhookd.WebhookTransformation` interface, recording the duration
+// and outcome of every call to another transformation.
+type InstrumentedTransformation struct {
+	webhookd.WebhookTransformation
+	endpoint       string
+	scheme         string
+	transformation webhookd.WebhookTransformation
+}
+
+// NewInstrumentedTransformation returns a new `InstrumentedTransformation` instance for 't', with the scheme 'scheme',
+// used by 'endpoint'.
+func NewInstrumentedTransformation(endpoint string, scheme string, t webhookd.WebhookTransformation) webhookd.WebhookTransformation {
+
+	i := InstrumentedTransformation{
+		endpoint:       endpoint,
+		scheme:         scheme,
+		transformation: t,
+	}
+
+	return &i
+}
+
+// Transform calls the underlying transformation and records how long it took.
+func (i *InstrumentedTransformation) Transform(ctx context.Context, body []byte) ([]byte, *webhookd.WebhookError) {
+
+	t := time.Now()
+	body, err := i.transformation.Transform(ctx, body)
+
+	transformDuration.WithLabelValues(i.endpoint, i.scheme, Outcome(err)).Observe(time.Since(t).Seconds())
+	return body, err
+}
+
+// TransformMessage calls the underlying transformation, using `webhookd.TransformMessage`, and records how long it took.
+func (i *InstrumentedTransformation) TransformMessage(ctx context.Context, msg *webhookd.Message) (*webhookd.Message, *webhookd.WebhookError) {
+
+	t := time.Now()
+	msg, err := webhookd.TransformMessage(ctx, i.transformation, msg)
+
+	transformDuration.WithLabelValues(i.endpoint, i.scheme, Outcome(err)).Observe(time.Since(t).Seconds())
+	return msg, err
+}
+
+// InstrumentedDispatcher implements the `webhookd.WebhookDispatcher` interface, recording the duration and outcome
+// of every call to another dispatcher.
+type InstrumentedDispatcher struct {
+	webhookd.WebhookDispatcher
+	endpoint   string
+	name       string
+	scheme     string
+	dispatcher webhookd.WebhookDispatcher
+}
+
+// NewInstrumentedDispatcher returns a new `InstrumentedDispatcher` instance for 'd', labeled 'name' with the scheme
+// 'scheme', used by 'endpoint'.
+func NewInstrumentedDispatcher(endpoint string, name string, scheme string, d webhookd.WebhookDispatcher) webhookd.WebhookDispatcher {
+
+	i := InstrumentedDispatcher{
+		endpoint:   endpoint,
+		name:       name,
+		scheme:     scheme,
+		dispatcher: d,
+	}
+
+	return &i
+}
+
+// Close closes the underlying dispatcher.
+func (i *InstrumentedDispatcher) Close() error {
+	return webhookd.CloseDispatcher(i.dispatcher)
+}
+
+// Preview returns the payload the underlying dispatcher would send for 'msg'.
+func (i *InstrumentedDispatcher) Preview(ctx context.Context, msg *webhookd.Message) ([]byte, *webhookd.WebhookError) {
+	return webhookd.PreviewMessage(ctx, i.dispatcher, msg)
+}
+
+// Dispatch calls the underlying dispatcher and records how long it took.
+func (i *InstrumentedDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	t := time.Now()
+	err := i.dispatcher.Dispatch(ctx, body)
+
+	dispatchDuration.WithLabelValues(i.endpoint, i.name, i.scheme, Outcome(err)).Observe(time.Since(t).Seconds())
+	return err
+}
+
+// DispatchMessage calls the underlying dispatcher, using `webhookd.DispatchMessage`, and records how long it took.
+func (i *InstrumentedDispatcher) DispatchMessage(ctx context.Context, msg *webhookd.Message) *webhookd.WebhookError {
+
+	t := time.Now()
+	err := webhookd.DispatchMessage(ctx, i.dispatcher, msg)
+
+	dispatchDuration.WithLabelValues(i.endpoint, i.name, i.scheme, Outcome(err)).Observe(time.Since(t).Seconds())
+	return err
+}
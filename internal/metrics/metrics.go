@@ -0,0 +1,154 @@
+// Package metrics provides Prometheus metrics for the receive, transform and dispatch stages of a `webhookd` instance.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path is the relative URI where metrics are served.
+const Path string = "/metrics"
+
+const (
+	// OutcomeOK signals that a stage completed successfully.
+	OutcomeOK string = "ok"
+	// OutcomeUnhandled signals that a stage returned a `webhookd.UnhandledEvent` error.
+	OutcomeUnhandled string = "unhandled"
+	// OutcomeHalted signals that a stage returned a `webhookd.HaltEvent` error.
+	OutcomeHalted string = "halted"
+	// OutcomeFailed signals that a stage failed.
+	OutcomeFailed string = "failed"
+	// OutcomeSucceeded signals that an event was relayed according to its webhook's dispatch policy.
+	OutcomeSucceeded string = "succeeded"
+	// OutcomeUnrouted signals that an event matched none of its webhook's routes and was not relayed.
+	OutcomeUnrouted string = "unrouted"
+)
+
+// Registry is the `prometheus.Registry` containing every metric served by `Handler`.
+var Registry = prometheus.NewRegistry()
+
+var (
+	receiveDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "webhookd",
+		Name:      "receive_duration_seconds",
+		Help:      "Time taken by receivers to accept and validate a request.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "receiver", "outcome"})
+
+	transformDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "webhookd",
+		Name:      "transform_duration_seconds",
+		Help:      "Time taken by each transformation step.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "transformation", "outcome"})
+
+	dispatchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "webhookd",
+		Name:      "dispatch_duration_seconds",
+		Help:      "Time taken by each dispatcher, including retries.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"endpoint", "dispatcher", "scheme", "outcome"})
+
+	eventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "webhookd",
+		Name:      "events_received_total",
+		Help:      "Number of requests received by configured webhook endpoints.",
+	}, []string{"endpoint"})
+
+	events = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "webhookd",
+		Name:      "events_total",
+		Help:      "Number of events processed, by outcome: succeeded, failed, halted or unhandled.",
+	}, []string{"endpoint", "outcome"})
+
+	queueDepth = &queueCollector{
+		desc: prometheus.NewDesc("webhookd_queue_depth", "Number of messages waiting in the asynchronous delivery queue.", nil, nil),
+	}
+)
+
+func init() {
+
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		receiveDuration,
+		transformDuration,
+		dispatchDuration,
+		eventsReceived,
+		events,
+		queueDepth,
+	)
+}
+
+// Handler() returns a `http.Handler` serving the metrics in `Registry` in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Outcome() returns the outcome label for 'err', an error returned by a receiver, transformation or dispatcher.
+func Outcome(err *webhookd.WebhookError) string {
+
+	if err == nil {
+		return OutcomeOK
+	}
+
+	switch err.Code {
+	case webhookd.UnhandledEvent:
+		return OutcomeUnhandled
+	case webhookd.HaltEvent:
+		return OutcomeHalted
+	default:
+		return OutcomeFailed
+	}
+}
+
+// EventReceived() increments the number of requests received by 'endpoint'.
+func EventReceived(endpoint string) {
+	eventsReceived.WithLabelValues(endpoint).Inc()
+}
+
+// EventProcessed() increments the number of events for 'endpoint' whose processing ended with 'outcome'.
+func EventProcessed(endpoint string, outcome string) {
+	events.WithLabelValues(endpoint, outcome).Inc()
+}
+
+// SetQueueDepth() registers 'fn' as the function reporting the depth of the asynchronous delivery queue. The
+// queue depth is only reported once this method has been called, and stops being reported if 'fn' is nil.
+func SetQueueDepth(fn func() int) {
+
+	queueDepth.mu.Lock()
+	defer queueDepth.mu.Unlock()
+
+	queueDepth.depth = fn
+}
+
+// type queueCollector is a struct implementing the `prometheus.Collector` interface for the queue depth, which
+// is only reported if a queue exists.
+type queueCollector struct {
+	mu    sync.RWMutex
+	desc  *prometheus.Desc
+	depth func() int
+}
+
+// Describe sends the queue depth descriptor to 'ch'.
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect sends the current queue depth to 'ch', if a queue exists.
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.depth == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(c.depth()))
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// TestReceiver implements the `webhookd.WebhookReceiver` interface and returns `err`.
+type TestReceiver struct {
+	webhookd.WebhookReceiver
+	err *webhookd.WebhookError
+}
+
+func (r *TestReceiver) Receive(ctx context.Context, req *http.Request) ([]byte, *webhookd.WebhookError) {
+	return nil, r.err
+}
+
+// TestDispatcher implements the `webhookd.WebhookDispatcher` interface and returns `err`.
+type TestDispatcher struct {
+	webhookd.WebhookDispatcher
+	err *webhookd.WebhookError
+}
+
+func (d *TestDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+	return d.err
+}
+
+func scrape(t *testing.T) string {
+
+	rsp := httptest.NewRecorder()
+	Handler().ServeHTTP(rsp, httptest.NewRequest("GET", Path, nil))
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", rsp.Code)
+	}
+
+	body, _ := io.ReadAll(rsp.Body)
+	return string(body)
+}
+
+func TestInstrumented(t *testing.T) {
+
+	ctx := context.Background()
+
+	req := httptest.NewRequest("POST", "/metrics-test", nil)
+
+	NewInstrumentedReceiver("/metrics-test", "test", &TestReceiver{}).Receive(ctx, req)
+	NewInstrumentedReceiver("/metrics-test", "test", &TestReceiver{err: &webhookd.WebhookError{Code: webhookd.UnhandledEvent}}).Receive(ctx, req)
+
+	NewInstrumentedDispatcher("/metrics-test", "slack", "test", &TestDispatcher{err: &webhookd.WebhookError{Code: http.StatusBadGateway}}).Dispatch(ctx, nil)
+
+	EventReceived("/metrics-test")
+	EventProcessed("/metrics-test", OutcomeSucceeded)
+
+	out := scrape(t)
+
+	expected := []string{
+		`webhookd_receive_duration_seconds_count{endpoint="/metrics-test",outcome="ok",receiver="test"} 1`,
+		`webhookd_receive_duration_seconds_count{endpoint="/metrics-test",outcome="unhandled",receiver="test"} 1`,
+		`webhookd_dispatch_duration_seconds_count{dispatcher="slack",endpoint="/metrics-test",outcome="failed",scheme="test"} 1`,
+		`webhookd_events_received_total{endpoint="/metrics-test"} 1`,
+		`webhookd_events_total{endpoint="/metrics-test",outcome="succeeded"} 1`,
+	}
+
+	for _, line := range expected {
+
+		if !strings.Contains(out, line) {
+			t.Fatalf("Missing metric %s", line)
+		}
+	}
+}
+
+func TestQueueDepth(t *testing.T) {
+
+	if strings.Contains(scrape(t), "webhookd_queue_depth") {
+		t.Fatalf("Expected no queue depth without a queue")
+	}
+
+	SetQueueDepth(func() int { return 3 })
+	defer SetQueueDepth(nil)
+
+	if !strings.Contains(scrape(t), "webhookd_queue_depth 3") {
+		t.Fatalf("Expected queue depth of 3")
+	}
+}
+
+func TestScheme(t *testing.T) {
+
+	tests := map[string]string{
+		"hmac://github?secret_env=X": "hmac",
+		"https://example.com#auth=x": "https",
+		"":                           "unknown",
+	}
+
+	for uri, expected := range tests {
+
+		if Scheme(uri) != expected {
+			t.Fatalf("Unexpected scheme for '%s': %s", uri, Scheme(uri))
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/bobertrublik/webhook-router/internal/secret"
+)
+
+// DefaultAPIKeyHeader is the request header checked for an API key if none is configured.
+const DefaultAPIKeyHeader string = "X-API-Key"
+
+// NewAPIKeyMiddleware returns a `Middleware` that ensures requests carry one of the API keys defined by 'cfg'. The key
+// is removed from the request once it has been checked, so that it is not passed on with the message.
+func NewAPIKeyMiddleware(ctx context.Context, cfg *config.WebhookAPIKeyConfig) (Middleware, error) {
+
+	keys, err := secret.ReadList(cfg.KeyEnv, cfg.KeyFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read API keys, %w", err)
+	}
+
+	header := cfg.Header
+
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+
+	return func(next http.Handler) http.Handler {
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+
+			candidate := []byte(r.Header.Get(header))
+
+			// Compare against every key, rather than returning early, so that timing
+			// does not leak which (if any) key partially matched.
+
+			ok := 0
+
+			for _, k := range keys {
+				ok |= subtle.ConstantTimeCompare(candidate, []byte(k))
+			}
+
+			if len(candidate) == 0 || ok != 1 {
+				logger.FromContext(r.Context()).Warn("Invalid or missing API key", "path", r.URL.Path, "header", header)
+				writeAuthError(w, http.StatusUnauthorized, "Invalid API key.")
+				return
+			}
+
+			r.Header.Del(header)
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}, nil
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_API_KEYS", "old-key,new-key")
+
+	cfg := &config.WebhookAPIKeyConfig{
+		Header: "X-Token",
+		KeyEnv: "WEBHOOKD_TEST_API_KEYS",
+	}
+
+	mw, err := NewAPIKeyMiddleware(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create API key middleware, %v", err)
+	}
+
+	h := mw(okHandler)
+
+	tests := map[string]int{
+		"old-key": http.StatusOK,
+		"new-key": http.StatusOK,
+		"chicken": http.StatusUnauthorized,
+		"":        http.StatusUnauthorized,
+	}
+
+	for key, expected := range tests {
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		req.Header.Set("X-Token", key)
+
+		if code := serve(h, req); code != expected {
+			t.Fatalf("Unexpected status code for key '%s': %d", key, code)
+		}
+	}
+}
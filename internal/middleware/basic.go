@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/bobertrublik/webhook-router/internal/secret"
+)
+
+// NewBasicAuthMiddleware returns a `Middleware` that ensures requests carry the HTTP basic authentication credentials defined by 'cfg'.
+func NewBasicAuthMiddleware(ctx context.Context, cfg *config.WebhookBasicConfig) (Middleware, error) {
+
+	if cfg.Username == "" {
+		return nil, fmt.Errorf("Missing username")
+	}
+
+	password, err := secret.Read(cfg.PasswordEnv, cfg.PasswordFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read password, %w", err)
+	}
+
+	realm := cfg.Realm
+
+	if realm == "" {
+		realm = "webhookd"
+	}
+
+	// Hashing both sides means the constant time comparison is always between equal length values.
+	expectedUser := sha256.Sum256([]byte(cfg.Username))
+	expectedPassword := sha256.Sum256([]byte(password))
+
+	return func(next http.Handler) http.Handler {
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+
+			user, pswd, ok := r.BasicAuth()
+
+			if ok {
+				u := sha256.Sum256([]byte(user))
+				p := sha256.Sum256([]byte(pswd))
+
+				userOk := subtle.ConstantTimeCompare(u[:], expectedUser[:])
+				pswdOk := subtle.ConstantTimeCompare(p[:], expectedPassword[:])
+
+				ok = userOk&pswdOk == 1
+			}
+
+			if !ok {
+				logger.FromContext(r.Context()).Warn("Invalid or missing basic auth credentials", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, realm))
+				writeAuthError(w, http.StatusUnauthorized, "Invalid credentials.")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}, nil
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+)
+
+func TestBasicAuthMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_PASSWORD", "s3cr3t")
+
+	cfg := &config.WebhookBasicConfig{
+		Username:    "azure",
+		PasswordEnv: "WEBHOOKD_TEST_PASSWORD",
+	}
+
+	mw, err := NewBasicAuthMiddleware(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create basic auth middleware, %v", err)
+	}
+
+	h := mw(okHandler)
+
+	req := httptest.NewRequest("POST", "/test", nil)
+	req.SetBasicAuth("azure", "s3cr3t")
+
+	if code := serve(h, req); code != http.StatusOK {
+		t.Fatalf("Unexpected status code for valid credentials: %d", code)
+	}
+
+	req = httptest.NewRequest("POST", "/test", nil)
+	req.SetBasicAuth("azure", "chicken")
+
+	if code := serve(h, req); code != http.StatusUnauthorized {
+		t.Fatalf("Unexpected status code for invalid credentials: %d", code)
+	}
+
+	req = httptest.NewRequest("POST", "/test", nil)
+
+	if code := serve(h, req); code != http.StatusUnauthorized {
+		t.Fatalf("Unexpected status code for missing credentials: %d", code)
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
@@ -12,6 +13,8 @@ import (
 	"github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/jwks"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/logger"
 )
 
 // CustomClaims contains custom data we want from the token.
@@ -37,45 +40,157 @@ func (c CustomClaims) HasScope(expectedScope string) bool {
 	return false
 }
 
-// EnsureValidToken is a middleware that will check the validity of our JWT.
+// EnsureValidToken is a middleware that will check the validity of our JWT using the Auth0 tenant defined
+// by the AUTH0_DOMAIN and AUTH0_AUDIENCE environment variables.
 func EnsureValidToken() func(next http.Handler) http.Handler {
-	issuerURL, err := url.Parse("https://" + os.Getenv("AUTH0_DOMAIN") + "/")
+
+	mw, err := NewJWTMiddleware(context.Background(), defaultJWTConfig())
+
 	if err != nil {
-		log.Fatalf("Failed to parse the issuer url: %v", err)
+		log.Fatalf("Failed to set up the jwt validator, %v", err)
 	}
 
-	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
-
-	jwtValidator, err := validator.New(
-		provider.KeyFunc,
-		validator.RS256,
-		issuerURL.String(),
-		[]string{os.Getenv("AUTH0_AUDIENCE")},
-		validator.WithCustomClaims(
-			func() validator.CustomClaims {
-				return &CustomClaims{}
-			},
-		),
-		validator.WithAllowedClockSkew(time.Minute),
-	)
+	return mw
+}
+
+// defaultJWTConfig returns a `config.WebhookJWTConfig` derived from the AUTH0_DOMAIN and AUTH0_AUDIENCE environment variables.
+func defaultJWTConfig() *config.WebhookJWTConfig {
+
+	return &config.WebhookJWTConfig{
+		Issuer:   "https://" + os.Getenv("AUTH0_DOMAIN") + "/",
+		Audience: []string{os.Getenv("AUTH0_AUDIENCE")},
+	}
+}
+
+// NewJWTMiddleware returns a `Middleware` that checks the validity of a JWT passed in the "Authorization" header
+// against the issuer, audience and algorithms defined in 'cfg' and ensures that all of the scopes listed in 'cfg'
+// are present in the token.
+func NewJWTMiddleware(ctx context.Context, cfg *config.WebhookJWTConfig) (Middleware, error) {
+
+	issuerURL, err := url.Parse(cfg.Issuer)
+
 	if err != nil {
-		log.Fatalf("Failed to set up the jwt validator")
+		return nil, fmt.Errorf("Failed to parse the issuer url, %w", err)
 	}
 
-	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
-		log.Printf("Encountered error while validating JWT: %v", err)
+	var providerOpts []jwks.ProviderOption
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"message":"Failed to validate JWT."}`))
+	if cfg.JWKSURI != "" {
+
+		jwksURI, err := url.Parse(cfg.JWKSURI)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse the JWKS url, %w", err)
+		}
+
+		providerOpts = append(providerOpts, jwks.WithCustomJWKSURI(jwksURI))
+	}
+
+	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute, providerOpts...)
+
+	algorithms := cfg.Algorithms
+
+	if len(algorithms) == 0 {
+		algorithms = []string{string(validator.RS256)}
+	}
+
+	validators := make([]*validator.Validator, len(algorithms))
+
+	for idx, alg := range algorithms {
+
+		v, err := validator.New(
+			provider.KeyFunc,
+			validator.SignatureAlgorithm(alg),
+			issuerURL.String(),
+			cfg.Audience,
+			validator.WithCustomClaims(
+				func() validator.CustomClaims {
+					return &CustomClaims{}
+				},
+			),
+			validator.WithAllowedClockSkew(time.Minute),
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to set up the jwt validator for '%s', %w", alg, err)
+		}
+
+		validators[idx] = v
+	}
+
+	// Each validator only accepts a single signature algorithm so try them all and
+	// return the first successful result.
+
+	validateToken := func(ctx context.Context, token string) (interface{}, error) {
+
+		var lastErr error
+
+		for _, v := range validators {
+
+			claims, err := v.ValidateToken(ctx, token)
+
+			if err == nil {
+				return claims, nil
+			}
+
+			lastErr = err
+		}
+
+		return nil, lastErr
+	}
+
+	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.FromContext(r.Context()).Warn("Encountered error while validating JWT", "path", r.URL.Path, "error", err)
+		writeAuthError(w, http.StatusUnauthorized, "Failed to validate JWT.")
 	}
 
 	middleware := jwtmiddleware.New(
-		jwtValidator.ValidateToken,
+		validateToken,
 		jwtmiddleware.WithErrorHandler(errorHandler),
 	)
 
+	scopes := cfg.Scopes
+
 	return func(next http.Handler) http.Handler {
-		return middleware.CheckJWT(next)
+		return middleware.CheckJWT(ensureScopes(scopes, next))
+	}, nil
+}
+
+// ensureScopes returns a `http.Handler` that ensures the validated JWT claims in a request's context
+// contain all of 'scopes' before handing the request to 'next'.
+func ensureScopes(scopes []string, next http.Handler) http.Handler {
+
+	if len(scopes) == 0 {
+		return next
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+
+		claims, ok := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+
+		if !ok {
+			writeAuthError(w, http.StatusUnauthorized, "Failed to validate JWT.")
+			return
+		}
+
+		custom, ok := claims.CustomClaims.(*CustomClaims)
+
+		if !ok {
+			writeAuthError(w, http.StatusForbidden, "Insufficient scope.")
+			return
+		}
+
+		for _, s := range scopes {
+
+			if !custom.HasScope(s) {
+				logger.FromContext(r.Context()).Warn("JWT is missing required scope", "path", r.URL.Path, "scope", s)
+				writeAuthError(w, http.StatusForbidden, "Insufficient scope.")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
 	}
+
+	return http.HandlerFunc(fn)
 }
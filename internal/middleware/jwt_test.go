@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+)
+
+func TestJWTMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatalf("Failed to generate key, %v", err)
+	}
+
+	jwk := jose.JSONWebKey{
+		Key:       key.Public(),
+		KeyID:     "test",
+		Algorithm: "RS256",
+		Use:       "sig",
+	}
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk}})
+	}))
+
+	defer jwks.Close()
+
+	issuer := jwks.URL + "/"
+
+	cfg := &config.WebhookJWTConfig{
+		Issuer:     issuer,
+		Audience:   []string{"webhookd"},
+		Algorithms: []string{"RS256"},
+		Scopes:     []string{"write:alerts"},
+		JWKSURI:    jwks.URL + "/.well-known/jwks.json",
+	}
+
+	mw, err := NewJWTMiddleware(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create JWT middleware, %v", err)
+	}
+
+	h := mw(okHandler)
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+
+	if err != nil {
+		t.Fatalf("Failed to create signer, %v", err)
+	}
+
+	newToken := func(scope string) string {
+
+		claims := jwt.Claims{
+			Issuer:   issuer,
+			Audience: jwt.Audience{"webhookd"},
+			Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		}
+
+		token, err := jwt.Signed(signer).Claims(claims).Claims(CustomClaims{Scope: scope}).CompactSerialize()
+
+		if err != nil {
+			t.Fatalf("Failed to sign token, %v", err)
+		}
+
+		return token
+	}
+
+	tests := map[string]int{
+		newToken("read:alerts write:alerts"): http.StatusOK,
+		newToken("read:alerts"):              http.StatusForbidden,
+		"chicken":                            http.StatusUnauthorized,
+	}
+
+	for token, expected := range tests {
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		if code := serve(h, req); code != expected {
+			t.Fatalf("Unexpected status code: %d (expected %d)", code, expected)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/test", nil)
+
+	if code := serve(h, req); code != http.StatusUnauthorized {
+		t.Fatalf("Unexpected status code for missing token: %d", code)
+	}
+}
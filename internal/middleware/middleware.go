@@ -0,0 +1,90 @@
+// Package middleware provides `http.Handler` wrappers that are applied to individual webhook endpoints.
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+)
+
+// Middleware is a function that wraps a `http.Handler` instance with additional behaviour.
+type Middleware func(next http.Handler) http.Handler
+
+// Chain returns a new `Middleware` that applies 'mw' in the order they are listed, meaning the first element
+// of 'mw' is the outermost handler.
+func Chain(mw ...Middleware) Middleware {
+
+	return func(next http.Handler) http.Handler {
+
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+
+		return next
+	}
+}
+
+// NewAuthMiddleware returns the `Middleware` instances required to enforce the authentication policy 'cfg'.
+// An empty or "none" mode returns no middleware at all.
+func NewAuthMiddleware(ctx context.Context, cfg config.WebhookAuthConfig) ([]Middleware, error) {
+
+	var mw Middleware
+	var err error
+
+	switch cfg.Mode {
+	case "", "none":
+		return nil, nil
+	case "jwt":
+
+		jwtCfg := cfg.JWT
+
+		// Fall back to the AUTH0_DOMAIN and AUTH0_AUDIENCE environment variables for
+		// configs that simply say `auth: jwt`.
+
+		if jwtCfg == nil {
+			jwtCfg = defaultJWTConfig()
+		}
+
+		mw, err = NewJWTMiddleware(ctx, jwtCfg)
+
+	case "api-key":
+
+		if cfg.APIKey == nil {
+			return nil, fmt.Errorf("Missing api_key settings for auth mode 'api-key'")
+		}
+
+		mw, err = NewAPIKeyMiddleware(ctx, cfg.APIKey)
+
+	case "basic":
+
+		if cfg.Basic == nil {
+			return nil, fmt.Errorf("Missing basic settings for auth mode 'basic'")
+		}
+
+		mw, err = NewBasicAuthMiddleware(ctx, cfg.Basic)
+
+	default:
+		return nil, fmt.Errorf("Invalid auth mode '%s'", cfg.Mode)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create '%s' auth middleware, %w", cfg.Mode, err)
+	}
+
+	return []Middleware{mw}, nil
+}
+
+// writeAuthError writes a JSON-encoded error message and 'status' to 'w'.
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+
+	rsp := map[string]string{
+		"message": message,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rsp)
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+)
+
+// okHandler is a `http.Handler` that always returns 200 OK.
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// serve sends 'req' to 'h' and returns the resulting status code.
+func serve(h http.Handler, req *http.Request) int {
+	rsp := httptest.NewRecorder()
+	h.ServeHTTP(rsp, req)
+	return rsp.Code
+}
+
+func TestChain(t *testing.T) {
+
+	order := make([]string, 0)
+
+	mw := func(label string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, label)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	h := Chain(mw("a"), mw("b"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}))
+
+	req := httptest.NewRequest("POST", "/test", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	expected := []string{"a", "b", "handler"}
+
+	if len(order) != len(expected) {
+		t.Fatalf("Unexpected order: %v", order)
+	}
+
+	for i, v := range expected {
+		if order[i] != v {
+			t.Fatalf("Unexpected order: %v", order)
+		}
+	}
+}
+
+func TestNewAuthMiddleware(t *testing.T) {
+
+	ctx := context.Background()
+
+	mw, err := NewAuthMiddleware(ctx, config.WebhookAuthConfig{Mode: "none"})
+
+	if err != nil {
+		t.Fatalf("Failed to create middleware for 'none', %v", err)
+	}
+
+	if len(mw) != 0 {
+		t.Fatalf("Expected no middleware for 'none'")
+	}
+
+	_, err = NewAuthMiddleware(ctx, config.WebhookAuthConfig{Mode: "chicken"})
+
+	if err == nil {
+		t.Fatalf("Expected invalid auth mode to fail")
+	}
+
+	_, err = NewAuthMiddleware(ctx, config.WebhookAuthConfig{Mode: "basic"})
+
+	if err == nil {
+		t.Fatalf("Expected basic auth mode without settings to fail")
+	}
+}
@@ -0,0 +1,617 @@
+// Package queue provides a durable, file-backed queue used to deliver webhook messages asynchronously.
+//
+// Every message is appended to an append-only log file before it is acknowledged to the sender. Messages are
+// removed from the log once they have been processed so any message still in the log when the daemon restarts
+// is processed again, giving at-least-once delivery semantics.
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/bobertrublik/webhook-router/internal/tracing"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// LogFilename is the name of the log file created in a queue's directory.
+const LogFilename string = "queue.log"
+
+// RetryDelay is the time to wait before processing an entry again after its `HandlerFunc` returned an error.
+var RetryDelay time.Duration = 30 * time.Second
+
+// CompactAfter is the number of acknowledgements after which a queue's log file is compacted, so that it does not grow
+// without bound while there are always entries outstanding.
+var CompactAfter int = 1000
+
+// CompactSize is the size, in bytes, of a queue's log file above which it is compacted on the next acknowledgement.
+var CompactSize int64 = 64 * 1024 * 1024
+
+// ErrClosed is returned when operating on a `Queue` that has been closed.
+var ErrClosed = errors.New("queue is closed")
+
+// writeLog writes 'b' to the queue's log file 'fh'. It is a variable so that tests can simulate failed writes.
+var writeLog = func(fh *os.File, b []byte) (int, error) {
+	return fh.Write(b)
+}
+
+const (
+	opEnqueue string = "enqueue"
+	opAck     string = "ack"
+)
+
+// type Entry is a struct containing a single queued webhook message.
+type Entry struct {
+	// ID is the unique identifier for the entry.
+	ID string `json:"id"`
+	// Endpoint is the relative URI of the webhook the message was received by.
+	Endpoint string `json:"endpoint"`
+	// Body is the (transformed) body of the message to dispatch.
+	Body []byte `json:"body"`
+	// Header contains the headers of the request the message was received in.
+	Header http.Header `json:"header,omitempty"`
+	// Metadata contains the metadata of the message.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Created is the time the entry was added to the queue.
+	Created time.Time `json:"created"`
+	// Trace contains the W3C trace context headers of the request the message was received by, if any.
+	Trace map[string]string `json:"trace,omitempty"`
+}
+
+// Message returns the `webhookd.Message` stored in 'e'.
+func (e *Entry) Message() *webhookd.Message {
+
+	msg := webhookd.NewMessage(e.Body)
+
+	if e.Header != nil {
+		msg.Header = e.Header
+	}
+
+	if e.Metadata != nil {
+		msg.Metadata = e.Metadata
+	}
+
+	return msg
+}
+
+// record is a single line in a queue's log file.
+type record struct {
+	Op    string `json:"op"`
+	ID    string `json:"id,omitempty"`
+	Entry *Entry `json:"entry,omitempty"`
+}
+
+// HandlerFunc is a function used to process a queued `Entry`. It returns nil once the entry has been dealt with, for
+// example delivered or stored as a dead letter, and can be acknowledged. Otherwise the entry is processed again later.
+type HandlerFunc func(ctx context.Context, e *Entry) error
+
+// type Queue is a struct that implements a durable, file-backed FIFO queue.
+type Queue struct {
+	path     string
+	mu       sync.Mutex
+	fh       *os.File
+	pending  []*Entry
+	inflight map[string]*Entry
+	ready    chan struct{}
+	closed   bool
+	seq      uint64
+	// acks is the number of entries acknowledged since the log file was last compacted.
+	acks int
+}
+
+// Open returns a new `Queue` instance whose log file is stored in the directory 'root'. Any entries left
+// in an existing log file which were never acknowledged are queued again.
+func Open(root string) (*Queue, error) {
+
+	err := os.MkdirAll(root, 0700)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create queue directory, %w", err)
+	}
+
+	path := filepath.Join(root, LogFilename)
+
+	pending, err := replay(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to replay queue log, %w", err)
+	}
+
+	err = compact(path, pending)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compact queue log, %w", err)
+	}
+
+	fh, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open queue log, %w", err)
+	}
+
+	q := &Queue{
+		path:     path,
+		fh:       fh,
+		pending:  pending,
+		inflight: make(map[string]*Entry),
+		ready:    make(chan struct{}, 1),
+	}
+
+	if len(pending) > 0 {
+		logger.Log.Info("Replaying unacknowledged queue entries", "path", path, "count", len(pending))
+		q.notify()
+	}
+
+	return q, nil
+}
+
+// Enqueue durably appends a new entry for 'msg', received by 'endpoint', to the queue and returns it.
+func (q *Queue) Enqueue(ctx context.Context, endpoint string, msg *webhookd.Message) (*Entry, error) {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, ErrClosed
+	}
+
+	now := time.Now()
+	q.seq += 1
+
+	e := &Entry{
+		ID:       fmt.Sprintf("%d-%d", now.UnixNano(), q.seq),
+		Endpoint: endpoint,
+		Body:     msg.Body,
+		Header:   msg.Header,
+		Metadata: msg.Metadata,
+		Created:  now,
+		Trace:    tracing.Inject(ctx),
+	}
+
+	err := q.append(&record{Op: opEnqueue, Entry: e})
+
+	if err != nil {
+		return nil, err
+	}
+
+	q.pending = append(q.pending, e)
+	q.notify()
+
+	return e, nil
+}
+
+// Ack marks the entry with 'id' as processed so that it will not be replayed.
+func (q *Queue) Ack(id string) error {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	_, ok := q.inflight[id]
+
+	if !ok {
+		return fmt.Errorf("Unknown entry '%s'", id)
+	}
+
+	err := q.append(&record{Op: opAck, ID: id})
+
+	if err != nil {
+		return err
+	}
+
+	delete(q.inflight, id)
+	q.acks += 1
+
+	// Once nothing is outstanding there is nothing to replay, so the log can be emptied
+	// rather than letting it grow forever.
+
+	if len(q.pending) == 0 && len(q.inflight) == 0 {
+
+		err := q.fh.Truncate(0)
+
+		if err != nil {
+			return fmt.Errorf("Failed to truncate queue log, %w", err)
+		}
+
+		q.acks = 0
+		return nil
+	}
+
+	// Under steady traffic there is always something outstanding, so the log is also compacted
+	// periodically. The entry has been acknowledged either way, so failing to compact is not an error.
+
+	if q.acks < CompactAfter {
+
+		info, err := q.fh.Stat()
+
+		if err != nil || info.Size() < CompactSize {
+			return nil
+		}
+	}
+
+	err = q.rewrite()
+
+	if err != nil {
+		logger.Log.Warn("Failed to compact queue log", "path", q.path, "error", err)
+	}
+
+	return nil
+}
+
+// rewrite replaces the queue's log file with one containing only the entries which are waiting to be, or are
+// currently being, processed and reopens it. Callers must hold 'q.mu'.
+func (q *Queue) rewrite() error {
+
+	outstanding := make([]*Entry, 0, len(q.inflight)+len(q.pending))
+
+	for _, e := range q.inflight {
+		outstanding = append(outstanding, e)
+	}
+
+	// In-flight entries were dequeued before any pending ones, so they are written first, in the order they were created.
+
+	sort.Slice(outstanding, func(i, j int) bool {
+		return outstanding[i].Created.Before(outstanding[j].Created)
+	})
+
+	outstanding = append(outstanding, q.pending...)
+
+	err := compact(q.path, outstanding)
+
+	if err != nil {
+		return err
+	}
+
+	fh, err := os.OpenFile(q.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+
+	if err != nil {
+		return fmt.Errorf("Failed to reopen queue log, %w", err)
+	}
+
+	q.fh.Close()
+
+	q.fh = fh
+	q.acks = 0
+
+	return nil
+}
+
+// Retry returns the in-flight entry with 'id' to the end of the queue after 'delay', so that it is processed again. It
+// stays in the log file, and is replayed if the queue is closed in the meantime.
+func (q *Queue) Retry(id string, delay time.Duration) error {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	_, ok := q.inflight[id]
+
+	if !ok {
+		return fmt.Errorf("Unknown entry '%s'", id)
+	}
+
+	time.AfterFunc(delay, func() {
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		e, ok := q.inflight[id]
+
+		if q.closed || !ok {
+			return
+		}
+
+		delete(q.inflight, id)
+
+		q.pending = append(q.pending, e)
+		q.notify()
+	})
+
+	return nil
+}
+
+// Next blocks until an entry is available, or 'ctx' is cancelled, and returns it. The entry must be
+// passed to `Ack` once it has been processed, or to `Retry` if it could not be.
+func (q *Queue) Next(ctx context.Context) (*Entry, error) {
+
+	for {
+
+		q.mu.Lock()
+
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrClosed
+		}
+
+		if len(q.pending) > 0 {
+
+			e := q.pending[0]
+			q.pending = q.pending[1:]
+			q.inflight[e.ID] = e
+
+			if len(q.pending) > 0 {
+				q.notify()
+			}
+
+			q.mu.Unlock()
+			return e, nil
+		}
+
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.ready:
+			// pass
+		}
+	}
+}
+
+// Depth returns the number of entries that are waiting to be, or are currently being, processed.
+func (q *Queue) Depth() int {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending) + len(q.inflight)
+}
+
+// Run starts 'workers' goroutines that pass each entry in the queue to 'fn'. Entries are acknowledged if 'fn' returns
+// nil and retried after `RetryDelay` otherwise. It blocks until 'ctx' is cancelled and every worker has finished
+// processing its current entry. Entries are processed with 'ctx', so cancelling it interrupts them too; an entry
+// interrupted this way is left in the log and processed again the next time the queue is opened.
+func (q *Queue) Run(ctx context.Context, workers int, fn HandlerFunc) {
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			for {
+
+				e, err := q.Next(ctx)
+
+				if err != nil {
+					return
+				}
+
+				err = fn(ctx, e)
+
+				if err != nil {
+
+					logger.Log.Warn("Failed to process queue entry, retrying later", "id", e.ID, "delay", RetryDelay, "error", err)
+
+					err = q.Retry(e.ID, RetryDelay)
+
+					if err != nil && !errors.Is(err, ErrClosed) {
+						logger.Log.Error("Failed to retry queue entry", "id", e.ID, "error", err)
+					}
+
+					continue
+				}
+
+				err = q.Ack(e.ID)
+
+				if err != nil {
+					logger.Log.Error("Failed to acknowledge queue entry", "id", e.ID, "error", err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Close closes the queue's log file. Unacknowledged entries will be replayed the next time the queue is opened.
+func (q *Queue) Close() error {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	q.closed = true
+	return q.fh.Close()
+}
+
+// append writes 'r' to the queue's log file and flushes it to disk. If that fails the log is truncated back to its
+// previous size, so that a partially written record isn't joined with the next one and both lost on replay. Callers
+// must hold 'q.mu'.
+func (q *Queue) append(r *record) error {
+
+	enc, err := json.Marshal(r)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode queue record, %w", err)
+	}
+
+	enc = append(enc, '\n')
+
+	info, err := q.fh.Stat()
+
+	if err != nil {
+		return fmt.Errorf("Failed to stat queue log, %w", err)
+	}
+
+	size := info.Size()
+
+	_, err = writeLog(q.fh, enc)
+
+	if err != nil {
+		return q.rollback(size, fmt.Errorf("Failed to write queue record, %w", err))
+	}
+
+	err = q.fh.Sync()
+
+	if err != nil {
+		return q.rollback(size, fmt.Errorf("Failed to sync queue log, %w", err))
+	}
+
+	return nil
+}
+
+// rollback truncates the queue's log file to 'size', discarding a record that failed to be written, and returns 'err'
+// along with any error truncating the file. The log is opened for appending so later records are written from the new
+// end of the file. Callers must hold 'q.mu'.
+func (q *Queue) rollback(size int64, err error) error {
+
+	trunc_err := q.fh.Truncate(size)
+
+	if trunc_err != nil {
+		return errors.Join(err, fmt.Errorf("Failed to truncate queue log, %w", trunc_err))
+	}
+
+	return err
+}
+
+// notify wakes up a single worker waiting in `Next`.
+func (q *Queue) notify() {
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// replay reads the log file at 'path' and returns the list of entries that were enqueued but never acknowledged.
+func replay(path string) ([]*Entry, error) {
+
+	fh, err := os.Open(path)
+
+	if err != nil {
+
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer fh.Close()
+
+	entries := make([]*Entry, 0)
+	acked := make(map[string]bool)
+
+	br := bufio.NewReader(fh)
+
+	for {
+
+		line, err := br.ReadBytes('\n')
+
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if len(line) > 0 {
+
+			var r record
+
+			// A partial line can only be the result of a crash mid-write, before the
+			// sender was told the message was accepted, so it is safe to skip.
+
+			if dec_err := json.Unmarshal(line, &r); dec_err != nil {
+				logger.Log.Warn("Skipping corrupt queue record", "path", path, "error", dec_err)
+			} else {
+
+				switch r.Op {
+				case opEnqueue:
+					if r.Entry != nil {
+						entries = append(entries, r.Entry)
+					}
+				case opAck:
+					acked[r.ID] = true
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	pending := make([]*Entry, 0, len(entries))
+
+	for _, e := range entries {
+
+		if !acked[e.ID] {
+			pending = append(pending, e)
+		}
+	}
+
+	return pending, nil
+}
+
+// compact atomically replaces the log file at 'path' with one containing only 'pending'.
+func compact(path string, pending []*Entry) error {
+
+	tmp := path + ".tmp"
+
+	fh, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(fh)
+	enc := json.NewEncoder(bw)
+
+	for _, e := range pending {
+
+		err := enc.Encode(&record{Op: opEnqueue, Entry: e})
+
+		if err != nil {
+			fh.Close()
+			return err
+		}
+	}
+
+	err = bw.Flush()
+
+	if err != nil {
+		fh.Close()
+		return err
+	}
+
+	err = fh.Sync()
+
+	if err != nil {
+		fh.Close()
+		return err
+	}
+
+	err = fh.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,374 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func TestQueueReplay(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	q, err := Open(root)
+
+	if err != nil {
+		t.Fatalf("Failed to open queue, %v", err)
+	}
+
+	for _, body := range []string{"one", "two", "three"} {
+
+		msg := webhookd.NewMessage([]byte(body))
+		msg.Metadata[webhookd.MetadataEventType] = body
+
+		_, err := q.Enqueue(ctx, "/test", msg)
+
+		if err != nil {
+			t.Fatalf("Failed to enqueue '%s', %v", body, err)
+		}
+	}
+
+	e, err := q.Next(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to get next entry, %v", err)
+	}
+
+	if string(e.Body) != "one" {
+		t.Fatalf("Unexpected body '%s'", string(e.Body))
+	}
+
+	err = q.Ack(e.ID)
+
+	if err != nil {
+		t.Fatalf("Failed to ack entry, %v", err)
+	}
+
+	// Take, but do not acknowledge, the second entry to simulate a crash mid-delivery.
+
+	_, err = q.Next(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to get next entry, %v", err)
+	}
+
+	err = q.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close queue, %v", err)
+	}
+
+	q, err = Open(root)
+
+	if err != nil {
+		t.Fatalf("Failed to reopen queue, %v", err)
+	}
+
+	defer q.Close()
+
+	if q.Depth() != 2 {
+		t.Fatalf("Unexpected queue depth after replay: %d", q.Depth())
+	}
+
+	for _, expected := range []string{"two", "three"} {
+
+		e, err := q.Next(ctx)
+
+		if err != nil {
+			t.Fatalf("Failed to get next entry, %v", err)
+		}
+
+		if string(e.Body) != expected {
+			t.Fatalf("Unexpected body '%s', expected '%s'", string(e.Body), expected)
+		}
+
+		if e.Message().Get(webhookd.MetadataEventType) != expected {
+			t.Fatalf("Unexpected metadata after replay %v", e.Metadata)
+		}
+
+		err = q.Ack(e.ID)
+
+		if err != nil {
+			t.Fatalf("Failed to ack entry, %v", err)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(root, LogFilename))
+
+	if err != nil {
+		t.Fatalf("Failed to stat queue log, %v", err)
+	}
+
+	if info.Size() != 0 {
+		t.Fatalf("Expected empty queue log to be truncated, size is %d", info.Size())
+	}
+}
+
+func TestQueueCompact(t *testing.T) {
+
+	ctx := context.Background()
+
+	compact_after := CompactAfter
+	CompactAfter = 2
+
+	defer func() {
+		CompactAfter = compact_after
+	}()
+
+	root := t.TempDir()
+
+	q, err := Open(root)
+
+	if err != nil {
+		t.Fatalf("Failed to open queue, %v", err)
+	}
+
+	for _, body := range []string{"a", "b", "c", "d", "e"} {
+
+		_, err := q.Enqueue(ctx, "/test", webhookd.NewMessage([]byte(body)))
+
+		if err != nil {
+			t.Fatalf("Failed to enqueue '%s', %v", body, err)
+		}
+	}
+
+	// Leave "b" in flight so the log is never empty, like it would be under steady traffic.
+
+	for i, ack := range []bool{true, false, true} {
+
+		e, err := q.Next(ctx)
+
+		if err != nil {
+			t.Fatalf("Failed to get entry %d, %v", i, err)
+		}
+
+		if !ack {
+			continue
+		}
+
+		err = q.Ack(e.ID)
+
+		if err != nil {
+			t.Fatalf("Failed to ack entry %d, %v", i, err)
+		}
+	}
+
+	pending, err := replay(filepath.Join(root, LogFilename))
+
+	if err != nil {
+		t.Fatalf("Failed to read queue log, %v", err)
+	}
+
+	body, err := os.ReadFile(filepath.Join(root, LogFilename))
+
+	if err != nil {
+		t.Fatalf("Failed to read queue log, %v", err)
+	}
+
+	if len(pending) != 3 || strings.Count(string(body), "\n") != 3 {
+		t.Fatalf("Expected queue log to be compacted to 3 entries, got %s", body)
+	}
+
+	err = q.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close queue, %v", err)
+	}
+
+	q, err = Open(root)
+
+	if err != nil {
+		t.Fatalf("Failed to reopen queue, %v", err)
+	}
+
+	defer q.Close()
+
+	for _, expected := range []string{"b", "d", "e"} {
+
+		e, err := q.Next(ctx)
+
+		if err != nil {
+			t.Fatalf("Failed to get next entry, %v", err)
+		}
+
+		if string(e.Body) != expected {
+			t.Fatalf("Unexpected body '%s', expected '%s'", string(e.Body), expected)
+		}
+	}
+}
+
+func TestQueuePartialWrite(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	q, err := Open(root)
+
+	if err != nil {
+		t.Fatalf("Failed to open queue, %v", err)
+	}
+
+	_, err = q.Enqueue(ctx, "/test", webhookd.NewMessage([]byte("one")))
+
+	if err != nil {
+		t.Fatalf("Failed to enqueue message, %v", err)
+	}
+
+	// Write half of the next record before failing, like a full disk would.
+
+	write_log := writeLog
+
+	writeLog = func(fh *os.File, b []byte) (int, error) {
+		n, _ := fh.Write(b[:len(b)/2])
+		return n, fmt.Errorf("No space left on device")
+	}
+
+	_, err = q.Enqueue(ctx, "/test", webhookd.NewMessage([]byte("two")))
+
+	writeLog = write_log
+
+	if err == nil {
+		t.Fatalf("Expected failed write to fail enqueueing")
+	}
+
+	_, err = q.Enqueue(ctx, "/test", webhookd.NewMessage([]byte("three")))
+
+	if err != nil {
+		t.Fatalf("Failed to enqueue message, %v", err)
+	}
+
+	err = q.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close queue, %v", err)
+	}
+
+	q, err = Open(root)
+
+	if err != nil {
+		t.Fatalf("Failed to reopen queue, %v", err)
+	}
+
+	defer q.Close()
+
+	for _, expected := range []string{"one", "three"} {
+
+		e, err := q.Next(ctx)
+
+		if err != nil {
+			t.Fatalf("Failed to get next entry, %v", err)
+		}
+
+		if string(e.Body) != expected {
+			t.Fatalf("Unexpected body '%s', expected '%s'", string(e.Body), expected)
+		}
+	}
+
+	if q.Depth() != 2 {
+		t.Fatalf("Unexpected queue depth after replay: %d", q.Depth())
+	}
+}
+
+func TestQueueCorruptRecord(t *testing.T) {
+
+	root := t.TempDir()
+	path := filepath.Join(root, LogFilename)
+
+	log := `{"op":"enqueue","entry":{"id":"1","endpoint":"/test","body":"aGVsbG8="}}
+{"op":"enqueue","entry":{"id":"2","endp`
+
+	err := os.WriteFile(path, []byte(log), 0600)
+
+	if err != nil {
+		t.Fatalf("Failed to write queue log, %v", err)
+	}
+
+	q, err := Open(root)
+
+	if err != nil {
+		t.Fatalf("Failed to open queue, %v", err)
+	}
+
+	defer q.Close()
+
+	if q.Depth() != 1 {
+		t.Fatalf("Unexpected queue depth: %d", q.Depth())
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := Open(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("Failed to open queue, %v", err)
+	}
+
+	defer q.Close()
+
+	retry_delay := RetryDelay
+	RetryDelay = 10 * time.Millisecond
+
+	defer func() {
+		RetryDelay = retry_delay
+	}()
+
+	mu := new(sync.Mutex)
+	seen := make(map[string]bool)
+	failed := false
+
+	done := make(chan struct{})
+
+	go func() {
+		q.Run(ctx, 2, func(ctx context.Context, e *Entry) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			// Fail the first attempt to deliver "c", which should be retried.
+
+			if string(e.Body) == "c" && !failed {
+				failed = true
+				return fmt.Errorf("Failed to deliver")
+			}
+
+			seen[string(e.Body)] = true
+			return nil
+		})
+		close(done)
+	}()
+
+	for _, body := range []string{"a", "b", "c", "d"} {
+		q.Enqueue(ctx, "/test", webhookd.NewMessage([]byte(body)))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for q.Depth() > 0 {
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for queue to drain")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	if len(seen) != 4 || !failed {
+		t.Fatalf("Unexpected number of processed entries: %d", len(seen))
+	}
+}
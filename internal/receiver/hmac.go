@@ -0,0 +1,268 @@
+package receiver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bobertrublik/webhook-router/internal/secret"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterReceiver(ctx, "hmac", NewHMACReceiver)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+const (
+	// HMACProviderGitHub verifies the "X-Hub-Signature-256" header sent by GitHub.
+	HMACProviderGitHub string = "github"
+	// HMACProviderGitLab verifies the "X-Gitlab-Token" header sent by GitLab.
+	HMACProviderGitLab string = "gitlab"
+	// HMACProviderGeneric verifies a signature in a configurable header, using a configurable algorithm and encoding.
+	HMACProviderGeneric string = "generic"
+)
+
+// HMACReceiver implements the `webhookd.WebhookReceiver` interface for receiving webhook messages whose provenance
+// is established by a shared secret.
+type HMACReceiver struct {
+	webhookd.WebhookReceiver
+	// provider is one of the `HMACProvider*` constants.
+	provider string
+	// secret is the shared secret used to sign (or, for GitLab, authenticate) messages.
+	secret []byte
+	// header is the name of the header containing the signature or token.
+	header string
+	// prefix is the string that precedes the signature in 'header', for example "sha256=".
+	prefix string
+	// hash is the function used to compute signatures.
+	hash func() hash.Hash
+	// encoding is the encoding of the signature, either "hex" or "base64".
+	encoding string
+	// eventHeader is the name of the header containing the event type, if any.
+	eventHeader string
+	// pingEvent is the value of `eventHeader` which signals a ping message, if any.
+	pingEvent string
+}
+
+// NewHMACReceiver returns a new `HMACReceiver` instance configured by 'uri' in the form of:
+//
+//	hmac://{PROVIDER}?secret_env={ENV}
+//	hmac://{PROVIDER}?secret_file={PATH}
+//
+// Where {PROVIDER} is one of "github", "gitlab" or "generic". The secret is always read from an environment variable
+// or a file and never from the URI itself. The "generic" provider also accepts the following parameters:
+//
+//   - header: The header containing the signature. Default is "X-Signature".
+//   - algorithm: One of "sha1", "sha256" (default) or "sha512".
+//   - encoding: One of "hex" (default) or "base64".
+//   - prefix: An optional prefix preceding the signature, for example "sha256=".
+//   - event_header, ping_event: An optional header, and value, used to identify ping messages.
+func NewHMACReceiver(ctx context.Context, uri string) (webhookd.WebhookReceiver, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	if q.Has("secret") {
+		return nil, fmt.Errorf("Inline secrets are not supported, use secret_env or secret_file instead")
+	}
+
+	s, err := secret.Read(q.Get("secret_env"), q.Get("secret_file"))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read secret, %w", err)
+	}
+
+	wh := HMACReceiver{
+		provider: u.Host,
+		secret:   []byte(s),
+	}
+
+	switch wh.provider {
+	case HMACProviderGitHub:
+
+		wh.header = "X-Hub-Signature-256"
+		wh.prefix = "sha256="
+		wh.hash = sha256.New
+		wh.encoding = "hex"
+		wh.eventHeader = "X-GitHub-Event"
+		wh.pingEvent = "ping"
+
+	case HMACProviderGitLab:
+
+		wh.header = "X-Gitlab-Token"
+
+	case HMACProviderGeneric:
+
+		wh.header = "X-Signature"
+		wh.encoding = "hex"
+		wh.prefix = q.Get("prefix")
+		wh.eventHeader = q.Get("event_header")
+		wh.pingEvent = q.Get("ping_event")
+
+		if q.Has("header") {
+			wh.header = q.Get("header")
+		}
+
+		if q.Has("encoding") {
+			wh.encoding = q.Get("encoding")
+		}
+
+		if wh.encoding != "hex" && wh.encoding != "base64" {
+			return nil, fmt.Errorf("Invalid encoding '%s'", wh.encoding)
+		}
+
+		switch q.Get("algorithm") {
+		case "sha1":
+			wh.hash = sha1.New
+		case "", "sha256":
+			wh.hash = sha256.New
+		case "sha512":
+			wh.hash = sha512.New
+		default:
+			return nil, fmt.Errorf("Invalid algorithm '%s'", q.Get("algorithm"))
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid provider '%s'", wh.provider)
+	}
+
+	return &wh, nil
+}
+
+// Receive returns the body of the message in 'req' after verifying its signature. Ping messages are verified and then
+// reported as a `webhookd.UnhandledEvent` error.
+func (wh *HMACReceiver) Receive(ctx context.Context, req *http.Request) ([]byte, *webhookd.WebhookError) {
+
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	default:
+		// pass
+	}
+
+	if req.Method != "POST" {
+
+		code := http.StatusMethodNotAllowed
+		message := "Method not allowed"
+
+		err := &webhookd.WebhookError{Code: code, Message: message}
+		return nil, err
+	}
+
+	body, err := io.ReadAll(req.Body)
+
+	if err != nil {
+
+		code := http.StatusInternalServerError
+		message := err.Error()
+
+		err := &webhookd.WebhookError{Code: code, Message: message}
+		return nil, err
+	}
+
+	if !wh.verify(req.Header.Get(wh.header), body) {
+
+		code := http.StatusUnauthorized
+		message := "Invalid signature"
+
+		err := &webhookd.WebhookError{Code: code, Message: message}
+		return nil, err
+	}
+
+	if wh.eventHeader != "" && wh.pingEvent != "" && req.Header.Get(wh.eventHeader) == wh.pingEvent {
+
+		code := webhookd.UnhandledEvent
+		message := "Ping event"
+
+		err := &webhookd.WebhookError{Code: code, Message: message}
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// ReceiveMessage returns the message in 'req' after verifying its signature. If the receiver has an event header its
+// value is used as the message's event type. The signature header is not copied to the message.
+func (wh *HMACReceiver) ReceiveMessage(ctx context.Context, req *http.Request) (*webhookd.Message, *webhookd.WebhookError) {
+
+	body, err := wh.Receive(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg := webhookd.NewMessageFromRequest(req, body)
+	msg.Header.Del(wh.header)
+
+	if wh.eventHeader != "" && req.Header.Get(wh.eventHeader) != "" {
+		msg.Metadata[webhookd.MetadataEventType] = req.Header.Get(wh.eventHeader)
+	}
+
+	return msg, nil
+}
+
+// verify reports whether 'value', the contents of the receiver's signature header, is valid for 'body'.
+func (wh *HMACReceiver) verify(value string, body []byte) bool {
+
+	if value == "" {
+		return false
+	}
+
+	// GitLab doesn't sign messages, it sends the secret token verbatim.
+
+	if wh.hash == nil {
+		return subtle.ConstantTimeCompare([]byte(value), wh.secret) == 1
+	}
+
+	if wh.prefix != "" {
+
+		v, ok := strings.CutPrefix(value, wh.prefix)
+
+		if !ok {
+			return false
+		}
+
+		value = v
+	}
+
+	var sig []byte
+	var err error
+
+	switch wh.encoding {
+	case "base64":
+		sig, err = base64.StdEncoding.DecodeString(value)
+	default:
+		sig, err = hex.DecodeString(value)
+	}
+
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(wh.hash, wh.secret)
+	mac.Write(body)
+
+	return hmac.Equal(sig, mac.Sum(nil))
+}
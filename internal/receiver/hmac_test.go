@@ -0,0 +1,169 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func newSignedRequest(t *testing.T, body []byte, headers map[string]string) *http.Request {
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/github", bytes.NewReader(body))
+
+	if err != nil {
+		t.Fatalf("Failed to create new request, %v", err)
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return req
+}
+
+func TestHMACReceiverGitHub(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SECRET", "s33kret")
+
+	r, err := NewReceiver(ctx, "hmac://github?secret_env=WEBHOOKD_TEST_SECRET")
+
+	if err != nil {
+		t.Fatalf("Failed to create new receiver, %v", err)
+	}
+
+	expected := []byte(`{"action":"opened"}`)
+
+	mac := hmac.New(sha256.New, []byte("s33kret"))
+	mac.Write(expected)
+	sig := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	req := newSignedRequest(t, expected, map[string]string{"X-Hub-Signature-256": sig, "X-GitHub-Event": "issues"})
+
+	body, err2 := r.Receive(ctx, req)
+
+	if err2 != nil {
+		t.Fatalf("Failed to receive message, %v", err2)
+	}
+
+	if !bytes.Equal(body, expected) {
+		t.Fatalf("Unexpected output '%s'", string(body))
+	}
+
+	req = newSignedRequest(t, []byte(`{"action":"closed"}`), map[string]string{"X-Hub-Signature-256": sig})
+
+	_, err2 = r.Receive(ctx, req)
+
+	if err2 == nil || err2.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for tampered body, got %v", err2)
+	}
+
+	req = newSignedRequest(t, expected, nil)
+
+	_, err2 = r.Receive(ctx, req)
+
+	if err2 == nil || err2.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for missing signature, got %v", err2)
+	}
+
+	req = newSignedRequest(t, expected, map[string]string{"X-Hub-Signature-256": sig, "X-GitHub-Event": "ping"})
+
+	_, err2 = r.Receive(ctx, req)
+
+	if err2 == nil || err2.Code != webhookd.UnhandledEvent {
+		t.Fatalf("Expected unhandled event for ping, got %v", err2)
+	}
+}
+
+func TestHMACReceiverGitLab(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SECRET", "s33kret")
+
+	r, err := NewReceiver(ctx, "hmac://gitlab?secret_env=WEBHOOKD_TEST_SECRET")
+
+	if err != nil {
+		t.Fatalf("Failed to create new receiver, %v", err)
+	}
+
+	req := newSignedRequest(t, []byte("{}"), map[string]string{"X-Gitlab-Token": "s33kret"})
+
+	_, err2 := r.Receive(ctx, req)
+
+	if err2 != nil {
+		t.Fatalf("Failed to receive message, %v", err2)
+	}
+
+	req = newSignedRequest(t, []byte("{}"), map[string]string{"X-Gitlab-Token": "nope"})
+
+	_, err2 = r.Receive(ctx, req)
+
+	if err2 == nil || err2.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for invalid token, got %v", err2)
+	}
+}
+
+func TestHMACReceiverGeneric(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SECRET", "s33kret")
+
+	r, err := NewReceiver(ctx, "hmac://generic?secret_env=WEBHOOKD_TEST_SECRET&header=X-Signature&algorithm=sha1&encoding=base64&event_header=X-Hook-Event")
+
+	if err != nil {
+		t.Fatalf("Failed to create new receiver, %v", err)
+	}
+
+	body := []byte("hello world")
+
+	mac := hmac.New(sha1.New, []byte("s33kret"))
+	mac.Write(body)
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req := newSignedRequest(t, body, map[string]string{"X-Signature": sig, "X-Hook-Event": "deploy"})
+
+	msg, err2 := webhookd.ReceiveMessage(ctx, r, req)
+
+	if err2 != nil {
+		t.Fatalf("Failed to receive message, %v", err2)
+	}
+
+	if string(msg.Body) != "hello world" || msg.Get(webhookd.MetadataEventType) != "deploy" {
+		t.Fatalf("Unexpected message, %+v", msg)
+	}
+}
+
+func TestNewHMACReceiverInvalid(t *testing.T) {
+
+	ctx := context.Background()
+
+	t.Setenv("WEBHOOKD_TEST_SECRET", "s33kret")
+
+	uris := []string{
+		"hmac://github?secret=s33kret",
+		"hmac://github",
+		"hmac://bitbucket?secret_env=WEBHOOKD_TEST_SECRET",
+		"hmac://generic?secret_env=WEBHOOKD_TEST_SECRET&algorithm=md5",
+		"hmac://generic?secret_env=WEBHOOKD_TEST_SECRET&encoding=binary",
+	}
+
+	for _, uri := range uris {
+
+		_, err := NewReceiver(ctx, uri)
+
+		if err == nil {
+			t.Fatalf("Expected %s to fail", uri)
+		}
+	}
+}
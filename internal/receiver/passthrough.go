@@ -17,14 +17,14 @@ func init() {
 	}
 }
 
-// LogReceiver implements the `webhookd.WebhookReceiver` interface for receiving webhook messages in an insecure fashion.
+// PassThroughReceiver implements the `webhookd.WebhookReceiver` interface for receiving webhook messages in an insecure fashion.
 type PassThroughReceiver struct {
 	webhookd.WebhookReceiver
 }
 
 // NewPassThroughReceiver returns a new `PassThroughReceiver` instance configured by 'uri' in the form of:
 //
-//	insecure://
+//	passthrough://
 func NewPassThroughReceiver(ctx context.Context, uri string) (webhookd.WebhookReceiver, error) {
 
 	wh := PassThroughReceiver{}
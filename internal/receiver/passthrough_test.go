@@ -11,7 +11,7 @@ func TestPassThroughReceiver(t *testing.T) {
 
 	ctx := context.Background()
 
-	r, err := NewReceiver(ctx, "insecure://")
+	r, err := NewReceiver(ctx, "passthrough://")
 
 	if err != nil {
 		t.Fatalf("Failed to create new receiver, %v", err)
@@ -19,7 +19,7 @@ func TestPassThroughReceiver(t *testing.T) {
 
 	expected := []byte("hello world")
 
-	req, err := http.NewRequest("POST", "http://localhost:8080/insecure", bytes.NewReader(expected))
+	req, err := http.NewRequest("POST", "http://localhost:8080/passthrough", bytes.NewReader(expected))
 
 	if err != nil {
 		t.Fatalf("Failed to create new request, %v", err)
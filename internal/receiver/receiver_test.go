@@ -9,10 +9,10 @@ func TestRegisterReceiver(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := RegisterReceiver(ctx, "insecure", NewPassThroughReceiver)
+	err := RegisterReceiver(ctx, "passthrough", NewPassThroughReceiver)
 
 	if err == nil {
-		t.Fatalf("Expected NewNullReceiver to be registered already")
+		t.Fatalf("Expected NewPassThroughReceiver to be registered already")
 	}
 }
 
@@ -20,7 +20,7 @@ func TestNewReceiver(t *testing.T) {
 
 	ctx := context.Background()
 
-	uri := "insecure://"
+	uri := "passthrough://"
 
 	_, err := NewReceiver(ctx, uri)
 
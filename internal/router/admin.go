@@ -0,0 +1,168 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/bobertrublik/webhook-router/internal/daemon"
+	"github.com/bobertrublik/webhook-router/internal/deadletter"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+)
+
+// DeadLetterPath is the path prefix for the administrative dead letter endpoints. Webhooks can't use it.
+const DeadLetterPath string = daemon.DeadLetterPath
+
+// newDeadLetterHandler returns a `http.Handler` for inspecting and replaying the dead letters in 'webhookDaemon':
+//
+//	GET    /admin/dlq              List all dead letters (without their bodies).
+//	DELETE /admin/dlq              Purge all dead letters.
+//	GET    /admin/dlq/{id}         Show a single dead letter.
+//	DELETE /admin/dlq/{id}         Purge a single dead letter.
+//	POST   /admin/dlq/{id}/replay  Dispatch a single dead letter again.
+func newDeadLetterHandler(webhookDaemon *daemon.WebhookDaemon) http.Handler {
+
+	store := webhookDaemon.DeadLetters()
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := r.Context()
+
+		path := strings.TrimPrefix(r.URL.Path, DeadLetterPath)
+		path = strings.Trim(path, "/")
+
+		var id string
+		var action string
+
+		if path != "" {
+			parts := strings.Split(path, "/")
+
+			if len(parts) > 2 {
+				writeJSONError(w, http.StatusNotFound, "Not found")
+				return
+			}
+
+			id = parts[0]
+
+			if len(parts) == 2 {
+				action = parts[1]
+			}
+		}
+
+		switch {
+		case id == "" && r.Method == http.MethodGet:
+
+			entries, err := store.List(ctx)
+
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			for _, e := range entries {
+				e.Body = nil
+			}
+
+			writeJSON(w, http.StatusOK, entries)
+
+		case id == "" && r.Method == http.MethodDelete:
+
+			entries, err := store.List(ctx)
+
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			purged := 0
+
+			for _, e := range entries {
+
+				err := store.Delete(ctx, e.ID)
+
+				if errors.Is(err, deadletter.ErrNotFound) {
+					continue
+				}
+
+				if err != nil {
+					writeJSONError(w, http.StatusInternalServerError, err.Error())
+					return
+				}
+
+				purged += 1
+			}
+
+			logger.Log.Info("Purged dead letters", "count", purged)
+			writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+
+		case id != "" && action == "" && r.Method == http.MethodGet:
+
+			e, err := store.Get(ctx, id)
+
+			if err != nil {
+				writeStoreError(w, err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, e)
+
+		case id != "" && action == "" && r.Method == http.MethodDelete:
+
+			err := store.Delete(ctx, id)
+
+			if err != nil {
+				writeStoreError(w, err)
+				return
+			}
+
+			logger.Log.Info("Purged dead letter", "id", id)
+			writeJSON(w, http.StatusOK, map[string]int{"purged": 1})
+
+		case id != "" && action == "replay" && r.Method == http.MethodPost:
+
+			result, err := webhookDaemon.ReplayDeadLetter(ctx, id)
+
+			if err != nil {
+				writeStoreError(w, err)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, result)
+
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// writeJSON writes 'v' encoded as JSON and 'status' to 'w'.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+
+	if err != nil {
+		logger.Log.Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+// writeJSONError writes a JSON-encoded error message and 'status' to 'w'.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+// writeStoreError writes 'err' to 'w' as a 404 if it is `deadletter.ErrNotFound` and a 500 otherwise.
+func writeStoreError(w http.ResponseWriter, err error) {
+
+	if errors.Is(err, deadletter.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	writeJSONError(w, http.StatusInternalServerError, err.Error())
+}
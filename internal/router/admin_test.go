@@ -0,0 +1,202 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/daemon"
+	"github.com/bobertrublik/webhook-router/internal/dispatcher"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// toggleDispatcher implements the `webhookd.WebhookDispatcher` interface and fails while `toggleFail` is true.
+type toggleDispatcher struct {
+	webhookd.WebhookDispatcher
+}
+
+var toggleFail = true
+
+func (d *toggleDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	if toggleFail {
+		return &webhookd.WebhookError{Code: http.StatusBadGateway, Message: "Bad Gateway"}
+	}
+
+	return nil
+}
+
+func init() {
+
+	ctx := context.Background()
+
+	err := dispatcher.RegisterDispatcher(ctx, "toggle", func(ctx context.Context, uri string) (webhookd.WebhookDispatcher, error) {
+		return &toggleDispatcher{}, nil
+	})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestDeadLetterHandler(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := &config.WebhookConfig{
+		Receivers: map[string]string{
+			"passthrough": "passthrough://",
+		},
+		Dispatchers: map[string]config.WebhookDispatcherConfig{
+			"toggle": {URI: "toggle://"},
+		},
+		Webhooks: []config.WebhookWebhooksConfig{
+			{Endpoint: "/api", Receiver: "passthrough", Dispatchers: []string{"toggle"}},
+		},
+		DeadLetter: "file://" + t.TempDir(),
+	}
+
+	t.Setenv("WEBHOOKD_TEST_ADMIN_KEY", "s33kret")
+
+	cfg.Admin.Auth = config.WebhookAuthConfig{
+		Mode:   "api-key",
+		APIKey: &config.WebhookAPIKeyConfig{KeyEnv: "WEBHOOKD_TEST_ADMIN_KEY"},
+	}
+
+	d, err := daemon.NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	defer d.Close()
+
+	rtr := New(d)
+
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "s33kret")
+		rsp := httptest.NewRecorder()
+		rtr.ServeHTTP(rsp, req)
+		return rsp
+	}
+
+	req := httptest.NewRequest("GET", DeadLetterPath, nil)
+	rsp := httptest.NewRecorder()
+	rtr.ServeHTTP(rsp, req)
+
+	if rsp.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without admin credentials, got %d", rsp.Code)
+	}
+
+	toggleFail = true
+
+	rsp = do("POST", "/api", "hello world")
+
+	if rsp.Code != http.StatusInternalServerError {
+		t.Fatalf("Unexpected status code for failed dispatch: %d", rsp.Code)
+	}
+
+	var entries []struct {
+		ID         string `json:"id"`
+		Dispatcher string `json:"dispatcher"`
+	}
+
+	rsp = do("GET", DeadLetterPath, "")
+
+	err = json.Unmarshal(rsp.Body.Bytes(), &entries)
+
+	if err != nil {
+		t.Fatalf("Failed to decode dead letters, %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].Dispatcher != "toggle" {
+		t.Fatalf("Unexpected dead letters: %s", rsp.Body.String())
+	}
+
+	id := entries[0].ID
+
+	rsp = do("GET", DeadLetterPath+"/"+id, "")
+
+	if rsp.Code != http.StatusOK || !strings.Contains(rsp.Body.String(), `"endpoint":"/api"`) {
+		t.Fatalf("Unexpected dead letter: %s", rsp.Body.String())
+	}
+
+	rsp = do("POST", DeadLetterPath+"/"+id+"/replay", "")
+
+	if rsp.Code != http.StatusOK || !strings.Contains(rsp.Body.String(), `"outcome":"failed"`) {
+		t.Fatalf("Unexpected replay result: %s", rsp.Body.String())
+	}
+
+	toggleFail = false
+
+	rsp = do("POST", DeadLetterPath+"/"+id+"/replay", "")
+
+	if rsp.Code != http.StatusOK || !strings.Contains(rsp.Body.String(), `"outcome":"ok"`) {
+		t.Fatalf("Unexpected replay result: %s", rsp.Body.String())
+	}
+
+	rsp = do("GET", DeadLetterPath+"/"+id, "")
+
+	if rsp.Code != http.StatusNotFound {
+		t.Fatalf("Expected replayed dead letter to be removed, got %d", rsp.Code)
+	}
+
+	toggleFail = true
+	do("POST", "/api", "hello world")
+
+	rsp = do("DELETE", DeadLetterPath, "")
+
+	if rsp.Code != http.StatusOK || !strings.Contains(rsp.Body.String(), `"purged":1`) {
+		t.Fatalf("Unexpected purge result: %s", rsp.Body.String())
+	}
+}
+
+func TestDeadLetterHandlerWithoutAuth(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, mode := range []string{"", "none"} {
+
+		cfg := &config.WebhookConfig{
+			Receivers: map[string]string{
+				"passthrough": "passthrough://",
+			},
+			Dispatchers: map[string]config.WebhookDispatcherConfig{
+				"toggle": {URI: "toggle://"},
+			},
+			Webhooks: []config.WebhookWebhooksConfig{
+				{Endpoint: "/api", Receiver: "passthrough", Dispatchers: []string{"toggle"}},
+			},
+			DeadLetter: "file://" + t.TempDir(),
+		}
+
+		cfg.Admin.Auth.Mode = mode
+
+		d, err := daemon.NewWebhookDaemonFromConfig(ctx, cfg)
+
+		if err != nil {
+			t.Fatalf("Failed to create new daemon from config, %v", err)
+		}
+
+		defer d.Close()
+
+		rtr := New(d)
+
+		for _, path := range []string{DeadLetterPath, DeadLetterPath + "/123"} {
+
+			req := httptest.NewRequest("GET", path, nil)
+			rsp := httptest.NewRecorder()
+
+			rtr.ServeHTTP(rsp, req)
+
+			if rsp.Code != http.StatusNotFound {
+				t.Fatalf("Expected %s to be disabled for admin auth mode '%s', got %d", path, mode, rsp.Code)
+			}
+		}
+	}
+}
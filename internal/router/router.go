@@ -1,38 +1,72 @@
 package router
 
 import (
-	"fmt"
 	"github.com/bobertrublik/webhook-router/internal/daemon"
 	"github.com/bobertrublik/webhook-router/internal/logger"
+	"github.com/bobertrublik/webhook-router/internal/metrics"
+	"github.com/bobertrublik/webhook-router/internal/tracing"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
 	"net/http"
-
-	"github.com/bobertrublik/webhook-router/internal/middleware"
 )
 
-// New sets up our routes and returns a *http.ServeMux.
+// New returns a *http.ServeMux which routes requests to the webhook endpoints configured in 'webhookDaemon'. Requests
+// are wrapped in the middleware (for example authentication) configured for their endpoint. Endpoints and middleware
+// are looked up, together, for each request so that changes made by reloading the daemon's config take effect immediately. Each
+// request's context carries its request ID, which is also returned in the response, and a logger that includes the ID
+// and endpoint in every line.
 func New(webhookDaemon *daemon.WebhookDaemon) *http.ServeMux {
 	router := http.NewServeMux()
 
-	// This route is always accessible.
-	router.Handle("/echo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Log.Info("Webhook request received on path /echo")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+		log.Info("Webhook request received")
 		w.Header().Set("Content-Type", "application/json")
 		err := webhookDaemon.ProcessRequest(w, r)
 		if err != nil {
-			fmt.Println(err)
+			log.Error("Failed to process webhook request", "error", err)
 		}
+	})
+
+	router.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// The webhook and its middleware are taken from the same version of the config, and the
+		// request is processed with that webhook, even if the config is reloaded in the meantime.
+
+		wh, mw, release, ok := webhookDaemon.Acquire(r.URL.Path)
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		defer release()
+
+		ctx := daemon.NewRequestContext(r)
+		ctx = daemon.NewWebhookContext(ctx, wh)
+
+		r = r.WithContext(ctx)
+
+		w.Header().Set(webhookd.RequestIDHeader, webhookd.RequestIDFromContext(ctx))
+
+		tracing.Handler(r.URL.Path, mw(handler)).ServeHTTP(w, r)
 	}))
 
-	// This route is only accessible if the user has a valid access_token.
-	router.Handle("/api", middleware.EnsureValidToken()(
-		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			logger.Log.Info("Webhook request received on path /api")
-			err := webhookDaemon.ProcessRequest(w, r)
-			if err != nil {
-				fmt.Println(err)
-			}
-		}),
-	))
+	router.Handle(metrics.Path, metrics.Handler())
+
+	// These routes are only available if a dead letter store is configured. Dead letters contain whole messages and
+	// can be replayed or purged, so the routes are never served without authentication.
+	switch {
+	case webhookDaemon.DeadLetters() == nil:
+		// pass
+	case !webhookDaemon.HasAdminAuth():
+		logger.Log.Warn("Dead letter admin endpoints are disabled because admin.auth is not configured", "path", DeadLetterPath)
+	default:
+
+		dlq := webhookDaemon.AdminMiddleware()(newDeadLetterHandler(webhookDaemon))
+
+		router.Handle(DeadLetterPath, dlq)
+		router.Handle(DeadLetterPath+"/", dlq)
+	}
 
 	return router
 }
@@ -0,0 +1,235 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/daemon"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+)
+
+func TestNew(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := &config.WebhookConfig{
+		Receivers: map[string]string{
+			"passthrough": "passthrough://",
+		},
+		Dispatchers: map[string]config.WebhookDispatcherConfig{
+			"log": {URI: "log://"},
+		},
+		Webhooks: []config.WebhookWebhooksConfig{
+			{Endpoint: "/one", Receiver: "passthrough", Dispatchers: []string{"log"}},
+			{Endpoint: "/two", Receiver: "passthrough", Dispatchers: []string{"log"}, Auth: config.WebhookAuthConfig{Mode: "none"}},
+		},
+	}
+
+	d, err := daemon.NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	rtr := New(d)
+
+	tests := map[string]int{
+		"/one":     http.StatusOK,
+		"/two":     http.StatusOK,
+		"/chicken": http.StatusNotFound,
+	}
+
+	for path, expected := range tests {
+
+		req := httptest.NewRequest("POST", path, strings.NewReader("hello world"))
+		rsp := httptest.NewRecorder()
+
+		rtr.ServeHTTP(rsp, req)
+
+		if rsp.Code != expected {
+			t.Fatalf("Unexpected status code for %s: %d", path, rsp.Code)
+		}
+	}
+}
+
+func TestNewReload(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := &config.WebhookConfig{
+		Receivers: map[string]string{
+			"passthrough": "passthrough://",
+		},
+		Dispatchers: map[string]config.WebhookDispatcherConfig{
+			"log": {URI: "log://"},
+		},
+		Webhooks: []config.WebhookWebhooksConfig{
+			{Endpoint: "/one", Receiver: "passthrough", Dispatchers: []string{"log"}},
+		},
+	}
+
+	d, err := daemon.NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	rtr := New(d)
+
+	cfg.Webhooks = []config.WebhookWebhooksConfig{
+		{Endpoint: "/two", Receiver: "passthrough", Dispatchers: []string{"log"}},
+	}
+
+	err = d.Reload(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to reload daemon, %v", err)
+	}
+
+	tests := map[string]int{
+		"/one": http.StatusNotFound,
+		"/two": http.StatusOK,
+	}
+
+	for path, expected := range tests {
+
+		req := httptest.NewRequest("POST", path, strings.NewReader("hello world"))
+		rsp := httptest.NewRecorder()
+
+		rtr.ServeHTTP(rsp, req)
+
+		if rsp.Code != expected {
+			t.Fatalf("Unexpected status code for %s after reload: %d", path, rsp.Code)
+		}
+	}
+}
+
+func TestNewMetrics(t *testing.T) {
+
+	ctx := context.Background()
+
+	cfg := &config.WebhookConfig{
+		Receivers: map[string]string{
+			"passthrough": "passthrough://",
+		},
+		Dispatchers: map[string]config.WebhookDispatcherConfig{
+			"log": {URI: "log://"},
+		},
+		Webhooks: []config.WebhookWebhooksConfig{
+			{Endpoint: "/metered", Receiver: "passthrough", Dispatchers: []string{"log"}},
+		},
+	}
+
+	d, err := daemon.NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	rtr := New(d)
+
+	req := httptest.NewRequest("POST", "/metered", strings.NewReader("hello world"))
+	rtr.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	rsp := httptest.NewRecorder()
+
+	rtr.ServeHTTP(rsp, req)
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code for /metrics: %d", rsp.Code)
+	}
+
+	expected := []string{
+		`webhookd_events_total{endpoint="/metered",outcome="succeeded"} 1`,
+		`webhookd_dispatch_duration_seconds_count{dispatcher="log",endpoint="/metered",outcome="ok",scheme="log"} 1`,
+	}
+
+	for _, line := range expected {
+
+		if !strings.Contains(rsp.Body.String(), line) {
+			t.Fatalf("Missing metric %s", line)
+		}
+	}
+}
+
+func TestNewRequestLogger(t *testing.T) {
+
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+
+	defaultLog := logger.Log
+	logger.Log = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	defer func() {
+		logger.Log = defaultLog
+	}()
+
+	cfg := &config.WebhookConfig{
+		Receivers: map[string]string{
+			"passthrough": "passthrough://",
+		},
+		Dispatchers: map[string]config.WebhookDispatcherConfig{
+			"log": {URI: "log://"},
+		},
+		Webhooks: []config.WebhookWebhooksConfig{
+			{Endpoint: "/one", Receiver: "passthrough", Dispatchers: []string{"log"}},
+		},
+	}
+
+	d, err := daemon.NewWebhookDaemonFromConfig(ctx, cfg)
+
+	if err != nil {
+		t.Fatalf("Failed to create new daemon from config, %v", err)
+	}
+
+	rtr := New(d)
+
+	req := httptest.NewRequest("POST", "/one", strings.NewReader("hello world"))
+	rsp := httptest.NewRecorder()
+
+	rtr.ServeHTTP(rsp, req)
+
+	if rsp.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", rsp.Code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	if len(lines) < 2 {
+		t.Fatalf("Expected request and timing log lines, got '%s'", buf.String())
+	}
+
+	var request_id string
+
+	for _, ln := range lines {
+
+		var line map[string]interface{}
+
+		err := json.Unmarshal([]byte(ln), &line)
+
+		if err != nil {
+			t.Fatalf("Failed to decode log line '%s', %v", ln, err)
+		}
+
+		id, _ := line["request_id"].(string)
+
+		if id == "" || line["endpoint"] != "/one" {
+			t.Fatalf("Missing request-scoped fields in log line '%s'", ln)
+		}
+
+		if request_id != "" && id != request_id {
+			t.Fatalf("Request ID changed between log lines, '%s' and '%s'", request_id, id)
+		}
+
+		request_id = id
+	}
+}
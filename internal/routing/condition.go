@@ -0,0 +1,346 @@
+package routing
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/tidwall/gjson"
+)
+
+// Condition is an interface for testing whether a webhook message should use a route.
+type Condition interface {
+	// Match() reports whether a message satisfies the condition.
+	Match(*webhookd.Message) bool
+}
+
+// NewConditionFromConfig returns a new `Condition` derived from 'cfg'. It is either the expression in `Expr` or a single
+// test (`Equals`, `Matches` or `Exists`) of the value selected by `Path`, `Header` or `Meta`.
+func NewConditionFromConfig(cfg config.WebhookRouteConfig) (Condition, error) {
+
+	selectors := 0
+	tests := 0
+
+	for _, ok := range []bool{cfg.Path != "", cfg.Header != "", cfg.Meta != ""} {
+		if ok {
+			selectors += 1
+		}
+	}
+
+	for _, ok := range []bool{cfg.Equals != nil, cfg.Matches != "", cfg.Exists != nil} {
+		if ok {
+			tests += 1
+		}
+	}
+
+	if cfg.Expr != "" {
+
+		if selectors > 0 || tests > 0 {
+			return nil, fmt.Errorf("Expressions can not be combined with path, header, meta, equals, matches or exists")
+		}
+
+		return ParseExpression(cfg.Expr)
+	}
+
+	if selectors != 1 {
+		return nil, fmt.Errorf("Condition must have exactly one of path, header or meta")
+	}
+
+	if tests != 1 {
+		return nil, fmt.Errorf("Condition must have exactly one of equals, matches or exists")
+	}
+
+	var sel operand
+
+	switch {
+	case cfg.Path != "":
+		sel = pathOperand(cfg.Path)
+	case cfg.Header != "":
+		sel = headerOperand(cfg.Header)
+	default:
+		sel = metaOperand(cfg.Meta)
+	}
+
+	switch {
+	case cfg.Equals != nil:
+		return &compareCondition{op: "==", left: sel, right: stringValue(*cfg.Equals)}, nil
+	case cfg.Matches != "":
+
+		re, err := regexp.Compile(cfg.Matches)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression, %w", err)
+		}
+
+		return &regexpCondition{operand: sel, re: re}, nil
+
+	default:
+
+		var c Condition = &existsCondition{operand: sel}
+
+		if !*cfg.Exists {
+			c = &notCondition{condition: c}
+		}
+
+		return c, nil
+	}
+}
+
+// type value is a struct containing a value selected from a message, or a literal, that conditions compare.
+type value struct {
+	// str is the string form of the value.
+	str string
+	// num is the numeric form of the value, if `isNum` is true.
+	num float64
+	// isNum is true if the value is a number.
+	isNum bool
+	// null is true if the value is null or does not exist.
+	null bool
+	// truthy is true if the value is not null, false, zero or an empty string.
+	truthy bool
+}
+
+// number returns the numeric form of 'v' and true if it is a number or a string that can be parsed as one.
+func (v value) number() (float64, bool) {
+
+	if v.null {
+		return 0, false
+	}
+
+	if v.isNum {
+		return v.num, true
+	}
+
+	f, err := strconv.ParseFloat(v.str, 64)
+
+	if err != nil {
+		return 0, false
+	}
+
+	return f, true
+}
+
+// operand is an interface for the values compared by conditions.
+type operand interface {
+	// value() returns the operand's value for a message.
+	value(*webhookd.Message) value
+}
+
+// stringValue is an `operand` for a string literal.
+type stringValue string
+
+func (s stringValue) value(msg *webhookd.Message) value {
+	return value{str: string(s), truthy: s != ""}
+}
+
+// numberValue is an `operand` for a numeric literal.
+type numberValue float64
+
+func (n numberValue) value(msg *webhookd.Message) value {
+	return value{str: strconv.FormatFloat(float64(n), 'f', -1, 64), num: float64(n), isNum: true, truthy: n != 0}
+}
+
+// boolValue is an `operand` for the literals true and false.
+type boolValue bool
+
+func (b boolValue) value(msg *webhookd.Message) value {
+	return value{str: strconv.FormatBool(bool(b)), truthy: bool(b)}
+}
+
+// nullValue is an `operand` for the literal null.
+type nullValue struct{}
+
+func (n nullValue) value(msg *webhookd.Message) value {
+	return value{null: true}
+}
+
+// pathOperand is an `operand` selecting a value from the body of a message using a gjson path.
+type pathOperand string
+
+func (p pathOperand) value(msg *webhookd.Message) value {
+
+	r := gjson.GetBytes(msg.Body, string(p))
+
+	switch r.Type {
+	case gjson.Null:
+		return value{null: true}
+	case gjson.Number:
+		return value{str: r.String(), num: r.Num, isNum: true, truthy: r.Num != 0}
+	case gjson.True, gjson.False:
+		return value{str: r.String(), truthy: r.Bool()}
+	case gjson.String:
+		return value{str: r.Str, truthy: r.Str != ""}
+	default:
+		return value{str: r.Raw, truthy: true}
+	}
+}
+
+// headerOperand is an `operand` selecting the value of a request header.
+type headerOperand string
+
+func (h headerOperand) value(msg *webhookd.Message) value {
+
+	values := msg.Header.Values(string(h))
+
+	if len(values) == 0 {
+		return value{null: true}
+	}
+
+	return value{str: values[0], truthy: values[0] != ""}
+}
+
+// metaOperand is an `operand` selecting the value of a metadata key.
+type metaOperand string
+
+func (m metaOperand) value(msg *webhookd.Message) value {
+
+	v, ok := msg.Metadata[string(m)]
+
+	if !ok {
+		return value{null: true}
+	}
+
+	return value{str: v, truthy: v != ""}
+}
+
+// compareCondition is a `Condition` comparing two operands.
+type compareCondition struct {
+	op    string
+	left  operand
+	right operand
+}
+
+func (c *compareCondition) Match(msg *webhookd.Message) bool {
+
+	a := c.left.value(msg)
+	b := c.right.value(msg)
+
+	switch c.op {
+	case "==":
+		return equal(a, b)
+	case "!=":
+		return !equal(a, b)
+	}
+
+	if a.null || b.null {
+		return false
+	}
+
+	// Values are compared as numbers if both can be parsed as one, otherwise as strings
+	// so that, for example, RFC 3339 timestamps can be compared.
+
+	var cmp int
+
+	na, ok_a := a.number()
+	nb, ok_b := b.number()
+
+	if ok_a && ok_b {
+
+		switch {
+		case na < nb:
+			cmp = -1
+		case na > nb:
+			cmp = 1
+		}
+
+	} else {
+		cmp = strings.Compare(a.str, b.str)
+	}
+
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return false
+	}
+}
+
+// equal reports whether 'a' and 'b' are equal. Values are compared as numbers if both can be parsed as one.
+func equal(a value, b value) bool {
+
+	if a.null || b.null {
+		return a.null && b.null
+	}
+
+	na, ok_a := a.number()
+	nb, ok_b := b.number()
+
+	if ok_a && ok_b {
+		return na == nb
+	}
+
+	return a.str == b.str
+}
+
+// regexpCondition is a `Condition` matching the string form of an operand against a regular expression.
+type regexpCondition struct {
+	operand operand
+	re      *regexp.Regexp
+}
+
+func (c *regexpCondition) Match(msg *webhookd.Message) bool {
+
+	v := c.operand.value(msg)
+
+	if v.null {
+		return false
+	}
+
+	return c.re.MatchString(v.str)
+}
+
+// existsCondition is a `Condition` matching operands that are not null.
+type existsCondition struct {
+	operand operand
+}
+
+func (c *existsCondition) Match(msg *webhookd.Message) bool {
+	return !c.operand.value(msg).null
+}
+
+// truthyCondition is a `Condition` matching operands that are not null, false, zero or an empty string.
+type truthyCondition struct {
+	operand operand
+}
+
+func (c *truthyCondition) Match(msg *webhookd.Message) bool {
+	return c.operand.value(msg).truthy
+}
+
+// notCondition is a `Condition` negating another condition.
+type notCondition struct {
+	condition Condition
+}
+
+func (c *notCondition) Match(msg *webhookd.Message) bool {
+	return !c.condition.Match(msg)
+}
+
+// andCondition is a `Condition` matching if both of its conditions match.
+type andCondition struct {
+	left  Condition
+	right Condition
+}
+
+func (c *andCondition) Match(msg *webhookd.Message) bool {
+	return c.left.Match(msg) && c.right.Match(msg)
+}
+
+// orCondition is a `Condition` matching if either of its conditions match.
+type orCondition struct {
+	left  Condition
+	right Condition
+}
+
+func (c *orCondition) Match(msg *webhookd.Message) bool {
+	return c.left.Match(msg) || c.right.Match(msg)
+}
@@ -0,0 +1,460 @@
+package routing
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseExpression returns a new `Condition` derived from the expression 'str'. Expressions have the following syntax:
+//
+//   - A gjson path, for example `data.essentials.severity`, selects a value from the body of a message. Paths that
+//     contain other characters can be written as `path("...")`.
+//   - `header("NAME")` and `meta("KEY")` select the value of a request header or metadata key.
+//   - String literals are enclosed in double or single quotes. Numbers, `true`, `false` and `null` are also literals.
+//   - `==`, `!=`, `<`, `<=`, `>` and `>=` compare two values. Values are compared as numbers if both can be parsed
+//     as one, otherwise as strings. Values which do not exist are equal to `null`.
+//   - `=~` and `!~` test whether a value matches, or does not match, a regular expression string literal.
+//   - `exists(VALUE)` tests whether a value exists. A value on its own tests whether it exists and is not false,
+//     zero or an empty string.
+//   - `!`, `&&`, `||` and parentheses combine tests.
+func ParseExpression(str string) (Condition, error) {
+
+	tokens, err := tokenize(str)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		tokens: tokens,
+	}
+
+	c, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokenEOF {
+		return nil, p.unexpected()
+	}
+
+	return c, nil
+}
+
+// The kinds of token in an expression.
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+// type token is a struct containing a single token of an expression.
+type token struct {
+	kind   int
+	text   string
+	offset int
+}
+
+// operators is the list of operators, longest first so that "!=" is not read as "!".
+var operators = []string{"==", "!=", "=~", "!~", "<=", ">=", "&&", "||", "<", ">", "!"}
+
+// tokenize splits 'str' into a list of tokens, ending with a `tokenEOF` token.
+func tokenize(str string) ([]token, error) {
+
+	tokens := make([]token, 0)
+	runes := []rune(str)
+
+	i := 0
+
+	for i < len(runes) {
+
+		r := runes[i]
+
+		if unicode.IsSpace(r) {
+			i += 1
+			continue
+		}
+
+		start := i
+
+		switch {
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", offset: start})
+			i += 1
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", offset: start})
+			i += 1
+		case r == '"' || r == '\'':
+
+			var sb strings.Builder
+			closed := false
+
+			for i += 1; i < len(runes); i++ {
+
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i += 1
+					sb.WriteRune(runes[i])
+					continue
+				}
+
+				if runes[i] == r {
+					closed = true
+					i += 1
+					break
+				}
+
+				sb.WriteRune(runes[i])
+			}
+
+			if !closed {
+				return nil, fmt.Errorf("Unterminated string at offset %d", start)
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), offset: start})
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+
+			i += 1
+
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".eE", runes[i]) || ((runes[i] == '-' || runes[i] == '+') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i += 1
+			}
+
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), offset: start})
+
+		case isIdentStart(r):
+
+			for i < len(runes) && isIdent(runes[i]) {
+
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i += 1
+				}
+
+				i += 1
+			}
+
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), offset: start})
+
+		default:
+
+			op := ""
+
+			for _, candidate := range operators {
+
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					op = candidate
+					break
+				}
+			}
+
+			if op == "" {
+				return nil, fmt.Errorf("Unexpected character '%c' at offset %d", r, start)
+			}
+
+			tokens = append(tokens, token{kind: tokenOp, text: op, offset: start})
+			i += len([]rune(op))
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, offset: len(runes)})
+	return tokens, nil
+}
+
+// isIdentStart reports whether 'r' can start a gjson path.
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '#' || r == '@'
+}
+
+// isIdent reports whether 'r' can be part of a gjson path.
+func isIdent(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || strings.ContainsRune(".*?-\\", r)
+}
+
+// type parser is a struct that builds a `Condition` from a list of tokens using recursive descent.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// peek returns the next token without consuming it.
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the next token.
+func (p *parser) next() token {
+
+	t := p.tokens[p.pos]
+
+	if t.kind != tokenEOF {
+		p.pos += 1
+	}
+
+	return t
+}
+
+// unexpected returns an error describing the next token.
+func (p *parser) unexpected() error {
+
+	t := p.peek()
+
+	if t.kind == tokenEOF {
+		return fmt.Errorf("Unexpected end of expression")
+	}
+
+	return fmt.Errorf("Unexpected '%s' at offset %d", t.text, t.offset)
+}
+
+// parseOr parses one or more conditions separated by "||".
+func (p *parser) parseOr() (Condition, error) {
+
+	left, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOp && p.peek().text == "||" {
+
+		p.next()
+
+		right, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = &orCondition{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseAnd parses one or more conditions separated by "&&".
+func (p *parser) parseAnd() (Condition, error) {
+
+	left, err := p.parseUnary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOp && p.peek().text == "&&" {
+
+		p.next()
+
+		right, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = &andCondition{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseUnary parses a negated condition, a condition in parentheses or a comparison.
+func (p *parser) parseUnary() (Condition, error) {
+
+	t := p.peek()
+
+	switch {
+	case t.kind == tokenOp && t.text == "!":
+
+		p.next()
+
+		c, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &notCondition{condition: c}, nil
+
+	case t.kind == tokenLParen:
+
+		p.next()
+
+		c, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek().kind != tokenRParen {
+			return nil, p.unexpected()
+		}
+
+		p.next()
+		return c, nil
+
+	default:
+		return p.parseComparison()
+	}
+}
+
+// parseComparison parses an `exists` test, a comparison of two operands or a single operand tested for truthiness.
+func (p *parser) parseComparison() (Condition, error) {
+
+	t := p.peek()
+
+	if t.kind == tokenIdent && t.text == "exists" && p.tokens[p.pos+1].kind == tokenLParen {
+
+		p.next()
+		p.next()
+
+		o, err := p.parseOperand()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek().kind != tokenRParen {
+			return nil, p.unexpected()
+		}
+
+		p.next()
+		return &existsCondition{operand: o}, nil
+	}
+
+	left, err := p.parseOperand()
+
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+
+	if op.kind != tokenOp {
+		return &truthyCondition{operand: left}, nil
+	}
+
+	switch op.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+
+		p.next()
+
+		right, err := p.parseOperand()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &compareCondition{op: op.text, left: left, right: right}, nil
+
+	case "=~", "!~":
+
+		p.next()
+
+		pattern := p.peek()
+
+		if pattern.kind != tokenString {
+			return nil, fmt.Errorf("Expected regular expression string at offset %d", pattern.offset)
+		}
+
+		p.next()
+
+		re, err := regexp.Compile(pattern.text)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression at offset %d, %w", pattern.offset, err)
+		}
+
+		var c Condition = &regexpCondition{operand: left, re: re}
+
+		if op.text == "!~" {
+			c = &notCondition{condition: c}
+		}
+
+		return c, nil
+
+	default:
+		return &truthyCondition{operand: left}, nil
+	}
+}
+
+// parseOperand parses a literal, a gjson path or a call to the path, header or meta functions.
+func (p *parser) parseOperand() (operand, error) {
+
+	t := p.peek()
+
+	switch t.kind {
+	case tokenString, tokenNumber, tokenIdent:
+		p.next()
+	default:
+		return nil, p.unexpected()
+	}
+
+	switch t.kind {
+	case tokenString:
+		return stringValue(t.text), nil
+	case tokenNumber:
+
+		f, err := strconv.ParseFloat(t.text, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number '%s' at offset %d", t.text, t.offset)
+		}
+
+		return numberValue(f), nil
+
+	case tokenIdent:
+
+		if p.peek().kind == tokenLParen {
+			return p.parseFunction(t)
+		}
+
+		switch t.text {
+		case "true":
+			return boolValue(true), nil
+		case "false":
+			return boolValue(false), nil
+		case "null":
+			return nullValue{}, nil
+		default:
+			return pathOperand(t.text), nil
+		}
+
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+// parseFunction parses the argument of a call to the function named by 'fn'.
+func (p *parser) parseFunction(fn token) (operand, error) {
+
+	p.next()
+
+	arg := p.next()
+
+	if arg.kind != tokenString {
+		return nil, fmt.Errorf("Expected string argument for %s() at offset %d", fn.text, arg.offset)
+	}
+
+	if p.peek().kind != tokenRParen {
+		return nil, p.unexpected()
+	}
+
+	p.next()
+
+	switch fn.text {
+	case "path":
+		return pathOperand(arg.text), nil
+	case "header":
+		return headerOperand(arg.text), nil
+	case "meta":
+		return metaOperand(arg.text), nil
+	default:
+		return nil, fmt.Errorf("Unknown function '%s' at offset %d", fn.text, fn.offset)
+	}
+}
@@ -0,0 +1,156 @@
+// Package routing provides methods for choosing the dispatchers a webhook message is relayed to based on its contents.
+package routing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+// DefaultRouteName is the name of a default route which has not been given one.
+const DefaultRouteName string = "default"
+
+// type Route is a struct that relays messages matching `Condition` to `Dispatchers`.
+type Route struct {
+	// Name is the label for the route.
+	Name string
+	// Condition is the `Condition` a message must match to use the route. It is nil for the default route.
+	Condition Condition
+	// Dispatchers is the list of dispatcher labels that matching messages are relayed to.
+	Dispatchers []string
+}
+
+// type Router is a struct that implements the `webhookd.WebhookRouter` interface by evaluating a list of `Route`
+// instances in order.
+type Router struct {
+	webhookd.WebhookRouter
+	// routes is the list of conditional routes, in the order they are evaluated.
+	routes []*Route
+	// fallback is the optional route used when no other route matches.
+	fallback *Route
+}
+
+// NewRouterFromConfig returns a new `Router` instance derived from 'routes'. Dispatcher labels beginning with "#"
+// are ignored, like those listed in `config.WebhookWebhooksConfig.Dispatchers`.
+func NewRouterFromConfig(routes []config.WebhookRouteConfig) (*Router, error) {
+
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("No routes defined")
+	}
+
+	r := &Router{
+		routes: make([]*Route, 0),
+	}
+
+	for i, cfg := range routes {
+
+		name := cfg.Name
+
+		if name == "" {
+
+			if cfg.Default {
+				name = DefaultRouteName
+			} else {
+				name = fmt.Sprintf("route-%d", i)
+			}
+		}
+
+		var names []string
+
+		for _, d := range cfg.Dispatchers {
+
+			if strings.HasPrefix(d, "#") {
+				continue
+			}
+
+			names = append(names, d)
+		}
+
+		if len(names) == 0 {
+			return nil, fmt.Errorf("Missing dispatchers for route '%s'", name)
+		}
+
+		rt := &Route{
+			Name:        name,
+			Dispatchers: names,
+		}
+
+		if cfg.Default {
+
+			if hasCondition(cfg) {
+				return nil, fmt.Errorf("Default route '%s' can not have a condition", name)
+			}
+
+			if r.fallback != nil {
+				return nil, fmt.Errorf("Multiple default routes, '%s' and '%s'", r.fallback.Name, name)
+			}
+
+			r.fallback = rt
+			continue
+		}
+
+		c, err := NewConditionFromConfig(cfg)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid condition for route '%s', %w", name, err)
+		}
+
+		rt.Condition = c
+		r.routes = append(r.routes, rt)
+	}
+
+	return r, nil
+}
+
+// Route returns the name and dispatchers of the first route whose condition 'msg' matches, or of the default route if
+// none do. The final boolean is false if no route matches and there is no default route.
+func (r *Router) Route(msg *webhookd.Message) (string, []string, bool) {
+
+	for _, rt := range r.routes {
+
+		if rt.Condition.Match(msg) {
+			return rt.Name, rt.Dispatchers, true
+		}
+	}
+
+	if r.fallback != nil {
+		return r.fallback.Name, r.fallback.Dispatchers, true
+	}
+
+	return "", nil, false
+}
+
+// Dispatchers returns the list of every dispatcher label used by the router's routes, in the order they first appear.
+func (r *Router) Dispatchers() []string {
+
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+
+	routes := r.routes
+
+	if r.fallback != nil {
+		routes = append(routes[:len(routes):len(routes)], r.fallback)
+	}
+
+	for _, rt := range routes {
+
+		for _, name := range rt.Dispatchers {
+
+			if seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// hasCondition reports whether 'cfg' defines any part of a condition.
+func hasCondition(cfg config.WebhookRouteConfig) bool {
+	return cfg.Path != "" || cfg.Header != "" || cfg.Meta != "" || cfg.Equals != nil || cfg.Matches != "" || cfg.Exists != nil || cfg.Expr != ""
+}
@@ -0,0 +1,201 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func newMessage(body string) *webhookd.Message {
+
+	msg := webhookd.NewMessage([]byte(body))
+	msg.Header.Set("X-GitHub-Event", "push")
+	msg.Metadata[webhookd.MetadataEventType] = "push"
+
+	return msg
+}
+
+func TestRouter(t *testing.T) {
+
+	sev0 := "Sev0"
+	no := false
+
+	routes := []config.WebhookRouteConfig{
+		{Name: "critical", Path: "data.essentials.severity", Equals: &sev0, Dispatchers: []string{"pagerduty", "slack"}},
+		{Name: "resolved", Expr: `data.essentials.monitorCondition == "Resolved"`, Dispatchers: []string{"#pagerduty", "slack"}},
+		{Name: "untagged", Path: "data.essentials.tags", Exists: &no, Dispatchers: []string{"log"}},
+		{Default: true, Dispatchers: []string{"slack-info"}},
+	}
+
+	r, err := NewRouterFromConfig(routes)
+
+	if err != nil {
+		t.Fatalf("Failed to create router, %v", err)
+	}
+
+	tests := map[string][]string{
+		`{"data": {"essentials": {"severity": "Sev0", "tags": []}}}`:                                 {"critical", "pagerduty", "slack"},
+		`{"data": {"essentials": {"severity": "Sev3", "monitorCondition": "Resolved", "tags": []}}}`: {"resolved", "slack"},
+		`{"data": {"essentials": {"severity": "Sev4"}}}`:                                             {"untagged", "log"},
+		`{"data": {"essentials": {"severity": "Informational", "tags": []}}}`:                        {"default", "slack-info"},
+	}
+
+	for body, expected := range tests {
+
+		name, dispatchers, ok := r.Route(newMessage(body))
+
+		if !ok {
+			t.Fatalf("Expected a route for %s", body)
+		}
+
+		if name != expected[0] || len(dispatchers) != len(expected)-1 {
+			t.Fatalf("Unexpected route for %s: %s %v", body, name, dispatchers)
+		}
+
+		for idx, d := range dispatchers {
+
+			if d != expected[idx+1] {
+				t.Fatalf("Unexpected dispatchers for %s: %v", body, dispatchers)
+			}
+		}
+	}
+
+	all := r.Dispatchers()
+
+	if len(all) != 4 || all[0] != "pagerduty" || all[1] != "slack" || all[2] != "log" || all[3] != "slack-info" {
+		t.Fatalf("Unexpected list of dispatchers %v", all)
+	}
+
+	r, err = NewRouterFromConfig(routes[:1])
+
+	if err != nil {
+		t.Fatalf("Failed to create router, %v", err)
+	}
+
+	_, _, ok := r.Route(newMessage(`{}`))
+
+	if ok {
+		t.Fatalf("Expected no route without a default route")
+	}
+}
+
+func TestNewRouterFromConfigInvalid(t *testing.T) {
+
+	value := "x"
+	yes := true
+
+	invalid := [][]config.WebhookRouteConfig{
+		{},
+		{{Path: "a", Equals: &value}},
+		{{Path: "a", Equals: &value, Dispatchers: []string{"#a"}}},
+		{{Dispatchers: []string{"a"}}},
+		{{Path: "a", Dispatchers: []string{"a"}}},
+		{{Path: "a", Header: "b", Equals: &value, Dispatchers: []string{"a"}}},
+		{{Path: "a", Equals: &value, Exists: &yes, Dispatchers: []string{"a"}}},
+		{{Path: "a", Matches: "(", Dispatchers: []string{"a"}}},
+		{{Path: "a", Expr: "a", Dispatchers: []string{"a"}}},
+		{{Expr: "a ==", Dispatchers: []string{"a"}}},
+		{{Default: true, Path: "a", Dispatchers: []string{"a"}}},
+		{{Default: true, Dispatchers: []string{"a"}}, {Default: true, Dispatchers: []string{"b"}}},
+	}
+
+	for idx, routes := range invalid {
+
+		_, err := NewRouterFromConfig(routes)
+
+		if err == nil {
+			t.Fatalf("Expected routes at offset %d to fail", idx)
+		}
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+
+	body := `{
+  "severity": "Sev1",
+  "count": 3,
+  "resolved": false,
+  "name": "",
+  "fired": "2024-01-02T03:04:05Z",
+  "labels": {"team": "platform", "dotted.key": "yes"},
+  "items": [{"id": 1}, {"id": 2}]
+}`
+
+	tests := map[string]bool{
+		`severity == "Sev1"`:      true,
+		`severity != 'Sev1'`:      false,
+		`count == 3`:              true,
+		`count == "3"`:            true,
+		`count >= 3 && count < 4`: true,
+		`count > 3`:               false,
+		`fired > "2024-01-01"`:    true,
+		`severity =~ "^Sev[01]$"`: true,
+		`severity !~ "^Sev[01]$"`: false,
+		`missing =~ ".*"`:         false,
+		`missing !~ ".*"`:         true,
+		`missing == null`:         true,
+		`severity == null`:        false,
+		`resolved`:                false,
+		`!resolved`:               true,
+		`name`:                    false,
+		`exists(name)`:            true,
+		`exists(missing)`:         false,
+		`resolved == false`:       true,
+		`labels.team == "platform" || count > 10`:                true,
+		`!(labels.team == "platform") || count > 10`:             false,
+		`(count > 10 || labels.team == "platform") && !resolved`: true,
+		`path("labels.dotted\\.key") == "yes"`:                   true,
+		`labels.dotted\.key == "yes"`:                            true,
+		`items.#.id == "[1,2]"`:                                  true,
+		`items.# == 2`:                                           true,
+		`header("x-github-event") == "push"`:                     true,
+		`header("X-Missing") == null`:                            true,
+		`meta("event_type") =~ "^pu"`:                            true,
+		`count == -3`:                                            false,
+	}
+
+	msg := newMessage(body)
+
+	for expr, expected := range tests {
+
+		c, err := ParseExpression(expr)
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", expr, err)
+		}
+
+		if c.Match(msg) != expected {
+			t.Fatalf("Expected '%s' to be %t", expr, expected)
+		}
+	}
+}
+
+func TestParseExpressionInvalid(t *testing.T) {
+
+	invalid := []string{
+		``,
+		`severity ==`,
+		`== "Sev1"`,
+		`severity == "Sev1`,
+		`(severity == "Sev1"`,
+		`severity == "Sev1")`,
+		`severity =~ count`,
+		`severity =~ "("`,
+		`severity & count`,
+		`unknown("x")`,
+		`header(x)`,
+		`exists(`,
+		`severity == "Sev1" &&`,
+		`severity "Sev1"`,
+	}
+
+	for _, expr := range invalid {
+
+		_, err := ParseExpression(expr)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail", expr)
+		}
+	}
+}
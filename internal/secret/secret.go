@@ -0,0 +1,85 @@
+// Package secret provides methods for reading secret values (tokens, passwords, signing keys) from outside of a config file.
+package secret
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Read returns the secret stored in the environment variable 'env' or, if 'env' is empty, the contents of the file
+// at 'path'. Trailing whitespace (typically a newline left behind by editors or `kubectl create secret`) is removed.
+// It is an error for both or neither of 'env' and 'path' to be set, or for the resulting secret to be empty.
+func Read(env string, path string) (string, error) {
+
+	if env != "" && path != "" {
+		return "", fmt.Errorf("Secret must be read from either an environment variable or a file, not both")
+	}
+
+	var value string
+
+	switch {
+	case env != "":
+
+		v, ok := os.LookupEnv(env)
+
+		if !ok {
+			return "", fmt.Errorf("Environment variable '%s' is not set", env)
+		}
+
+		value = v
+
+	case path != "":
+
+		b, err := os.ReadFile(path)
+
+		if err != nil {
+			return "", fmt.Errorf("Failed to read secret file '%s', %w", path, err)
+		}
+
+		value = string(b)
+
+	default:
+		return "", fmt.Errorf("Missing secret environment variable or file")
+	}
+
+	value = strings.TrimRight(value, " \t\r\n")
+
+	if value == "" {
+		return "", fmt.Errorf("Secret is empty")
+	}
+
+	return value, nil
+}
+
+// ReadList returns the list of secrets returned by `Read` for 'env' and 'path' where each secret is separated by a comma or newline.
+// This is useful for supporting key rotation where more than one value is valid at a time.
+func ReadList(env string, path string) ([]string, error) {
+
+	value, err := Read(env, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+
+	list := make([]string, 0, len(fields))
+
+	for _, f := range fields {
+
+		f = strings.TrimSpace(f)
+
+		if f != "" {
+			list = append(list, f)
+		}
+	}
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("Secret is empty")
+	}
+
+	return list, nil
+}
@@ -0,0 +1,67 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+
+	t.Setenv("WEBHOOKD_TEST_SECRET", "s3cr3t")
+
+	v, err := Read("WEBHOOKD_TEST_SECRET", "")
+
+	if err != nil {
+		t.Fatalf("Failed to read secret from env, %v", err)
+	}
+
+	if v != "s3cr3t" {
+		t.Fatalf("Unexpected secret '%s'", v)
+	}
+
+	path := filepath.Join(t.TempDir(), "secret")
+
+	err = os.WriteFile(path, []byte("from-file\n"), 0600)
+
+	if err != nil {
+		t.Fatalf("Failed to write secret file, %v", err)
+	}
+
+	v, err = Read("", path)
+
+	if err != nil {
+		t.Fatalf("Failed to read secret from file, %v", err)
+	}
+
+	if v != "from-file" {
+		t.Fatalf("Unexpected secret '%s'", v)
+	}
+
+	_, err = Read("WEBHOOKD_TEST_SECRET", path)
+
+	if err == nil {
+		t.Fatalf("Expected reading from both env and file to fail")
+	}
+
+	_, err = Read("", "")
+
+	if err == nil {
+		t.Fatalf("Expected missing secret to fail")
+	}
+}
+
+func TestReadList(t *testing.T) {
+
+	t.Setenv("WEBHOOKD_TEST_SECRETS", "a, b\nc")
+
+	v, err := ReadList("WEBHOOKD_TEST_SECRETS", "")
+
+	if err != nil {
+		t.Fatalf("Failed to read secrets, %v", err)
+	}
+
+	if len(v) != 3 || v[0] != "a" || v[1] != "b" || v[2] != "c" {
+		t.Fatalf("Unexpected secrets %v", v)
+	}
+}
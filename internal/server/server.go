@@ -0,0 +1,185 @@
+// Package server provides methods for running, and gracefully shutting down, the HTTP server for a `webhookd` instance.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/logger"
+)
+
+const (
+	// DefaultListen is the default address the server listens on.
+	DefaultListen string = "0.0.0.0:8080"
+	// DefaultReadTimeout is the default maximum duration for reading an entire request.
+	DefaultReadTimeout time.Duration = 30 * time.Second
+	// DefaultReadHeaderTimeout is the default maximum duration for reading request headers.
+	DefaultReadHeaderTimeout time.Duration = 10 * time.Second
+	// DefaultWriteTimeout is the default maximum duration before timing out writes of a response.
+	DefaultWriteTimeout time.Duration = 2 * time.Minute
+	// DefaultIdleTimeout is the default maximum duration to wait for the next request on a keep-alive connection.
+	DefaultIdleTimeout time.Duration = 2 * time.Minute
+	// DefaultMaxHeaderBytes is the default maximum size of request headers.
+	DefaultMaxHeaderBytes int = http.DefaultMaxHeaderBytes
+	// DefaultShutdownGracePeriod is the default maximum duration to wait for in-flight requests when shutting down.
+	// It is shorter than the 30 seconds Kubernetes waits before killing a terminating pod.
+	DefaultShutdownGracePeriod time.Duration = 25 * time.Second
+)
+
+// type Server is a struct that wraps a `http.Server` instance with a grace period for shutting down.
+type Server struct {
+	// Server is the underlying `http.Server` instance.
+	*http.Server
+	// GracePeriod is the maximum duration to wait for in-flight requests to complete when shutting down.
+	GracePeriod time.Duration
+}
+
+// NewServerFromConfig() returns a new `Server` instance serving 'handler' derived from configuration data in 'cfg'.
+func NewServerFromConfig(cfg config.WebhookServerConfig, handler http.Handler) (*Server, error) {
+
+	read_timeout, err := parseDuration("read_timeout", cfg.ReadTimeout, DefaultReadTimeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	read_header_timeout, err := parseDuration("read_header_timeout", cfg.ReadHeaderTimeout, DefaultReadHeaderTimeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	write_timeout, err := parseDuration("write_timeout", cfg.WriteTimeout, DefaultWriteTimeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	idle_timeout, err := parseDuration("idle_timeout", cfg.IdleTimeout, DefaultIdleTimeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	grace_period, err := parseDuration("shutdown_grace_period", cfg.ShutdownGracePeriod, DefaultShutdownGracePeriod)
+
+	if err != nil {
+		return nil, err
+	}
+
+	listen := cfg.Listen
+
+	if listen == "" {
+		listen = DefaultListen
+	}
+
+	max_header_bytes := cfg.MaxHeaderBytes
+
+	if max_header_bytes < 0 {
+		return nil, fmt.Errorf("Invalid max_header_bytes, must not be negative")
+	}
+
+	if max_header_bytes == 0 {
+		max_header_bytes = DefaultMaxHeaderBytes
+	}
+
+	http_server := &http.Server{
+		Addr:              listen,
+		Handler:           handler,
+		ReadTimeout:       read_timeout,
+		ReadHeaderTimeout: read_header_timeout,
+		WriteTimeout:      write_timeout,
+		IdleTimeout:       idle_timeout,
+		MaxHeaderBytes:    max_header_bytes,
+	}
+
+	s := &Server{
+		Server:      http_server,
+		GracePeriod: grace_period,
+	}
+
+	return s, nil
+}
+
+// Run() listens on the server's address and serves requests until 'ctx' is cancelled. It then stops accepting new
+// connections and waits up to the server's grace period for in-flight requests to complete before returning.
+func (s *Server) Run(ctx context.Context) error {
+
+	ln, err := net.Listen("tcp", s.Addr)
+
+	if err != nil {
+		return fmt.Errorf("Failed to listen on %s, %w", s.Addr, err)
+	}
+
+	return s.Serve(ctx, ln)
+}
+
+// Serve() serves requests received by 'ln' until 'ctx' is cancelled and then shuts down gracefully, as described
+// in `Run`.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.Server.Serve(ln)
+	}()
+
+	logger.Log.Info("Server listening", "address", ln.Addr().String())
+
+	select {
+	case err := <-done:
+		return fmt.Errorf("Server stopped unexpectedly, %w", err)
+	case <-ctx.Done():
+		// pass
+	}
+
+	logger.Log.Info("Shutting down server", "grace_period", s.GracePeriod.String())
+
+	shutdown_ctx, cancel := context.WithTimeout(context.Background(), s.GracePeriod)
+	defer cancel()
+
+	err := s.Shutdown(shutdown_ctx)
+
+	if err != nil {
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			s.Close()
+		}
+
+		return fmt.Errorf("Failed to shut down server gracefully, %w", err)
+	}
+
+	err = <-done
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Server failed, %w", err)
+	}
+
+	logger.Log.Info("Server stopped")
+	return nil
+}
+
+// parseDuration returns 'value' parsed as a non-negative duration, or 'fallback' if 'value' is empty.
+func parseDuration(name string, value string, fallback time.Duration) (time.Duration, error) {
+
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s, %w", name, err)
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("Invalid %s, must not be negative", name)
+	}
+
+	return d, nil
+}
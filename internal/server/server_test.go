@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+)
+
+func TestNewServerFromConfig(t *testing.T) {
+
+	s, err := NewServerFromConfig(config.WebhookServerConfig{}, http.NotFoundHandler())
+
+	if err != nil {
+		t.Fatalf("Failed to create new server, %v", err)
+	}
+
+	if s.Addr != DefaultListen || s.WriteTimeout != DefaultWriteTimeout || s.MaxHeaderBytes != DefaultMaxHeaderBytes || s.GracePeriod != DefaultShutdownGracePeriod {
+		t.Fatalf("Unexpected defaults %+v", s)
+	}
+
+	cfg := config.WebhookServerConfig{
+		Listen:              "127.0.0.1:9090",
+		ReadTimeout:         "5s",
+		IdleTimeout:         "1m",
+		MaxHeaderBytes:      4096,
+		ShutdownGracePeriod: "10s",
+	}
+
+	s, err = NewServerFromConfig(cfg, http.NotFoundHandler())
+
+	if err != nil {
+		t.Fatalf("Failed to create new server, %v", err)
+	}
+
+	if s.Addr != "127.0.0.1:9090" || s.ReadTimeout != 5*time.Second || s.IdleTimeout != time.Minute || s.MaxHeaderBytes != 4096 || s.GracePeriod != 10*time.Second {
+		t.Fatalf("Unexpected settings %+v", s)
+	}
+
+	invalid := []config.WebhookServerConfig{
+		{ReadTimeout: "soon"},
+		{WriteTimeout: "-1s"},
+		{ShutdownGracePeriod: "forever"},
+		{MaxHeaderBytes: -1},
+	}
+
+	for _, cfg := range invalid {
+
+		_, err := NewServerFromConfig(cfg, http.NotFoundHandler())
+
+		if err == nil {
+			t.Fatalf("Expected %+v to fail", cfg)
+		}
+	}
+}
+
+func TestServeGracefulShutdown(t *testing.T) {
+
+	started := make(chan bool)
+	release := make(chan bool)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	s, err := NewServerFromConfig(config.WebhookServerConfig{ShutdownGracePeriod: "5s"}, handler)
+
+	if err != nil {
+		t.Fatalf("Failed to create new server, %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Failed to listen, %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stopped := make(chan error)
+
+	go func() {
+		stopped <- s.Serve(ctx, ln)
+	}()
+
+	responses := make(chan string)
+
+	go func() {
+
+		rsp, err := http.Get("http://" + ln.Addr().String())
+
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+
+		defer rsp.Body.Close()
+
+		body, _ := io.ReadAll(rsp.Body)
+		responses <- string(body)
+	}()
+
+	<-started
+
+	// Shutting down must wait for the in-flight request.
+
+	cancel()
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("Server stopped before in-flight request completed, %v", err)
+	case <-time.After(100 * time.Millisecond):
+		// pass
+	}
+
+	release <- true
+
+	if body := <-responses; body != "done" {
+		t.Fatalf("Unexpected response for in-flight request '%s'", body)
+	}
+
+	err = <-stopped
+
+	if err != nil {
+		t.Fatalf("Failed to shut down server, %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package threads
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterStore(ctx, "file", NewFileStore)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// FileStore implements the `Store` interface for storing threads in a local JSON file so that they are remembered
+// when the daemon restarts. The file is read once when the store is created and rewritten every time a thread is stored.
+type FileStore struct {
+	Store
+	// path is the path of the JSON file threads are stored in.
+	path string
+	// threads is the map of correlation keys to threads.
+	threads map[string]*Thread
+	// ttl is the time a thread is remembered after it was last updated.
+	ttl time.Duration
+	// mu guards `threads` and the file at `path`.
+	mu *sync.RWMutex
+}
+
+// NewFileStore returns a new `FileStore` instance configured by 'uri' in the form of:
+//
+//	file:///path/to/threads.json?ttl={DURATION}
+//
+// Where {DURATION} is the time a thread is remembered after it was last updated. Default is 168h. The file's
+// directory is created if it does not exist.
+func NewFileStore(ctx context.Context, uri string) (Store, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	path := u.Path
+
+	if path == "" {
+		return nil, fmt.Errorf("Missing file path")
+	}
+
+	ttl, err := parseTTL(u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create directory for '%s', %w", path, err)
+	}
+
+	s := FileStore{
+		path:    path,
+		threads: make(map[string]*Thread),
+		ttl:     ttl,
+		mu:      new(sync.RWMutex),
+	}
+
+	b, err := os.ReadFile(path)
+
+	switch {
+	case os.IsNotExist(err):
+		// pass
+	case err != nil:
+		return nil, fmt.Errorf("Failed to read '%s', %w", path, err)
+	default:
+
+		err = json.Unmarshal(b, &s.threads)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode '%s', %w", path, err)
+		}
+	}
+
+	return &s, nil
+}
+
+// Get returns the thread for the key 'key'.
+func (s *FileStore) Get(ctx context.Context, key string) (*Thread, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.threads[key]
+
+	if !ok || t.Expired(s.ttl) {
+		return nil, ErrNotFound
+	}
+
+	return t, nil
+}
+
+// Put stores the thread for the key 'key', removes any threads that have expired and rewrites the store's file.
+// The file is written to a temporary location and then renamed so that it is never left partially written.
+func (s *FileStore) Put(ctx context.Context, key string, t *Thread) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, other := range s.threads {
+
+		if other.Expired(s.ttl) {
+			delete(s.threads, k)
+		}
+	}
+
+	s.threads[key] = t
+
+	enc, err := json.MarshalIndent(s.threads, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode threads, %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+
+	err = os.WriteFile(tmp, enc, 0600)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write threads, %w", err)
+	}
+
+	err = os.Rename(tmp, s.path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to rename threads, %w", err)
+	}
+
+	return nil
+}
+
+// Close is a no-op.
+func (s *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,96 @@
+package threads
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterStore(ctx, "memory", NewMemoryStore)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// MemoryStore implements the `Store` interface for storing threads in memory. Threads are forgotten when
+// the daemon restarts.
+type MemoryStore struct {
+	Store
+	// threads is the map of correlation keys to threads.
+	threads map[string]*Thread
+	// ttl is the time a thread is remembered after it was last updated.
+	ttl time.Duration
+	// mu guards `threads`.
+	mu *sync.RWMutex
+}
+
+// NewMemoryStore returns a new `MemoryStore` instance configured by 'uri' in the form of:
+//
+//	memory://?ttl={DURATION}
+//
+// Where {DURATION} is the time a thread is remembered after it was last updated. Default is 168h.
+func NewMemoryStore(ctx context.Context, uri string) (Store, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	ttl, err := parseTTL(u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := MemoryStore{
+		threads: make(map[string]*Thread),
+		ttl:     ttl,
+		mu:      new(sync.RWMutex),
+	}
+
+	return &s, nil
+}
+
+// Get returns the thread for the key 'key'.
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Thread, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.threads[key]
+
+	if !ok || t.Expired(s.ttl) {
+		return nil, ErrNotFound
+	}
+
+	return t, nil
+}
+
+// Put stores the thread for the key 'key' and removes any threads that have expired.
+func (s *MemoryStore) Put(ctx context.Context, key string, t *Thread) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, other := range s.threads {
+
+		if other.Expired(s.ttl) {
+			delete(s.threads, k)
+		}
+	}
+
+	s.threads[key] = t
+	return nil
+}
+
+// Close is a no-op.
+func (s *MemoryStore) Close() error {
+	return nil
+}
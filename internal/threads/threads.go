@@ -0,0 +1,202 @@
+// Package threads provides an interface for remembering the chat messages that later updates to the same event are
+// threaded under or applied to.
+package threads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aaronland/go-roster"
+)
+
+// DefaultTTL is the time a thread is remembered after it was last updated, if a store is not configured with one.
+const DefaultTTL time.Duration = 7 * 24 * time.Hour
+
+// ErrNotFound is returned when a thread does not exist or has expired.
+var ErrNotFound = errors.New("thread not found")
+
+// type Thread is a struct identifying the first message posted for a correlation key.
+type Thread struct {
+	// Channel is the ID of the channel the message was posted to.
+	Channel string `json:"channel"`
+	// TS is the timestamp that identifies the message within its channel.
+	TS string `json:"ts"`
+	// Updated is the time the thread was last posted to.
+	Updated time.Time `json:"updated"`
+}
+
+// Expired reports whether 't' was last updated more than 'ttl' ago. A 'ttl' of zero or less never expires.
+func (t *Thread) Expired(ttl time.Duration) bool {
+	return ttl > 0 && time.Since(t.Updated) > ttl
+}
+
+// Store is an interface for storing threads by correlation key.
+type Store interface {
+	// Get() returns the thread for the key 'key' or `ErrNotFound`.
+	Get(context.Context, string) (*Thread, error)
+	// Put() stores the thread for the key 'key', replacing any existing thread.
+	Put(context.Context, string, *Thread) error
+	// Close() releases any resources held by the store.
+	Close() error
+}
+
+// stores is a `aaronland/go-roster.Roster` instance used to maintain a list of registered `Store` initialization functions.
+var stores roster.Roster
+
+// StoreInitializationFunc is a function used to initialize an implementation of the `Store` interface.
+type StoreInitializationFunc func(ctx context.Context, uri string) (Store, error)
+
+// NewStore() returns a new `Store` instance derived from 'uri'. The semantics of and requirements for
+// 'uri' as specific to the package implementing the interface.
+func NewStore(ctx context.Context, uri string) (Store, error) {
+
+	err := ensureStoreRoster()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to ensure store roster, %w", err)
+	}
+
+	parsed, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	scheme := parsed.Scheme
+
+	i, err := stores.Driver(ctx, scheme)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find initialization function for '%s', %w", scheme, err)
+	}
+
+	init_func := i.(StoreInitializationFunc)
+	return init_func(ctx, uri)
+}
+
+// shared is the map of URIs to the `Store` instances returned by `NewSharedStore`.
+var shared = make(map[string]Store)
+
+// sharedMu guards `shared`.
+var sharedMu = new(sync.Mutex)
+
+// NewSharedStore() returns the `Store` instance for 'uri', creating it with `NewStore` the first time it is requested.
+// Every caller asking for the same URI shares one instance for the life of the process, so that dispatchers created
+// for different webhooks, or by reloading the config, see (and don't overwrite) each other's threads. Callers must not
+// close shared stores.
+func NewSharedStore(ctx context.Context, uri string) (Store, error) {
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	s, ok := shared[uri]
+
+	if ok {
+		return s, nil
+	}
+
+	s, err := NewStore(ctx, uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	shared[uri] = s
+	return s, nil
+}
+
+// CheckURI() returns an error if 'uri' can not be parsed or its scheme is not registered, without creating a store.
+func CheckURI(uri string) error {
+
+	err := ensureStoreRoster()
+
+	if err != nil {
+		return fmt.Errorf("Failed to ensure store roster, %w", err)
+	}
+
+	parsed, err := url.Parse(uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	// Scheme names are registered in upper case.
+
+	for _, s := range Schemes() {
+
+		if strings.EqualFold(s, parsed.Scheme+"://") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Unknown scheme '%s://', must be one of %s", parsed.Scheme, strings.ToLower(strings.Join(Schemes(), ", ")))
+}
+
+// RegisterStore() associates 'scheme' with 'init_func' in an internal list of avilable `Store` implementations.
+func RegisterStore(ctx context.Context, scheme string, init_func StoreInitializationFunc) error {
+
+	err := ensureStoreRoster()
+
+	if err != nil {
+		return fmt.Errorf("Failed to ensure store roster, %w", err)
+	}
+
+	return stores.Register(ctx, scheme, init_func)
+}
+
+// ensureStoreRoster() ensures that a `aaronland/go-roster.Roster` instance used to maintain a list of registered `Store`
+// initialization functions is present
+func ensureStoreRoster() error {
+
+	if stores == nil {
+
+		r, err := roster.NewDefaultRoster()
+
+		if err != nil {
+			return fmt.Errorf("Failed to create new roster, %w", err)
+		}
+
+		stores = r
+	}
+
+	return nil
+}
+
+// Schemes() returns the list of schemes that have been "registered".
+func Schemes() []string {
+	ctx := context.Background()
+	drivers := stores.Drivers(ctx)
+
+	schemes := make([]string, len(drivers))
+
+	for idx, dr := range drivers {
+		schemes[idx] = fmt.Sprintf("%s://", dr)
+	}
+
+	sort.Strings(schemes)
+	return schemes
+}
+
+// parseTTL returns the value of the "ttl" query parameter of 'u', or `DefaultTTL` if it is not set.
+func parseTTL(u *url.URL) (time.Duration, error) {
+
+	q := u.Query()
+
+	if !q.Has("ttl") {
+		return DefaultTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(q.Get("ttl"))
+
+	if err != nil {
+		return 0, fmt.Errorf("Invalid ttl, %w", err)
+	}
+
+	return ttl, nil
+}
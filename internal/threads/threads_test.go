@@ -0,0 +1,109 @@
+package threads
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "slack", "threads.json")
+
+	for _, uri := range []string{"memory://?ttl=1h", "file://" + path + "?ttl=1h"} {
+
+		s, err := NewStore(ctx, uri)
+
+		if err != nil {
+			t.Fatalf("Failed to create store for '%s', %v", uri, err)
+		}
+
+		_, err = s.Get(ctx, "C123/abc")
+
+		if err != ErrNotFound {
+			t.Fatalf("Expected ErrNotFound for '%s', got %v", uri, err)
+		}
+
+		err = s.Put(ctx, "C123/abc", &Thread{Channel: "C123", TS: "1700000000.000100", Updated: time.Now()})
+
+		if err != nil {
+			t.Fatalf("Failed to put thread for '%s', %v", uri, err)
+		}
+
+		err = s.Put(ctx, "C123/old", &Thread{Channel: "C123", TS: "1600000000.000100", Updated: time.Now().Add(-2 * time.Hour)})
+
+		if err != nil {
+			t.Fatalf("Failed to put thread for '%s', %v", uri, err)
+		}
+
+		thr, err := s.Get(ctx, "C123/abc")
+
+		if err != nil {
+			t.Fatalf("Failed to get thread for '%s', %v", uri, err)
+		}
+
+		if thr.TS != "1700000000.000100" {
+			t.Fatalf("Unexpected thread for '%s', %v", uri, thr)
+		}
+
+		_, err = s.Get(ctx, "C123/old")
+
+		if err != ErrNotFound {
+			t.Fatalf("Expected expired thread to be ErrNotFound for '%s', got %v", uri, err)
+		}
+
+		s.Close()
+	}
+
+	// Threads stored in a file are remembered by a new store
+
+	s, err := NewStore(ctx, "file://"+path)
+
+	if err != nil {
+		t.Fatalf("Failed to reopen file store, %v", err)
+	}
+
+	defer s.Close()
+
+	_, err = s.Get(ctx, "C123/abc")
+
+	if err != nil {
+		t.Fatalf("Failed to get thread from reopened file store, %v", err)
+	}
+}
+
+func TestNewSharedStore(t *testing.T) {
+
+	ctx := context.Background()
+
+	uri := "file://" + filepath.Join(t.TempDir(), "threads.json")
+
+	a, err := NewSharedStore(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create shared store, %v", err)
+	}
+
+	b, err := NewSharedStore(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create shared store, %v", err)
+	}
+
+	if a != b {
+		t.Fatalf("Expected the same store to be returned for the same URI")
+	}
+
+	c, err := NewSharedStore(ctx, "memory://?ttl=1h")
+
+	if err != nil {
+		t.Fatalf("Failed to create shared store, %v", err)
+	}
+
+	if c == a {
+		t.Fatalf("Expected a different store to be returned for a different URI")
+	}
+}
@@ -0,0 +1,231 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/aaronland/go-roster"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exporters is a `aaronland/go-roster.Roster` instance used to maintain a list of registered `sdktrace.SpanExporter` initialization functions.
+var exporters roster.Roster
+
+// ExporterInitializationFunc is a function used to initialize an implementation of the `sdktrace.SpanExporter` interface.
+type ExporterInitializationFunc func(ctx context.Context, uri string) (sdktrace.SpanExporter, error)
+
+func init() {
+
+	ctx := context.Background()
+
+	err := RegisterExporter(ctx, "otlp", NewOTLPExporter)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = RegisterExporter(ctx, "stdout", NewStdoutExporter)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = RegisterExporter(ctx, "file", NewFileExporter)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// NewExporter() returns a new `sdktrace.SpanExporter` instance derived from 'uri'. The semantics of and requirements for
+// 'uri' as specific to the package implementing the interface.
+func NewExporter(ctx context.Context, uri string) (sdktrace.SpanExporter, error) {
+
+	err := ensureExporterRoster()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to ensure exporter roster, %w", err)
+	}
+
+	parsed, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	scheme := parsed.Scheme
+
+	i, err := exporters.Driver(ctx, scheme)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find initialization function for '%s', %w", scheme, err)
+	}
+
+	init_func := i.(ExporterInitializationFunc)
+	return init_func(ctx, uri)
+}
+
+// RegisterExporter() associates 'scheme' with 'init_func' in an internal list of avilable `sdktrace.SpanExporter` implementations.
+func RegisterExporter(ctx context.Context, scheme string, init_func ExporterInitializationFunc) error {
+
+	err := ensureExporterRoster()
+
+	if err != nil {
+		return fmt.Errorf("Failed to ensure exporter roster, %w", err)
+	}
+
+	return exporters.Register(ctx, scheme, init_func)
+}
+
+// ensureExporterRoster() ensures that a `aaronland/go-roster.Roster` instance used to maintain a list of registered `sdktrace.SpanExporter`
+// initialization functions is present
+func ensureExporterRoster() error {
+
+	if exporters == nil {
+
+		r, err := roster.NewDefaultRoster()
+
+		if err != nil {
+			return fmt.Errorf("Failed to create new roster, %w", err)
+		}
+
+		exporters = r
+	}
+
+	return nil
+}
+
+// Schemes() returns the list of schemes that have been "registered".
+func Schemes() []string {
+	ctx := context.Background()
+	drivers := exporters.Drivers(ctx)
+
+	schemes := make([]string, len(drivers))
+
+	for idx, dr := range drivers {
+		schemes[idx] = fmt.Sprintf("%s://", dr)
+	}
+
+	sort.Strings(schemes)
+	return schemes
+}
+
+// NewOTLPExporter returns a new OTLP/HTTP `sdktrace.SpanExporter` instance configured by 'uri' in the form of:
+//
+//	otlp://{HOST}:{PORT}?insecure={BOOLEAN}&path={PATH}
+//
+// If {HOST} is empty the standard `OTEL_EXPORTER_OTLP_ENDPOINT` and `OTEL_EXPORTER_OTLP_TRACES_ENDPOINT` environment
+// variables, or "localhost:4318", are used. Set 'insecure' to true to send spans over plain HTTP.
+func NewOTLPExporter(ctx context.Context, uri string) (sdktrace.SpanExporter, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	opts := make([]otlptracehttp.Option, 0)
+
+	if u.Host != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+	}
+
+	if q.Has("path") {
+		opts = append(opts, otlptracehttp.WithURLPath(q.Get("path")))
+	}
+
+	if q.Has("insecure") {
+
+		insecure, err := strconv.ParseBool(q.Get("insecure"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid insecure parameter, %w", err)
+		}
+
+		if insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+	}
+
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// NewStdoutExporter returns a new `sdktrace.SpanExporter` instance that writes spans to STDOUT configured by 'uri' in the form of:
+//
+//	stdout://?pretty={BOOLEAN}
+func NewStdoutExporter(ctx context.Context, uri string) (sdktrace.SpanExporter, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	opts := []stdouttrace.Option{
+		stdouttrace.WithWriter(os.Stdout),
+	}
+
+	if u.Query().Get("pretty") == "true" {
+		opts = append(opts, stdouttrace.WithPrettyPrint())
+	}
+
+	return stdouttrace.New(opts...)
+}
+
+// NewFileExporter returns a new `sdktrace.SpanExporter` instance that appends spans, one JSON object per line, to a
+// local file configured by 'uri' in the form of:
+//
+//	file:///{PATH}
+func NewFileExporter(ctx context.Context, uri string) (sdktrace.SpanExporter, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	if u.Path == "" {
+		return nil, fmt.Errorf("Missing path")
+	}
+
+	fh, err := os.OpenFile(u.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open '%s', %w", u.Path, err)
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(fh))
+
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+
+	return &fileExporter{SpanExporter: exporter, fh: fh}, nil
+}
+
+// type fileExporter is a struct that closes the file a `stdouttrace` exporter writes to when it is shut down.
+type fileExporter struct {
+	sdktrace.SpanExporter
+	fh *os.File
+}
+
+// Shutdown stops the exporter and closes its file.
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+
+	err := e.SpanExporter.Shutdown(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return e.fh.Close()
+}
@@ -0,0 +1,205 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// endSpan records the outcome of 'err' on 'span' and ends it.
+func endSpan(span trace.Span, err *webhookd.WebhookError) {
+
+	defer span.End()
+
+	if err == nil {
+		return
+	}
+
+	span.SetAttributes(attribute.Int("webhookd.error.code", err.Code))
+
+	switch err.Code {
+	case webhookd.UnhandledEvent, webhookd.HaltEvent:
+		span.SetAttributes(attribute.Bool("webhookd.halted", true))
+	default:
+		span.SetStatus(codes.Error, err.Message)
+	}
+}
+
+// TracedReceiver implements the `webhookd.WebhookReceiver` interface, creating a span for every call to another receiver.
+type TracedReceiver struct {
+	webhookd.WebhookReceiver
+	endpoint string
+	scheme   string
+	receiver webhookd.WebhookReceiver
+}
+
+// NewTracedReceiver returns a new `TracedReceiver` instance for 'r', with the scheme 'scheme', used by 'endpoint'.
+func NewTracedReceiver(endpoint string, scheme string, r webhookd.WebhookReceiver) webhookd.WebhookReceiver {
+
+	t := TracedReceiver{
+		endpoint: endpoint,
+		scheme:   scheme,
+		receiver: r,
+	}
+
+	return &t
+}
+
+// Receive calls the underlying receiver inside a "receive" span.
+func (t *TracedReceiver) Receive(ctx context.Context, req *http.Request) ([]byte, *webhookd.WebhookError) {
+
+	ctx, span := t.start(ctx)
+
+	body, err := t.receiver.Receive(ctx, req)
+
+	endSpan(span, err)
+	return body, err
+}
+
+// ReceiveMessage calls the underlying receiver, using `webhookd.ReceiveMessage`, inside a "receive" span.
+func (t *TracedReceiver) ReceiveMessage(ctx context.Context, req *http.Request) (*webhookd.Message, *webhookd.WebhookError) {
+
+	ctx, span := t.start(ctx)
+
+	msg, err := webhookd.ReceiveMessage(ctx, t.receiver, req)
+
+	endSpan(span, err)
+	return msg, err
+}
+
+// start starts a new "receive" span.
+func (t *TracedReceiver) start(ctx context.Context) (context.Context, trace.Span) {
+
+	return Tracer().Start(ctx, fmt.Sprintf("receive %s", t.scheme), trace.WithAttributes(
+		attribute.String("webhookd.endpoint", t.endpoint),
+		attribute.String("webhookd.receiver", t.scheme),
+	))
+}
+
+// TracedTransformation implements the `webhookd.WebhookTransformation` interface, creating a span for every call
+// to another transformation.
+type TracedTransformation struct {
+	webhookd.WebhookTransformation
+	endpoint       string
+	scheme         string
+	offset         int
+	transformation webhookd.WebhookTransformation
+}
+
+// NewTracedTransformation returns a new `TracedTransformation` instance for 't', with the scheme 'scheme', used at
+// 'offset' in the transformation chain for 'endpoint'.
+func NewTracedTransformation(endpoint string, scheme string, offset int, t webhookd.WebhookTransformation) webhookd.WebhookTransformation {
+
+	tr := TracedTransformation{
+		endpoint:       endpoint,
+		scheme:         scheme,
+		offset:         offset,
+		transformation: t,
+	}
+
+	return &tr
+}
+
+// Transform calls the underlying transformation inside a "transform" span.
+func (t *TracedTransformation) Transform(ctx context.Context, body []byte) ([]byte, *webhookd.WebhookError) {
+
+	ctx, span := t.start(ctx)
+
+	body, err := t.transformation.Transform(ctx, body)
+
+	endSpan(span, err)
+	return body, err
+}
+
+// TransformMessage calls the underlying transformation, using `webhookd.TransformMessage`, inside a "transform" span.
+func (t *TracedTransformation) TransformMessage(ctx context.Context, msg *webhookd.Message) (*webhookd.Message, *webhookd.WebhookError) {
+
+	ctx, span := t.start(ctx)
+
+	msg, err := webhookd.TransformMessage(ctx, t.transformation, msg)
+
+	endSpan(span, err)
+	return msg, err
+}
+
+// start starts a new "transform" span.
+func (t *TracedTransformation) start(ctx context.Context) (context.Context, trace.Span) {
+
+	return Tracer().Start(ctx, fmt.Sprintf("transform %s", t.scheme), trace.WithAttributes(
+		attribute.String("webhookd.endpoint", t.endpoint),
+		attribute.String("webhookd.transformation", t.scheme),
+		attribute.Int("webhookd.offset", t.offset),
+	))
+}
+
+// TracedDispatcher implements the `webhookd.WebhookDispatcher` interface, creating a span for every call to another
+// dispatcher.
+type TracedDispatcher struct {
+	webhookd.WebhookDispatcher
+	endpoint   string
+	name       string
+	scheme     string
+	dispatcher webhookd.WebhookDispatcher
+}
+
+// NewTracedDispatcher returns a new `TracedDispatcher` instance for 'd', labeled 'name' with the scheme 'scheme',
+// used by 'endpoint'.
+func NewTracedDispatcher(endpoint string, name string, scheme string, d webhookd.WebhookDispatcher) webhookd.WebhookDispatcher {
+
+	t := TracedDispatcher{
+		endpoint:   endpoint,
+		name:       name,
+		scheme:     scheme,
+		dispatcher: d,
+	}
+
+	return &t
+}
+
+// Close closes the underlying dispatcher.
+func (t *TracedDispatcher) Close() error {
+	return webhookd.CloseDispatcher(t.dispatcher)
+}
+
+// Preview returns the payload the underlying dispatcher would send for 'msg'.
+func (t *TracedDispatcher) Preview(ctx context.Context, msg *webhookd.Message) ([]byte, *webhookd.WebhookError) {
+	return webhookd.PreviewMessage(ctx, t.dispatcher, msg)
+}
+
+// Dispatch calls the underlying dispatcher inside a "dispatch" span. HTTP-based dispatchers propagate the span's
+// context to the services they relay messages to.
+func (t *TracedDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	ctx, span := t.start(ctx)
+
+	err := t.dispatcher.Dispatch(ctx, body)
+
+	endSpan(span, err)
+	return err
+}
+
+// DispatchMessage calls the underlying dispatcher, using `webhookd.DispatchMessage`, inside a "dispatch" span.
+func (t *TracedDispatcher) DispatchMessage(ctx context.Context, msg *webhookd.Message) *webhookd.WebhookError {
+
+	ctx, span := t.start(ctx)
+
+	err := webhookd.DispatchMessage(ctx, t.dispatcher, msg)
+
+	endSpan(span, err)
+	return err
+}
+
+// start starts a new "dispatch" span.
+func (t *TracedDispatcher) start(ctx context.Context) (context.Context, trace.Span) {
+
+	return Tracer().Start(ctx, fmt.Sprintf("dispatch %s", t.name), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("webhookd.endpoint", t.endpoint),
+		attribute.String("webhookd.dispatcher", t.name),
+		attribute.String("webhookd.scheme", t.scheme),
+	))
+}
@@ -0,0 +1,181 @@
+// Package tracing provides methods for tracing webhook requests through their receiver, transformations and
+// dispatchers using OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer used for spans created by `webhookd`.
+const TracerName string = "github.com/bobertrublik/webhook-router"
+
+// DefaultServiceName is the default value of the "service.name" resource attribute.
+const DefaultServiceName string = "webhookd"
+
+func init() {
+
+	// Propagate W3C trace context even if no exporter is configured so that incoming
+	// traces are continued by outgoing dispatches.
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Tracer() returns the `trace.Tracer` used to create spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Setup() configures the global OpenTelemetry tracer provider according to 'cfg' and returns a function that flushes
+// and stops it. If no exporter is configured spans are not recorded and the returned function is a no-op.
+func Setup(ctx context.Context, cfg config.WebhookTracingConfig) (func(context.Context) error, error) {
+
+	if cfg.Exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := NewExporter(ctx, cfg.Exporter)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create span exporter, %w", err)
+	}
+
+	service_name := cfg.ServiceName
+
+	if service_name == "" {
+		service_name = DefaultServiceName
+	}
+
+	ratio := cfg.SampleRatio
+
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("Invalid sample_ratio, must be between 0.0 and 1.0")
+	}
+
+	if ratio == 0 {
+		ratio = 1.0
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service_name)))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create resource, %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Inject() returns the trace context of 'ctx' as a dictionary of W3C trace context headers, suitable for storing
+// alongside messages that are processed later.
+func Inject(ctx context.Context) map[string]string {
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	if len(carrier) == 0 {
+		return nil
+	}
+
+	return carrier
+}
+
+// Extract() returns a copy of 'ctx' containing the trace context stored in 'carrier' by `Inject`.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+
+	if len(carrier) == 0 {
+		return ctx
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// Handler() returns a `http.Handler` that continues the trace in the request's "traceparent" header, if present,
+// and wraps 'h' in a server span for 'endpoint'.
+func Handler(endpoint string, h http.Handler) http.Handler {
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := Tracer().Start(ctx, fmt.Sprintf("%s %s", r.Method, endpoint),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPRoute(endpoint),
+				attribute.String("webhookd.endpoint", endpoint),
+			),
+		)
+
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		h.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCode(sw.status))
+
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// type statusWriter is a struct that wraps a `http.ResponseWriter` to record the response status code.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records 'status' and writes it to the underlying `http.ResponseWriter`.
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the underlying `http.ResponseWriter`.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Transport() returns a `http.RoundTripper` that adds the trace context of each request's context to its headers
+// before passing it to 'rt'.
+func Transport(rt http.RoundTripper) http.RoundTripper {
+	return &transport{rt: rt}
+}
+
+// type transport is a struct implementing the `http.RoundTripper` interface to propagate trace context.
+type transport struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip adds W3C trace context headers to a copy of 'req' and passes it to the underlying `http.RoundTripper`.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	// RoundTrippers must not modify the original request.
+
+	req = req.Clone(req.Context())
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+
+	return t.rt.RoundTrip(req)
+}
@@ -0,0 +1,220 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/config"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestReceiver implements the `webhookd.WebhookReceiver` interface and returns a fixed body.
+type TestReceiver struct {
+	webhookd.WebhookReceiver
+}
+
+func (r *TestReceiver) Receive(ctx context.Context, req *http.Request) ([]byte, *webhookd.WebhookError) {
+	return []byte("hello world"), nil
+}
+
+// TestTransformation implements the `webhookd.WebhookTransformation` interface and halts every message.
+type TestTransformation struct {
+	webhookd.WebhookTransformation
+}
+
+func (t *TestTransformation) Transform(ctx context.Context, body []byte) ([]byte, *webhookd.WebhookError) {
+	return nil, &webhookd.WebhookError{Code: webhookd.HaltEvent, Message: "halt"}
+}
+
+// TestDispatcher implements the `webhookd.WebhookDispatcher` interface and sends messages to `url`.
+type TestDispatcher struct {
+	webhookd.WebhookDispatcher
+	url string
+}
+
+func (d *TestDispatcher) Dispatch(ctx context.Context, body []byte) *webhookd.WebhookError {
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, d.url, nil)
+
+	cl := &http.Client{Transport: Transport(http.DefaultTransport)}
+	rsp, err := cl.Do(req)
+
+	if err != nil {
+		return &webhookd.WebhookError{Code: http.StatusBadGateway, Message: err.Error()}
+	}
+
+	rsp.Body.Close()
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+
+	ctx := context.Background()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	otel.SetTracerProvider(provider)
+	defer provider.Shutdown(ctx)
+
+	var downstream string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstream = r.Header.Get("traceparent")
+	}))
+
+	defer srv.Close()
+
+	h := Handler("/test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := r.Context()
+
+		body, _ := NewTracedReceiver("/test", "passthrough", &TestReceiver{}).Receive(ctx, r)
+		NewTracedTransformation("/test", "filter", 0, &TestTransformation{}).Transform(ctx, body)
+		NewTracedDispatcher("/test", "downstream", "http", &TestDispatcher{url: srv.URL}).Dispatch(ctx, body)
+	}))
+
+	trace_id := "4bf92f3577b34da6a3ce929d0e0e4736"
+	parent_id := "00f067aa0ba902b7"
+
+	req := httptest.NewRequest("POST", "/test", nil)
+	req.Header.Set("traceparent", "00-"+trace_id+"-"+parent_id+"-01")
+
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+
+	if len(spans) != 4 {
+		t.Fatalf("Expected 4 spans, got %d", len(spans))
+	}
+
+	byName := make(map[string]tracetest.SpanStub)
+
+	for _, s := range spans {
+
+		if s.SpanContext.TraceID().String() != trace_id {
+			t.Fatalf("Span '%s' did not continue incoming trace", s.Name)
+		}
+
+		byName[s.Name] = s
+	}
+
+	root, ok := byName["POST /test"]
+
+	if !ok {
+		t.Fatalf("Missing request span")
+	}
+
+	if root.Parent.SpanID().String() != parent_id {
+		t.Fatalf("Request span has unexpected parent %s", root.Parent.SpanID())
+	}
+
+	for _, name := range []string{"receive passthrough", "transform filter", "dispatch downstream"} {
+
+		s, ok := byName[name]
+
+		if !ok {
+			t.Fatalf("Missing span '%s'", name)
+		}
+
+		if s.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Fatalf("Span '%s' is not a child of the request span", name)
+		}
+	}
+
+	dispatch := byName["dispatch downstream"]
+
+	if !strings.Contains(downstream, trace_id+"-"+dispatch.SpanContext.SpanID().String()) {
+		t.Fatalf("Unexpected traceparent for outgoing request '%s'", downstream)
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+
+	ctx := context.Background()
+
+	provider := sdktrace.NewTracerProvider()
+	defer provider.Shutdown(ctx)
+
+	ctx, span := provider.Tracer("test").Start(ctx, "test")
+	defer span.End()
+
+	carrier := Inject(ctx)
+
+	if !strings.Contains(carrier["traceparent"], span.SpanContext().TraceID().String()) {
+		t.Fatalf("Unexpected carrier %v", carrier)
+	}
+
+	if Inject(context.Background()) != nil {
+		t.Fatalf("Expected no carrier without a span")
+	}
+
+	extracted := Extract(context.Background(), carrier)
+
+	_, child := provider.Tracer("test").Start(extracted, "child")
+	defer child.End()
+
+	if child.SpanContext().TraceID() != span.SpanContext().TraceID() {
+		t.Fatalf("Extracted context did not continue trace")
+	}
+}
+
+func TestSetupFileExporter(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+
+	shutdown, err := Setup(ctx, config.WebhookTracingConfig{Exporter: "file://" + path, ServiceName: "webhookd-test"})
+
+	if err != nil {
+		t.Fatalf("Failed to set up tracing, %v", err)
+	}
+
+	_, span := Tracer().Start(ctx, "file-exporter-test")
+	span.End()
+
+	err = shutdown(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to shut down tracing, %v", err)
+	}
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Failed to read traces, %v", err)
+	}
+
+	if !strings.Contains(string(body), "file-exporter-test") || !strings.Contains(string(body), "webhookd-test") {
+		t.Fatalf("Unexpected traces '%s'", string(body))
+	}
+}
+
+func TestSetupInvalid(t *testing.T) {
+
+	ctx := context.Background()
+
+	invalid := []config.WebhookTracingConfig{
+		{Exporter: "chicken://"},
+		{Exporter: "stdout://", SampleRatio: 2},
+		{Exporter: "file://"},
+	}
+
+	for _, cfg := range invalid {
+
+		_, err := Setup(ctx, cfg)
+
+		if err == nil {
+			t.Fatalf("Expected %+v to fail", cfg)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package transformation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/tidwall/gjson"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterTransformation(ctx, "azure-maintenance-teams", NewAzureMaintenanceTeamsTransformation)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// type AdaptiveCard is a struct containing the subset of the Adaptive Card schema used to post messages to Microsoft Teams.
+type AdaptiveCard struct {
+	Type    string        `json:"type"`
+	Schema  string        `json:"$schema"`
+	Version string        `json:"version"`
+	Body    []CardElement `json:"body"`
+	MSTeams *CardMSTeams  `json:"msteams,omitempty"`
+}
+
+// type CardElement is a struct containing a single TextBlock or FactSet element of an `AdaptiveCard`.
+type CardElement struct {
+	Type     string     `json:"type"`
+	Text     string     `json:"text,omitempty"`
+	Size     string     `json:"size,omitempty"`
+	Weight   string     `json:"weight,omitempty"`
+	IsSubtle bool       `json:"isSubtle,omitempty"`
+	Wrap     bool       `json:"wrap,omitempty"`
+	Facts    []CardFact `json:"facts,omitempty"`
+}
+
+// type CardFact is a struct containing a single title and value pair of a FactSet element.
+type CardFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// type CardMSTeams is a struct containing the Teams specific properties of an `AdaptiveCard`.
+type CardMSTeams struct {
+	Width string `json:"width,omitempty"`
+}
+
+// AzureMaintenanceTeamsTransformation implements the `webhookd.WebhookTransformation` interface for turning Azure
+// Service Health alerts into an Adaptive Card for the `teams://` dispatcher.
+type AzureMaintenanceTeamsTransformation struct {
+	webhookd.WebhookTransformation
+}
+
+// NewAzureMaintenanceTeamsTransformation returns a new `AzureMaintenanceTeamsTransformation` instance configured by 'uri' in the form of:
+//
+//	azure-maintenance-teams://
+func NewAzureMaintenanceTeamsTransformation(ctx context.Context, uri string) (webhookd.WebhookTransformation, error) {
+
+	p := AzureMaintenanceTeamsTransformation{}
+	return &p, nil
+}
+
+// Transform returns an Adaptive Card containing the same fields of the Azure Service Health alert in 'body' as
+// `AzureMaintenanceTransformation`.
+func (p *AzureMaintenanceTeamsTransformation) Transform(ctx context.Context, body []byte) ([]byte, *webhookd.WebhookError) {
+
+	alertRule := gjson.GetBytes(body, "data.essentials.alertRule")
+	description := gjson.GetBytes(body, "data.essentials.description")
+	start := gjson.GetBytes(body, "data.alertContext.properties.impactStartTime")
+	end := gjson.GetBytes(body, "data.alertContext.properties.impactMitigationTime")
+	stage := gjson.GetBytes(body, "data.alertContext.properties.stage")
+	communication := gjson.GetBytes(body, "data.alertContext.properties.communication")
+	status := gjson.GetBytes(body, "data.alertContext.status")
+
+	card := AdaptiveCard{
+		Type:    "AdaptiveCard",
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Version: "1.4",
+		Body: []CardElement{
+			{
+				Type:   "TextBlock",
+				Text:   "Service Health Alert",
+				Size:   "Large",
+				Weight: "Bolder",
+				Wrap:   true,
+			},
+			{
+				Type:     "TextBlock",
+				Text:     alertRule.String(),
+				IsSubtle: true,
+				Wrap:     true,
+			},
+			{
+				Type: "FactSet",
+				Facts: []CardFact{
+					{
+						Title: "Start",
+						Value: start.String(),
+					},
+					{
+						Title: "Stage",
+						Value: stage.String(),
+					},
+					{
+						Title: "End",
+						Value: end.String(),
+					},
+					{
+						Title: "Status",
+						Value: status.String(),
+					},
+				},
+			},
+			{
+				Type: "TextBlock",
+				Text: description.String(),
+				Wrap: true,
+			},
+			{
+				Type: "TextBlock",
+				Text: communication.String(),
+				Wrap: true,
+			},
+		},
+		MSTeams: &CardMSTeams{
+			Width: "Full",
+		},
+	}
+
+	jsonData, err := json.MarshalIndent(card, "", "    ")
+
+	if err != nil {
+		return nil, &webhookd.WebhookError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	return jsonData, nil
+}
@@ -0,0 +1,57 @@
+package transformation
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestAzureMaintenanceTeamsTransformation(t *testing.T) {
+
+	ctx := context.Background()
+
+	tr, err := NewTransformation(ctx, "azure-maintenance-teams://")
+
+	if err != nil {
+		t.Fatalf("Failed to create new transformation, %v", err)
+	}
+
+	input := []byte(`{
+  "data": {
+    "essentials": {"alertRule": "Planned \"maintenance\"", "description": "Maintenance for SQL"},
+    "alertContext": {
+      "status": "Active",
+      "properties": {"impactStartTime": "2024-01-02T03:04:05Z", "stage": "Planned", "communication": "Details"}
+    }
+  }
+}`)
+
+	output, err2 := tr.Transform(ctx, input)
+
+	if err2 != nil {
+		t.Fatalf("Failed to transform body, %v", err2)
+	}
+
+	if !json.Valid(output) {
+		t.Fatalf("Invalid JSON output '%s'", string(output))
+	}
+
+	expected := map[string]string{
+		"type":                 "AdaptiveCard",
+		"body.1.text":          `Planned "maintenance"`,
+		"body.2.facts.0.value": "2024-01-02T03:04:05Z",
+		"body.2.facts.1.value": "Planned",
+		"body.2.facts.3.value": "Active",
+		"body.3.text":          "Maintenance for SQL",
+		"body.4.text":          "Details",
+	}
+
+	for path, v := range expected {
+
+		if gjson.GetBytes(output, path).String() != v {
+			t.Fatalf("Unexpected value for %s: '%s'", path, gjson.GetBytes(output, path).String())
+		}
+	}
+}
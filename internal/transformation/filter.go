@@ -0,0 +1,155 @@
+package transformation
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bobertrublik/webhook-router/internal/routing"
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterTransformation(ctx, "filter", NewFilterTransformation)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// type filterRule is a struct containing a single include or exclude rule for a `FilterTransformation`.
+type filterRule struct {
+	// expr is the expression the rule was parsed from, used to explain why an event was halted.
+	expr string
+	// condition is the `routing.Condition` parsed from `expr`.
+	condition routing.Condition
+}
+
+// FilterTransformation implements the `webhookd.WebhookTransformation` interface for halting events which do not match
+// a set of rules. Messages which are not halted are not altered.
+type FilterTransformation struct {
+	webhookd.WebhookTransformation
+	// include is the list of rules every message must match.
+	include []*filterRule
+	// exclude is the list of rules no message may match.
+	exclude []*filterRule
+}
+
+// NewFilterTransformation returns a new `FilterTransformation` instance configured by 'uri' in the form of:
+//
+//	filter://?include={EXPRESSION}&exclude={EXPRESSION}
+//
+// Where {EXPRESSION} is a condition in the syntax described by `routing.ParseExpression`, for example
+// `data.essentials.monitorCondition == "Resolved"`. Both parameters may be repeated. A message is passed on if it
+// matches every include rule and no exclude rule, otherwise the transformation returns a `webhookd.HaltEvent` error.
+// Literal "+" characters are preserved; "&", "#" and "%" must be percent-encoded.
+func NewFilterTransformation(ctx context.Context, uri string) (webhookd.WebhookTransformation, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	if u.Fragment != "" {
+		return nil, fmt.Errorf("Unexpected fragment '%s', '#' characters in expressions must be written as %%23", u.Fragment)
+	}
+
+	// Expressions are more likely to contain regular expressions than URL-encoded spaces
+	// so "+" is not decoded as a space.
+
+	q, err := url.ParseQuery(strings.ReplaceAll(u.RawQuery, "+", "%2B"))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse query, %w", err)
+	}
+
+	include, err := newFilterRules(q["include"])
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid include rule, %w", err)
+	}
+
+	exclude, err := newFilterRules(q["exclude"])
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid exclude rule, %w", err)
+	}
+
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, fmt.Errorf("Missing include or exclude parameter")
+	}
+
+	tr := FilterTransformation{
+		include: include,
+		exclude: exclude,
+	}
+
+	return &tr, nil
+}
+
+// newFilterRules returns a list of `filterRule` instances parsed from 'exprs'.
+func newFilterRules(exprs []string) ([]*filterRule, error) {
+
+	rules := make([]*filterRule, 0, len(exprs))
+
+	for _, expr := range exprs {
+
+		c, err := routing.ParseExpression(expr)
+
+		if err != nil {
+			return nil, fmt.Errorf("'%s', %w", expr, err)
+		}
+
+		rules = append(rules, &filterRule{expr: expr, condition: c})
+	}
+
+	return rules, nil
+}
+
+// Transform returns 'body' unaltered if it matches the transformation's rules, otherwise a `webhookd.HaltEvent` error
+// describing the rule which halted it.
+func (tr *FilterTransformation) Transform(ctx context.Context, body []byte) ([]byte, *webhookd.WebhookError) {
+
+	msg, err := tr.TransformMessage(ctx, webhookd.NewMessage(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return msg.Body, nil
+}
+
+// TransformMessage returns 'msg' unaltered if it matches the transformation's rules, otherwise a `webhookd.HaltEvent`
+// error describing the rule which halted it. Rules may test the message's headers and metadata as well as its body.
+func (tr *FilterTransformation) TransformMessage(ctx context.Context, msg *webhookd.Message) (*webhookd.Message, *webhookd.WebhookError) {
+
+	for _, r := range tr.include {
+
+		if !r.condition.Match(msg) {
+
+			code := webhookd.HaltEvent
+			message := fmt.Sprintf("Event does not match include rule '%s'", r.expr)
+
+			err := &webhookd.WebhookError{Code: code, Message: message}
+			return nil, err
+		}
+	}
+
+	for _, r := range tr.exclude {
+
+		if r.condition.Match(msg) {
+
+			code := webhookd.HaltEvent
+			message := fmt.Sprintf("Event matches exclude rule '%s'", r.expr)
+
+			err := &webhookd.WebhookError{Code: code, Message: message}
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,105 @@
+package transformation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+)
+
+func TestFilterTransformation(t *testing.T) {
+
+	ctx := context.Background()
+
+	uri := `filter://?exclude=data.essentials.monitorCondition == "Resolved"&exclude=data.essentials.severity =~ "^Info.+"&include=exists(data.essentials.alertRule)`
+
+	tr, err := NewTransformation(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create new transformation, %v", err)
+	}
+
+	tests := map[string]bool{
+		`{"data": {"essentials": {"alertRule": "cpu", "severity": "Sev1", "monitorCondition": "Fired"}}}`:          true,
+		`{"data": {"essentials": {"alertRule": "cpu", "severity": "Sev1", "monitorCondition": "Resolved"}}}`:       false,
+		`{"data": {"essentials": {"alertRule": "cpu", "severity": "Informational", "monitorCondition": "Fired"}}}`: false,
+		`{"data": {"essentials": {"severity": "Sev1", "monitorCondition": "Fired"}}}`:                              false,
+	}
+
+	for body, expected := range tests {
+
+		output, err := tr.Transform(ctx, []byte(body))
+
+		if !expected {
+
+			if err == nil || err.Code != webhookd.HaltEvent {
+				t.Fatalf("Expected %s to be halted, got %v", body, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to transform %s, %v", body, err)
+		}
+
+		if string(output) != body {
+			t.Fatalf("Unexpected output '%s'", string(output))
+		}
+	}
+
+	_, err2 := tr.Transform(ctx, []byte(`{"data": {"essentials": {"alertRule": "cpu", "monitorCondition": "Resolved"}}}`))
+
+	if err2 == nil || err2.Message != `Event matches exclude rule 'data.essentials.monitorCondition == "Resolved"'` {
+		t.Fatalf("Unexpected halt reason, %v", err2)
+	}
+}
+
+func TestFilterTransformationMessage(t *testing.T) {
+
+	ctx := context.Background()
+
+	tr, err := NewTransformation(ctx, `filter://?include=meta("event_type") == "push" %26%26 ref == "refs/heads/main"`)
+
+	if err != nil {
+		t.Fatalf("Failed to create new transformation, %v", err)
+	}
+
+	msg := webhookd.NewMessage([]byte(`{"ref": "refs/heads/main"}`))
+	msg.Metadata[webhookd.MetadataEventType] = "push"
+
+	_, err2 := webhookd.TransformMessage(ctx, tr, msg)
+
+	if err2 != nil {
+		t.Fatalf("Failed to transform message, %v", err2)
+	}
+
+	msg.Metadata[webhookd.MetadataEventType] = "issues"
+
+	_, err2 = webhookd.TransformMessage(ctx, tr, msg)
+
+	if err2 == nil || err2.Code != webhookd.HaltEvent {
+		t.Fatalf("Expected message to be halted, got %v", err2)
+	}
+}
+
+func TestNewFilterTransformationInvalid(t *testing.T) {
+
+	ctx := context.Background()
+
+	invalid := []string{
+		"filter://",
+		"filter://?include=",
+		`filter://?exclude=severity ==`,
+		`filter://?exclude=items.# > 2`,
+	}
+
+	for _, uri := range invalid {
+
+		_, err := NewTransformation(ctx, uri)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail", uri)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package transformation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterTransformation(ctx, "jsonschema", NewJSONSchemaTransformation)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// JSONSchemaTransformation implements the `webhookd.WebhookTransformation` interface for validating messages against
+// a JSON schema. Messages are not altered.
+type JSONSchemaTransformation struct {
+	webhookd.WebhookTransformation
+	// schema is the compiled JSON schema used to validate messages.
+	schema *jsonschema.Schema
+}
+
+// NewJSONSchemaTransformation returns a new `JSONSchemaTransformation` instance configured by 'uri' in the form of:
+//
+//	jsonschema://?schema={PATH}
+//
+// Where {PATH} is the path to a JSON schema document on the local filesystem.
+func NewJSONSchemaTransformation(ctx context.Context, uri string) (webhookd.WebhookTransformation, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	path := u.Query().Get("schema")
+
+	if path == "" {
+		return nil, fmt.Errorf("Missing schema parameter")
+	}
+
+	compiler := jsonschema.NewCompiler()
+
+	// Only allow schemas (and any schemas they reference) from the local filesystem.
+
+	compiler.LoadURL = func(s string) (io.ReadCloser, error) {
+
+		if !strings.HasPrefix(s, "file://") {
+			return nil, fmt.Errorf("Loading schema '%s' is not supported", s)
+		}
+
+		return jsonschema.LoadURL(s)
+	}
+
+	schema, err := compiler.Compile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile schema '%s', %w", path, err)
+	}
+
+	t := JSONSchemaTransformation{
+		schema: schema,
+	}
+
+	return &t, nil
+}
+
+// Transform returns 'body' unaltered if it is valid according to the transformation's schema. Otherwise it returns
+// a 400 error listing each violation.
+func (t *JSONSchemaTransformation) Transform(ctx context.Context, body []byte) ([]byte, *webhookd.WebhookError) {
+
+	var doc interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	err := dec.Decode(&doc)
+
+	if err != nil {
+
+		code := http.StatusBadRequest
+		message := fmt.Sprintf("Failed to parse body as JSON, %v", err)
+
+		err := &webhookd.WebhookError{Code: code, Message: message}
+		return nil, err
+	}
+
+	err = t.schema.Validate(doc)
+
+	if err == nil {
+		return body, nil
+	}
+
+	var validation_err *jsonschema.ValidationError
+
+	if !errors.As(err, &validation_err) {
+
+		code := http.StatusInternalServerError
+		message := err.Error()
+
+		err := &webhookd.WebhookError{Code: code, Message: message}
+		return nil, err
+	}
+
+	violations := schemaViolations(validation_err)
+
+	code := http.StatusBadRequest
+	message := fmt.Sprintf("Body failed schema validation: %s", strings.Join(violations, "; "))
+
+	return nil, &webhookd.WebhookError{Code: code, Message: message}
+}
+
+// schemaViolations returns the list of leaf violations in 'err' in the form "{INSTANCE_LOCATION}: {MESSAGE}".
+func schemaViolations(err *jsonschema.ValidationError) []string {
+
+	if len(err.Causes) == 0 {
+
+		location := err.InstanceLocation
+
+		if location == "" {
+			location = "/"
+		}
+
+		return []string{fmt.Sprintf("%s: %s", location, err.Message)}
+	}
+
+	violations := make([]string, 0)
+
+	for _, cause := range err.Causes {
+		violations = append(violations, schemaViolations(cause)...)
+	}
+
+	return violations
+}
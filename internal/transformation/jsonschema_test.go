@@ -0,0 +1,75 @@
+package transformation
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaTransformation(t *testing.T) {
+
+	ctx := context.Background()
+
+	schema, err := filepath.Abs("../../schemas/slack-maintenance-alert.json")
+
+	if err != nil {
+		t.Fatalf("Failed to derive schema path, %v", err)
+	}
+
+	tr, err := NewTransformation(ctx, "jsonschema://?schema="+schema)
+
+	if err != nil {
+		t.Fatalf("Failed to create new transformation, %v", err)
+	}
+
+	valid := []byte(`{"blocks":[{"type":"header","text":{"type":"plain_text","text":"Maintenance"}}]}`)
+
+	output, err2 := tr.Transform(ctx, valid)
+
+	if err2 != nil {
+		t.Fatalf("Failed to validate body, %v", err2)
+	}
+
+	if string(output) != string(valid) {
+		t.Fatalf("Unexpected output '%s'", string(output))
+	}
+
+	invalid := []byte(`{"blocks":[{"type":"header","text":{"type":"plain_text"}}]}`)
+
+	_, err2 = tr.Transform(ctx, invalid)
+
+	if err2 == nil || err2.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 error, got %v", err2)
+	}
+
+	if !strings.Contains(err2.Message, "/blocks/0/text") {
+		t.Fatalf("Expected violation to include field location, got '%s'", err2.Message)
+	}
+
+	_, err2 = tr.Transform(ctx, []byte("not json"))
+
+	if err2 == nil || err2.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 error for invalid JSON, got %v", err2)
+	}
+}
+
+func TestNewJSONSchemaTransformationInvalid(t *testing.T) {
+
+	ctx := context.Background()
+
+	uris := []string{
+		"jsonschema://",
+		"jsonschema://?schema=/does/not/exist.json",
+	}
+
+	for _, uri := range uris {
+
+		_, err := NewTransformation(ctx, uri)
+
+		if err == nil {
+			t.Fatalf("Expected %s to fail", uri)
+		}
+	}
+}
@@ -13,7 +13,7 @@ func TestNullTransformation(t *testing.T) {
 	input := []byte("hello world")
 	expected := input
 
-	tr, err := NewTransformation(ctx, "pass://")
+	tr, err := NewTransformation(ctx, "passthrough://")
 
 	if err != nil {
 		t.Fatalf("Failed to create new null transformation, %v", err)
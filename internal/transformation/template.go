@@ -0,0 +1,334 @@
+package transformation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/tidwall/gjson"
+)
+
+func init() {
+
+	ctx := context.Background()
+	err := RegisterTransformation(ctx, "template", NewTemplateTransformation)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// TemplateTransformation implements the `webhookd.WebhookTransformation` interface for reshaping messages using a
+// Go `text/template` document.
+type TemplateTransformation struct {
+	webhookd.WebhookTransformation
+	// template is the parsed template used to render messages.
+	template *template.Template
+}
+
+// NewTemplateTransformation returns a new `TemplateTransformation` instance configured by 'uri' in the form of:
+//
+//	template://?file={PATH}
+//
+// Where {PATH} is the path to a Go `text/template` document on the local filesystem. The template is rendered against
+// the parsed JSON body of each message and may use the functions returned by `TemplateFuncs` and `MessageFuncs`.
+func NewTemplateTransformation(ctx context.Context, uri string) (webhookd.WebhookTransformation, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	path := u.Query().Get("file")
+
+	if path == "" {
+		return nil, fmt.Errorf("Missing file parameter")
+	}
+
+	t, err := template.New(filepath.Base(path)).Funcs(TemplateFuncs(nil)).Funcs(MessageFuncs(nil)).ParseFiles(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse template '%s', %w", path, err)
+	}
+
+	tr := TemplateTransformation{
+		template: t,
+	}
+
+	return &tr, nil
+}
+
+// Transform returns the output of the transformation's template rendered against 'body'.
+func (tr *TemplateTransformation) Transform(ctx context.Context, body []byte) ([]byte, *webhookd.WebhookError) {
+
+	msg, err := tr.TransformMessage(ctx, webhookd.NewMessage(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return msg.Body, nil
+}
+
+// TransformMessage returns a copy of 'msg' whose body is the output of the transformation's template rendered against
+// the body of 'msg'. The message's headers and metadata are available to the template using the `MessageFuncs` functions.
+func (tr *TemplateTransformation) TransformMessage(ctx context.Context, msg *webhookd.Message) (*webhookd.Message, *webhookd.WebhookError) {
+
+	body := msg.Body
+
+	// Numbers are decoded as float64 so that they can be compared using the built-in
+	// template functions. Use the gjson helpers when the exact value matters.
+
+	var data interface{}
+
+	err := json.Unmarshal(body, &data)
+
+	if err != nil {
+
+		code := http.StatusBadRequest
+		message := fmt.Sprintf("Failed to parse body as JSON, %v", err)
+
+		err := &webhookd.WebhookError{Code: code, Message: message}
+		return nil, err
+	}
+
+	// The template is cloned so that the gjson helpers can be bound to this message's body
+	// without affecting concurrent calls to Transform.
+
+	t, err := tr.template.Clone()
+
+	if err != nil {
+
+		code := http.StatusInternalServerError
+		message := err.Error()
+
+		err := &webhookd.WebhookError{Code: code, Message: message}
+		return nil, err
+	}
+
+	t = t.Funcs(TemplateFuncs(body)).Funcs(MessageFuncs(msg))
+
+	var buf bytes.Buffer
+
+	err = t.Execute(&buf, data)
+
+	if err != nil {
+
+		code := http.StatusInternalServerError
+		message := fmt.Sprintf("Failed to render template, %v", err)
+
+		err := &webhookd.WebhookError{Code: code, Message: message}
+		return nil, err
+	}
+
+	return msg.WithBody(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+// MessageFuncs returns the functions available to templates used by `TemplateTransformation` for querying the headers
+// and metadata of 'msg':
+//
+//   - header NAME: The value of the request header NAME.
+//   - meta KEY: The value of the metadata KEY, for example "event_type" or "remote_addr".
+func MessageFuncs(msg *webhookd.Message) template.FuncMap {
+
+	return template.FuncMap{
+		"header": func(name string) string {
+
+			if msg == nil {
+				return ""
+			}
+
+			return msg.Header.Get(name)
+		},
+		"meta": func(key string) string {
+
+			if msg == nil {
+				return ""
+			}
+
+			return msg.Get(key)
+		},
+	}
+}
+
+// TemplateFuncs returns the functions available to templates used by `TemplateTransformation`. The gjson helpers
+// query 'body':
+//
+//   - get PATH: The string value of the gjson PATH.
+//   - raw PATH: The raw JSON value of the gjson PATH, or "null" if it does not exist.
+//   - exists PATH: Whether the gjson PATH exists.
+//   - json VALUE: VALUE encoded as JSON, including the quotes around strings.
+//   - jsonEscape STRING: STRING escaped for use inside a JSON string, without the surrounding quotes.
+//   - now: The current time.
+//   - formatTime LAYOUT VALUE: VALUE, a `time.Time`, RFC 3339 string or Unix timestamp, formatted using the Go time LAYOUT.
+//   - default FALLBACK VALUE: VALUE, or FALLBACK if VALUE is empty.
+//   - empty VALUE: Whether VALUE is nil, false, zero or has a length of zero.
+//   - ternary A B CONDITION: A if CONDITION is true, otherwise B.
+//   - coalesce VALUES...: The first non-empty value.
+//   - upper, lower, trim, replace OLD NEW STRING, contains SUBSTRING STRING: The equivalent `strings` functions.
+func TemplateFuncs(body []byte) template.FuncMap {
+
+	return template.FuncMap{
+		"get": func(path string) string {
+			return gjson.GetBytes(body, path).String()
+		},
+		"raw": func(path string) string {
+
+			r := gjson.GetBytes(body, path)
+
+			if !r.Exists() {
+				return "null"
+			}
+
+			return r.Raw
+		},
+		"exists": func(path string) bool {
+			return gjson.GetBytes(body, path).Exists()
+		},
+		"json":       templateJSON,
+		"jsonEscape": templateJSONEscape,
+		"now":        time.Now,
+		"formatTime": templateFormatTime,
+		"default": func(fallback interface{}, value interface{}) interface{} {
+
+			if templateEmpty(value) {
+				return fallback
+			}
+
+			return value
+		},
+		"empty": templateEmpty,
+		"ternary": func(a interface{}, b interface{}, condition bool) interface{} {
+
+			if condition {
+				return a
+			}
+
+			return b
+		},
+		"coalesce": func(values ...interface{}) interface{} {
+
+			for _, v := range values {
+
+				if !templateEmpty(v) {
+					return v
+				}
+			}
+
+			return nil
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"trim":  strings.TrimSpace,
+		"replace": func(old string, new string, s string) string {
+			return strings.ReplaceAll(s, old, new)
+		},
+		"contains": func(substr string, s string) bool {
+			return strings.Contains(s, substr)
+		},
+	}
+}
+
+// templateJSON returns 'v' encoded as JSON.
+func templateJSON(v interface{}) (string, error) {
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	err := enc.Encode(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// templateJSONEscape returns 's' escaped for use inside a JSON string.
+func templateJSONEscape(s interface{}) (string, error) {
+
+	enc, err := templateJSON(fmt.Sprint(s))
+
+	if err != nil {
+		return "", err
+	}
+
+	return enc[1 : len(enc)-1], nil
+}
+
+// templateFormatTime returns 'v' formatted using 'layout'. 'v' may be a `time.Time` instance, an RFC 3339 string or
+// a Unix timestamp in seconds.
+func templateFormatTime(layout string, v interface{}) (string, error) {
+
+	var t time.Time
+
+	switch value := v.(type) {
+	case time.Time:
+		t = value
+	case float64:
+		t = time.Unix(int64(value), 0).UTC()
+	case int:
+		t = time.Unix(int64(value), 0).UTC()
+	case int64:
+		t = time.Unix(value, 0).UTC()
+	case string:
+
+		if value == "" {
+			return "", nil
+		}
+
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+
+		if err != nil {
+
+			i, err2 := strconv.ParseInt(value, 10, 64)
+
+			if err2 != nil {
+				return "", fmt.Errorf("Invalid time '%s', %w", value, err)
+			}
+
+			parsed = time.Unix(i, 0).UTC()
+		}
+
+		t = parsed
+
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("Unsupported time value of type %T", v)
+	}
+
+	return t.Format(layout), nil
+}
+
+// templateEmpty reports whether 'v' is nil, false, zero or has a length of zero.
+func templateEmpty(v interface{}) bool {
+
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return rv.IsZero()
+	}
+}
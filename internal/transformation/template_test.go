@@ -0,0 +1,175 @@
+package transformation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bobertrublik/webhook-router/internal/webhookd"
+	"github.com/tidwall/gjson"
+)
+
+func TestTemplateTransformation(t *testing.T) {
+
+	ctx := context.Background()
+
+	path, err := filepath.Abs("../../templates/azure-maintenance-slack.json.tmpl")
+
+	if err != nil {
+		t.Fatalf("Failed to derive template path, %v", err)
+	}
+
+	tr, err := NewTransformation(ctx, "template://?file="+path)
+
+	if err != nil {
+		t.Fatalf("Failed to create new transformation, %v", err)
+	}
+
+	input := []byte(`{
+  "data": {
+    "essentials": {"alertRule": "Planned \"maintenance\"", "description": ""},
+    "alertContext": {
+      "status": "Active",
+      "properties": {"impactStartTime": "2024-01-02T03:04:05Z", "stage": "Planned", "communication": "<p>Details</p>"}
+    }
+  }
+}`)
+
+	output, err2 := tr.Transform(ctx, input)
+
+	if err2 != nil {
+		t.Fatalf("Failed to transform body, %v", err2)
+	}
+
+	if !json.Valid(output) {
+		t.Fatalf("Invalid JSON output '%s'", string(output))
+	}
+
+	expected := map[string]string{
+		"blocks.1.elements.0.text": `Planned "maintenance"`,
+		"blocks.2.fields.0.text":   "*Start:* 2024-01-02 03:04 UTC",
+		"blocks.2.fields.2.text":   "*End:* n/a",
+		"blocks.3.text.text":       "No description",
+		"blocks.4.text.text":       "<p>Details</p>",
+	}
+
+	for path, v := range expected {
+
+		if gjson.GetBytes(output, path).String() != v {
+			t.Fatalf("Unexpected value for %s: '%s'", path, gjson.GetBytes(output, path).String())
+		}
+	}
+
+	_, err2 = tr.Transform(ctx, []byte("not json"))
+
+	if err2 == nil || err2.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 error for invalid JSON, got %v", err2)
+	}
+}
+
+func TestTemplateTransformationFuncs(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "test.tmpl")
+
+	tmpl := `{{ .name }}|{{ jsonEscape .quote }}|{{ ternary "yes" "no" (eq .count 3.0) }}|{{ coalesce .missing "" .name }}|{{ if exists "tags.1" }}{{ raw "tags" }}{{ end }}|{{ formatTime "2006" .created }}|{{ upper (default "none" .missing) }}`
+
+	err := os.WriteFile(path, []byte(tmpl), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write template, %v", err)
+	}
+
+	tr, err := NewTransformation(ctx, "template://?file="+path)
+
+	if err != nil {
+		t.Fatalf("Failed to create new transformation, %v", err)
+	}
+
+	output, err2 := tr.Transform(ctx, []byte(`{"name":"alice","quote":"a \"b\"","count":3,"tags":["x","y"],"created":1700000000}`))
+
+	if err2 != nil {
+		t.Fatalf("Failed to transform body, %v", err2)
+	}
+
+	expected := `alice|a \"b\"|yes|alice|["x","y"]|` + time.Unix(1700000000, 0).UTC().Format("2006") + `|NONE`
+
+	if string(output) != expected {
+		t.Fatalf("Unexpected output '%s'", string(output))
+	}
+}
+
+func TestNewTemplateTransformationInvalid(t *testing.T) {
+
+	ctx := context.Background()
+
+	uris := []string{
+		"template://",
+		"template://?file=/does/not/exist.tmpl",
+	}
+
+	for _, uri := range uris {
+
+		_, err := NewTransformation(ctx, uri)
+
+		if err == nil {
+			t.Fatalf("Expected %s to fail", uri)
+		}
+	}
+}
+
+func TestTemplateTransformationMessage(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "message.tmpl")
+
+	tmpl := `{"event": {{ json (meta "event_type") }}, "delivery": {{ json (header "X-GitHub-Delivery") }}, "ref": {{ json .ref }}}`
+
+	err := os.WriteFile(path, []byte(tmpl), 0600)
+
+	if err != nil {
+		t.Fatalf("Failed to write template, %v", err)
+	}
+
+	tr, err := NewTransformation(ctx, "template://?file="+path)
+
+	if err != nil {
+		t.Fatalf("Failed to create new transformation, %v", err)
+	}
+
+	msg := webhookd.NewMessage([]byte(`{"ref": "main"}`))
+	msg.Header.Set("X-GitHub-Delivery", "abc")
+	msg.Metadata[webhookd.MetadataEventType] = "push"
+
+	out, err2 := webhookd.TransformMessage(ctx, tr, msg)
+
+	if err2 != nil {
+		t.Fatalf("Failed to transform message, %v", err2)
+	}
+
+	if string(out.Body) != `{"event": "push", "delivery": "abc", "ref": "main"}` {
+		t.Fatalf("Unexpected output '%s'", string(out.Body))
+	}
+
+	if out.Get(webhookd.MetadataEventType) != "push" {
+		t.Fatalf("Transformation did not preserve metadata")
+	}
+
+	// Byte-only callers see empty headers and metadata.
+
+	body, err2 := tr.Transform(ctx, msg.Body)
+
+	if err2 != nil {
+		t.Fatalf("Failed to transform body, %v", err2)
+	}
+
+	if string(body) != `{"event": "", "delivery": "", "ref": "main"}` {
+		t.Fatalf("Unexpected output '%s'", string(body))
+	}
+}
@@ -9,7 +9,7 @@ func TestRegisterTransformation(t *testing.T) {
 
 	ctx := context.Background()
 
-	err := RegisterTransformation(ctx, "chicken", NewChickenTransformation)
+	err := RegisterTransformation(ctx, "passthrough", NewPassThroughTransformation)
 
 	if err == nil {
 		t.Fatalf("Expected NewPassThroughTransformation to be registered already")
@@ -20,7 +20,7 @@ func TestNewTransformation(t *testing.T) {
 
 	ctx := context.Background()
 
-	uri := "chicken://zxx?clucking=false"
+	uri := "passthrough://"
 
 	_, err := NewTransformation(ctx, uri)
 
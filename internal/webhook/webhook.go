@@ -3,6 +3,7 @@ package webhook
 
 import (
 	"context"
+	"fmt"
 	"github.com/bobertrublik/webhook-router/internal/webhookd"
 )
 
@@ -17,16 +18,98 @@ type Webhook struct {
 	transformations []webhookd.WebhookTransformation
 	// dispatchers is a list of zero or more `webhookd.WebhookDispatcher` instances which will be to relay the body of a webhook message after it's been transformed.
 	dispatchers []webhookd.WebhookDispatcher
+	// dispatcherNames is the list of labels identifying each element in `dispatchers`.
+	dispatcherNames []string
+	// dispatchPolicy is the policy used to decide whether a webhook message was dispatched successfully.
+	dispatchPolicy string
+	// delivery is the mode used to relay messages to `dispatchers`.
+	delivery string
+	// router is the optional `webhookd.WebhookRouter` instance used to choose which of `dispatchers` a message is relayed to.
+	router webhookd.WebhookRouter
+}
+
+// type WebhookOptions is a struct containing configuration details for a new `Webhook` instance.
+type WebhookOptions struct {
+	// Endpoint is the relative URI of the webhook.
+	Endpoint string
+	// Receiver is the `webhookd.WebhookReceiver` instance used to process a webhook message on arrival.
+	Receiver webhookd.WebhookReceiver
+	// Transformations is a list of zero or more `webhookd.WebhookTransformation` instances that will be applied to a message after receipt.
+	Transformations []webhookd.WebhookTransformation
+	// Dispatchers is a list of zero or more `webhookd.WebhookDispatcher` instances used to relay the body of a webhook message.
+	Dispatchers []webhookd.WebhookDispatcher
+	// DispatcherNames is an optional list of labels identifying each element in `Dispatchers`. If empty, labels are derived from each dispatcher's offset.
+	DispatcherNames []string
+	// DispatchPolicy is the policy used to decide whether a webhook message was dispatched successfully. Defaults to `webhookd.DispatchPolicyAll`.
+	DispatchPolicy string
+	// Delivery is the mode used to relay messages to `Dispatchers`. Defaults to `webhookd.DeliverySync`.
+	Delivery string
+	// Router is an optional `webhookd.WebhookRouter` instance used to choose which of `Dispatchers` a message is relayed to.
+	// Every label it returns must be in `DispatcherNames`.
+	Router webhookd.WebhookRouter
 }
 
 // NewWebhook return a new `Wehook` instance.
 func NewWebhook(ctx context.Context, endpoint string, rc webhookd.WebhookReceiver, tr []webhookd.WebhookTransformation, ds []webhookd.WebhookDispatcher) (Webhook, error) {
 
+	opts := &WebhookOptions{
+		Endpoint:        endpoint,
+		Receiver:        rc,
+		Transformations: tr,
+		Dispatchers:     ds,
+	}
+
+	return NewWebhookFromOptions(ctx, opts)
+}
+
+// NewWebhookFromOptions returns a new `Webhook` instance derived from 'opts'.
+func NewWebhookFromOptions(ctx context.Context, opts *WebhookOptions) (Webhook, error) {
+
+	names := opts.DispatcherNames
+
+	if len(names) == 0 {
+
+		names = make([]string, len(opts.Dispatchers))
+
+		for idx := range opts.Dispatchers {
+			names[idx] = fmt.Sprintf("dispatcher-%d", idx)
+		}
+	}
+
+	if len(names) != len(opts.Dispatchers) {
+		return Webhook{}, fmt.Errorf("Dispatcher names do not match dispatchers")
+	}
+
+	policy := opts.DispatchPolicy
+
+	if policy == "" {
+		policy = webhookd.DispatchPolicyAll
+	}
+
+	if !webhookd.IsValidDispatchPolicy(policy) {
+		return Webhook{}, fmt.Errorf("Invalid dispatch policy '%s'", policy)
+	}
+
+	delivery := opts.Delivery
+
+	switch delivery {
+	case "":
+		delivery = webhookd.DeliverySync
+	case webhookd.DeliverySync, webhookd.DeliveryAsync:
+		// pass
+	default:
+		return Webhook{}, fmt.Errorf("Invalid delivery mode '%s'", delivery)
+	}
+
 	wh := Webhook{
-		endpoint:        endpoint,
-		receiver:        rc,
-		transformations: tr,
-		dispatchers:     ds,
+		endpoint:        opts.Endpoint,
+		receiver:        opts.Receiver,
+		transformations: opts.Transformations,
+		dispatchers:     opts.Dispatchers,
+		dispatcherNames: names,
+		dispatchPolicy:  policy,
+		delivery:        delivery,
+		router:          opts.Router,
 	}
 
 	return wh, nil
@@ -51,3 +134,24 @@ func (wh Webhook) Transformations() []webhookd.WebhookTransformation {
 func (wh Webhook) Dispatchers() []webhookd.WebhookDispatcher {
 	return wh.dispatchers
 }
+
+// DispatcherNames() returns the list of labels identifying each of the instances returned by `Dispatchers()`.
+func (wh Webhook) DispatcherNames() []string {
+	return wh.dispatcherNames
+}
+
+// DispatchPolicy() returns the policy used to decide whether a webhook message was dispatched successfully.
+func (wh Webhook) DispatchPolicy() string {
+	return wh.dispatchPolicy
+}
+
+// Delivery() returns the mode used to relay messages to the webhook's dispatchers.
+func (wh Webhook) Delivery() string {
+	return wh.delivery
+}
+
+// Router() returns the `webhookd.WebhookRouter` instance used to choose which of the webhook's dispatchers a message is
+// relayed to, or nil if messages are relayed to every dispatcher.
+func (wh Webhook) Router() webhookd.WebhookRouter {
+	return wh.router
+}
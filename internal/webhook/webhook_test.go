@@ -14,13 +14,13 @@ func TestWebhook(t *testing.T) {
 
 	ctx := context.Background()
 
-	r, err := receiver.NewReceiver(ctx, "insecure://")
+	r, err := receiver.NewReceiver(ctx, "passthrough://")
 
 	if err != nil {
 		t.Fatalf("Failed to create new receiver, %v", err)
 	}
 
-	tr, err := transformation.NewTransformation(ctx, "null://")
+	tr, err := transformation.NewTransformation(ctx, "passthrough://")
 
 	if err != nil {
 		t.Fatalf("Failed to create new transformation, %v", err)
@@ -49,3 +49,41 @@ func TestWebhook(t *testing.T) {
 	}
 
 }
+
+func TestNewWebhookFromOptions(t *testing.T) {
+
+	ctx := context.Background()
+
+	d, err := dispatcher.NewDispatcher(ctx, "log://")
+
+	if err != nil {
+		t.Fatalf("Failed to create new dispatcher, %v", err)
+	}
+
+	opts := &WebhookOptions{
+		Endpoint:    "/test",
+		Dispatchers: []webhookd.WebhookDispatcher{d},
+	}
+
+	wh, err := NewWebhookFromOptions(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create new webhook, %v", err)
+	}
+
+	if wh.DispatchPolicy() != webhookd.DispatchPolicyAll {
+		t.Fatalf("Unexpected default dispatch policy: %s", wh.DispatchPolicy())
+	}
+
+	if len(wh.DispatcherNames()) != 1 {
+		t.Fatalf("Expected default dispatcher names")
+	}
+
+	opts.DispatchPolicy = "chicken"
+
+	_, err = NewWebhookFromOptions(ctx, opts)
+
+	if err == nil {
+		t.Fatalf("Expected invalid dispatch policy to fail")
+	}
+}
@@ -0,0 +1,246 @@
+package webhookd
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+)
+
+const (
+	// MetadataEndpoint is the metadata key for the relative URI of the webhook a message was received by.
+	MetadataEndpoint string = "endpoint"
+	// MetadataMethod is the metadata key for the HTTP method of the request a message was received in.
+	MetadataMethod string = "method"
+	// MetadataRemoteAddr is the metadata key for the IP address of the client that sent a message.
+	MetadataRemoteAddr string = "remote_addr"
+	// MetadataContentType is the metadata key for the content type of the request a message was received in.
+	MetadataContentType string = "content_type"
+	// MetadataEventType is the metadata key for the type of event a message describes, for example "push".
+	MetadataEventType string = "event_type"
+	// MetadataRequestID is the metadata key for the ID of the request a message was received in.
+	MetadataRequestID string = "request_id"
+)
+
+// EventTypeHeaders is the list of request headers, in order of precedence, used to derive the `MetadataEventType`
+// of a message.
+var EventTypeHeaders = []string{
+	"X-GitHub-Event",
+	"X-Gitlab-Event",
+	"X-Gitea-Event",
+	"X-Event-Key",
+	"X-Event-Type",
+	"aeg-event-type",
+}
+
+// CredentialHeaders is the list of request headers which carry credentials, such as passwords, tokens and signatures.
+// They are removed from the headers of messages so that they are never queued, stored as dead letters or shown by
+// the admin API.
+var CredentialHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-API-Key",
+	"X-Gitlab-Token",
+	"X-Hub-Signature",
+	"X-Hub-Signature-256",
+	"X-Gitea-Signature",
+	"X-Gogs-Signature",
+	"X-Signature",
+	"aeg-sas-key",
+	"aeg-sas-token",
+}
+
+// type Message is a struct containing the body of a webhook message and information about the request it was received in.
+// Receivers, transformations and dispatchers that need more than the body of a message can implement the
+// `MessageReceiver`, `MessageTransformation` and `MessageDispatcher` interfaces.
+type Message struct {
+	// Body is the (transformed) body of the message.
+	Body []byte
+	// Header contains the headers of the request the message was received in.
+	Header http.Header
+	// Metadata is a dictionary of information about the message, keyed by the `Metadata` constants or any
+	// other value a receiver or transformation chooses to set.
+	Metadata map[string]string
+}
+
+// NewMessage() returns a new `Message` instance for 'body' with no headers or metadata.
+func NewMessage(body []byte) *Message {
+
+	m := Message{
+		Body:     body,
+		Header:   make(http.Header),
+		Metadata: make(map[string]string),
+	}
+
+	return &m
+}
+
+// NewMessageFromRequest() returns a new `Message` instance for 'body' with the headers and metadata of 'req'. The
+// headers listed in `CredentialHeaders` are not copied.
+func NewMessageFromRequest(req *http.Request, body []byte) *Message {
+
+	m := NewMessage(body)
+	m.Header = req.Header.Clone()
+
+	for _, h := range CredentialHeaders {
+		m.Header.Del(h)
+	}
+
+	m.Metadata[MetadataEndpoint] = req.URL.Path
+	m.Metadata[MetadataMethod] = req.Method
+	m.Metadata[MetadataContentType] = req.Header.Get("Content-Type")
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	m.Metadata[MetadataRemoteAddr] = host
+
+	for _, h := range EventTypeHeaders {
+
+		v := req.Header.Get(h)
+
+		if v != "" {
+			m.Metadata[MetadataEventType] = v
+			break
+		}
+	}
+
+	return m
+}
+
+// Get() returns the value of the metadata key 'key' or an empty string if it is not set.
+func (m *Message) Get(key string) string {
+	return m.Metadata[key]
+}
+
+// WithBody() returns a copy of 'm' with the body 'body'. Headers and metadata are shared with 'm'.
+func (m *Message) WithBody(body []byte) *Message {
+
+	c := *m
+	c.Body = body
+
+	return &c
+}
+
+// Clone() returns a deep copy of 'm'.
+func (m *Message) Clone() *Message {
+
+	c := NewMessage(m.Body)
+	c.Header = m.Header.Clone()
+
+	for k, v := range m.Metadata {
+		c.Metadata[k] = v
+	}
+
+	return c
+}
+
+// MessageReceiver is an interface that defines methods for processing a webhook message, including its headers
+// and metadata, on arrival.
+type MessageReceiver interface {
+	// ReceiveMessage() processes an `http.Request` instance and returns the message it contains.
+	ReceiveMessage(context.Context, *http.Request) (*Message, *WebhookError)
+}
+
+// MessageTransformation is an interface that defines methods for altering (transforming) a webhook message, including
+// its headers and metadata, after receipt.
+type MessageTransformation interface {
+	// TransformMessage() returns a new, altered, copy of a message.
+	TransformMessage(context.Context, *Message) (*Message, *WebhookError)
+}
+
+// MessageDispatcher is an interface that defines methods for relaying a webhook message, including its headers and
+// metadata, after it has been transformed.
+type MessageDispatcher interface {
+	// DispatchMessage() relays a message.
+	DispatchMessage(context.Context, *Message) *WebhookError
+}
+
+// PreviewDispatcher is an interface that defines methods for dispatchers which send something other than the body of the
+// message they relay, for example an event or API call derived from it.
+type PreviewDispatcher interface {
+	// Preview() returns the payload that would be sent to relay a message, without sending it.
+	Preview(context.Context, *Message) ([]byte, *WebhookError)
+}
+
+// ReceiveMessage() processes 'req' with 'r' and returns the message it contains. If 'r' implements the `MessageReceiver`
+// interface its `ReceiveMessage` method is used, otherwise the body returned by `Receive` is combined with the headers
+// and metadata of 'req'.
+func ReceiveMessage(ctx context.Context, r WebhookReceiver, req *http.Request) (*Message, *WebhookError) {
+
+	mr, ok := r.(MessageReceiver)
+
+	if ok {
+		return mr.ReceiveMessage(ctx, req)
+	}
+
+	body, err := r.Receive(ctx, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMessageFromRequest(req, body), nil
+}
+
+// TransformMessage() transforms 'm' with 't'. If 't' implements the `MessageTransformation` interface its `TransformMessage`
+// method is used, otherwise the body returned by `Transform` replaces the body of 'm'.
+func TransformMessage(ctx context.Context, t WebhookTransformation, m *Message) (*Message, *WebhookError) {
+
+	mt, ok := t.(MessageTransformation)
+
+	if ok {
+		return mt.TransformMessage(ctx, m)
+	}
+
+	body, err := t.Transform(ctx, m.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m.WithBody(body), nil
+}
+
+// DispatchMessage() relays 'm' with 'd'. If 'd' implements the `MessageDispatcher` interface its `DispatchMessage`
+// method is used, otherwise the body of 'm' is passed to `Dispatch`.
+func DispatchMessage(ctx context.Context, d WebhookDispatcher, m *Message) *WebhookError {
+
+	md, ok := d.(MessageDispatcher)
+
+	if ok {
+		return md.DispatchMessage(ctx, m)
+	}
+
+	return d.Dispatch(ctx, m.Body)
+}
+
+// PreviewMessage() returns the payload 'd' would send to relay 'm'. If 'd' implements the `PreviewDispatcher` interface
+// its `Preview` method is used, otherwise the body of 'm' is returned.
+func PreviewMessage(ctx context.Context, d WebhookDispatcher, m *Message) ([]byte, *WebhookError) {
+
+	pd, ok := d.(PreviewDispatcher)
+
+	if ok {
+		return pd.Preview(ctx, m)
+	}
+
+	return m.Body, nil
+}
+
+// CloseDispatcher() releases any resources held by 'd', if it implements the `io.Closer` interface. Dispatchers which
+// wrap other dispatchers implement `io.Closer` by closing the dispatcher they wrap.
+func CloseDispatcher(d WebhookDispatcher) error {
+
+	c, ok := d.(io.Closer)
+
+	if !ok {
+		return nil
+	}
+
+	return c.Close()
+}
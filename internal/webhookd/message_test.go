@@ -0,0 +1,133 @@
+package webhookd
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// BytesTransformation implements the `WebhookTransformation` interface and upper-cases message bodies.
+type BytesTransformation struct {
+	WebhookTransformation
+}
+
+func (t *BytesTransformation) Transform(ctx context.Context, body []byte) ([]byte, *WebhookError) {
+	return []byte(strings.ToUpper(string(body))), nil
+}
+
+// MessageTransformationTest implements the `MessageTransformation` interface and records the message's event type.
+type MessageTransformationTest struct {
+	WebhookTransformation
+}
+
+func (t *MessageTransformationTest) TransformMessage(ctx context.Context, msg *Message) (*Message, *WebhookError) {
+
+	c := msg.Clone()
+	c.Metadata["seen"] = msg.Get(MetadataEventType)
+
+	return c, nil
+}
+
+// BytesDispatcher implements the `WebhookDispatcher` interface and records the last body it was sent.
+type BytesDispatcher struct {
+	WebhookDispatcher
+	body []byte
+}
+
+func (d *BytesDispatcher) Dispatch(ctx context.Context, body []byte) *WebhookError {
+	d.body = body
+	return nil
+}
+
+func TestNewMessageFromRequest(t *testing.T) {
+
+	req := httptest.NewRequest("POST", "/github?x=y", strings.NewReader("{}"))
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-Gitlab-Token", "s33kret")
+	req.Header.Set("Authorization", "Bearer s33kret")
+
+	msg := NewMessageFromRequest(req, []byte("{}"))
+
+	expected := map[string]string{
+		MetadataEndpoint:    "/github",
+		MetadataMethod:      "POST",
+		MetadataRemoteAddr:  "192.0.2.1",
+		MetadataContentType: "application/json",
+		MetadataEventType:   "push",
+	}
+
+	for k, v := range expected {
+
+		if msg.Get(k) != v {
+			t.Fatalf("Unexpected value for %s: '%s'", k, msg.Get(k))
+		}
+	}
+
+	if msg.Header.Get("X-GitHub-Event") != "push" {
+		t.Fatalf("Missing request headers")
+	}
+
+	for _, h := range []string{"X-Gitlab-Token", "Authorization"} {
+
+		if msg.Header.Get(h) != "" {
+			t.Fatalf("Expected credential header %s to be removed", h)
+		}
+	}
+
+	req.Header.Set("X-GitHub-Event", "ping")
+
+	if msg.Header.Get("X-GitHub-Event") != "push" {
+		t.Fatalf("Message headers were not copied from request")
+	}
+}
+
+func TestMessageAdapters(t *testing.T) {
+
+	ctx := context.Background()
+
+	req := httptest.NewRequest("POST", "/test", strings.NewReader("hello"))
+	req.Header.Set("X-Event-Type", "greeting")
+
+	msg := NewMessageFromRequest(req, []byte("hello"))
+
+	msg, err := TransformMessage(ctx, &BytesTransformation{}, msg)
+
+	if err != nil {
+		t.Fatalf("Failed to transform message, %v", err)
+	}
+
+	if string(msg.Body) != "HELLO" || msg.Get(MetadataEventType) != "greeting" {
+		t.Fatalf("Byte-only transformation did not preserve metadata, %+v", msg)
+	}
+
+	original := msg
+
+	msg, err = TransformMessage(ctx, &MessageTransformationTest{}, msg)
+
+	if err != nil {
+		t.Fatalf("Failed to transform message, %v", err)
+	}
+
+	if msg.Get("seen") != "greeting" || original.Get("seen") != "" {
+		t.Fatalf("Unexpected metadata, %v", msg.Metadata)
+	}
+
+	d := &BytesDispatcher{}
+
+	err = DispatchMessage(ctx, d, msg)
+
+	if err != nil {
+		t.Fatalf("Failed to dispatch message, %v", err)
+	}
+
+	if string(d.body) != "HELLO" {
+		t.Fatalf("Unexpected dispatched body '%s'", string(d.body))
+	}
+
+	if msg.Header.Get("x-event-type") != "greeting" {
+		t.Fatalf("Missing headers after transformation")
+	}
+}
@@ -0,0 +1,71 @@
+package webhookd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header used to accept, return and forward the ID of a webhook request.
+const RequestIDHeader string = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of a request ID accepted from a client.
+const maxRequestIDLength int = 128
+
+// NewRequestID returns a new random identifier for a webhook request, used to correlate the log lines for a single message.
+func NewRequestID() string {
+
+	b := make([]byte, 8)
+
+	// crypto/rand.Read never returns an error on supported platforms.
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// RequestIDFromRequest returns the value of the `RequestIDHeader` header of 'req' or, if it is missing or not a valid
+// request ID, a new ID.
+func RequestIDFromRequest(req *http.Request) string {
+
+	id := req.Header.Get(RequestIDHeader)
+
+	if !IsValidRequestID(id) {
+		return NewRequestID()
+	}
+
+	return id
+}
+
+// IsValidRequestID reports whether 'id' can be used as a request ID. IDs must be between 1 and 128 printable ASCII
+// characters, excluding spaces, so that they are safe to log and to forward as a header.
+func IsValidRequestID(id string) bool {
+
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestIDKey is the key used to store a request ID in a context.
+type requestIDKey struct{}
+
+// NewRequestIDContext returns a copy of 'ctx' carrying the request ID 'id'.
+func NewRequestIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by 'ctx' or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
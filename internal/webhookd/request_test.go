@@ -0,0 +1,73 @@
+package webhookd
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsValidRequestID(t *testing.T) {
+
+	valid := []string{
+		"abc123",
+		"2f1c-4b7e:trace/1",
+		strings.Repeat("a", 128),
+	}
+
+	for _, id := range valid {
+
+		if !IsValidRequestID(id) {
+			t.Fatalf("Expected '%s' to be valid", id)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"has space",
+		"new\nline",
+		"café",
+		strings.Repeat("a", 129),
+	}
+
+	for _, id := range invalid {
+
+		if IsValidRequestID(id) {
+			t.Fatalf("Expected '%s' to be invalid", id)
+		}
+	}
+
+	if !IsValidRequestID(NewRequestID()) {
+		t.Fatalf("Expected generated request ID to be valid")
+	}
+}
+
+func TestRequestIDFromRequest(t *testing.T) {
+
+	req := httptest.NewRequest("POST", "/github", nil)
+	req.Header.Set(RequestIDHeader, "abc123")
+
+	if RequestIDFromRequest(req) != "abc123" {
+		t.Fatalf("Expected incoming request ID to be used")
+	}
+
+	req.Header.Set(RequestIDHeader, "not valid")
+
+	id := RequestIDFromRequest(req)
+
+	if id == "not valid" || len(id) != 16 {
+		t.Fatalf("Expected invalid request ID to be replaced, got '%s'", id)
+	}
+
+	ctx := context.Background()
+
+	if RequestIDFromContext(ctx) != "" {
+		t.Fatalf("Expected empty request ID for context without one")
+	}
+
+	ctx = NewRequestIDContext(ctx, id)
+
+	if RequestIDFromContext(ctx) != id {
+		t.Fatalf("Expected request ID to be carried by context")
+	}
+}
@@ -0,0 +1,188 @@
+package webhookd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// DispatchPolicyAll considers a webhook request successful only if every dispatcher succeeds.
+	DispatchPolicyAll string = "all"
+	// DispatchPolicyAny considers a webhook request successful if at least one dispatcher succeeds.
+	DispatchPolicyAny string = "any"
+	// DispatchPolicyBestEffort considers a webhook request successful regardless of dispatcher failures.
+	DispatchPolicyBestEffort string = "best-effort"
+)
+
+const (
+	// DispatchOutcomeOK signals that a dispatcher relayed a message successfully.
+	DispatchOutcomeOK string = "ok"
+	// DispatchOutcomeHalted signals that a dispatcher returned a non-fatal `UnhandledEvent` or `HaltEvent` error.
+	DispatchOutcomeHalted string = "halted"
+	// DispatchOutcomeFailed signals that a dispatcher failed to relay a message.
+	DispatchOutcomeFailed string = "failed"
+)
+
+const (
+	// DispatchStatusOK signals that no dispatchers failed.
+	DispatchStatusOK string = "ok"
+	// DispatchStatusPartial signals that some, but not all, dispatchers failed.
+	DispatchStatusPartial string = "partial"
+	// DispatchStatusFailed signals that all dispatchers failed.
+	DispatchStatusFailed string = "failed"
+)
+
+// IsValidDispatchPolicy returns a boolean value indicating whether 'policy' is a known dispatch policy.
+func IsValidDispatchPolicy(policy string) bool {
+
+	switch policy {
+	case DispatchPolicyAll, DispatchPolicyAny, DispatchPolicyBestEffort:
+		return true
+	default:
+		return false
+	}
+}
+
+// DispatchResult records the outcome of relaying a message with a single `WebhookDispatcher`.
+type DispatchResult struct {
+	// Dispatcher is the name of the dispatcher.
+	Dispatcher string
+	// Outcome is one of `DispatchOutcomeOK`, `DispatchOutcomeHalted` or `DispatchOutcomeFailed`.
+	Outcome string
+	// Duration is the time it took for the dispatcher to complete.
+	Duration time.Duration
+	// Error is the error returned by the dispatcher, if any.
+	Error *WebhookError
+}
+
+// NewDispatchResult returns a new `DispatchResult` for the dispatcher 'name' derived from the error (or not) it returned.
+func NewDispatchResult(name string, d time.Duration, err *WebhookError) *DispatchResult {
+
+	r := &DispatchResult{
+		Dispatcher: name,
+		Outcome:    DispatchOutcomeOK,
+		Duration:   d,
+		Error:      err,
+	}
+
+	if err != nil {
+
+		switch err.Code {
+		case UnhandledEvent, HaltEvent:
+			r.Outcome = DispatchOutcomeHalted
+		default:
+			r.Outcome = DispatchOutcomeFailed
+		}
+	}
+
+	return r
+}
+
+// MarshalJSON encodes 'r' with a human-readable duration and error message.
+func (r *DispatchResult) MarshalJSON() ([]byte, error) {
+
+	type result struct {
+		Dispatcher string `json:"dispatcher"`
+		Outcome    string `json:"outcome"`
+		Duration   string `json:"duration"`
+		Error      string `json:"error,omitempty"`
+	}
+
+	enc := result{
+		Dispatcher: r.Dispatcher,
+		Outcome:    r.Outcome,
+		Duration:   r.Duration.String(),
+	}
+
+	if r.Error != nil {
+		enc.Error = r.Error.Error()
+	}
+
+	return json.Marshal(enc)
+}
+
+// DispatchSummary aggregates the `DispatchResult` instances for every dispatcher a message was relayed to.
+type DispatchSummary struct {
+	// Endpoint is the relative URI of the webhook.
+	Endpoint string `json:"endpoint"`
+	// Route is the name of the route used to choose the dispatchers, if the webhook has routes.
+	Route string `json:"route,omitempty"`
+	// Policy is the dispatch policy used to determine `Success`.
+	Policy string `json:"policy"`
+	// Status is one of `DispatchStatusOK`, `DispatchStatusPartial` or `DispatchStatusFailed`.
+	Status string `json:"status"`
+	// Success is true if the results satisfy `Policy`.
+	Success bool `json:"success"`
+	// Results is the list of individual dispatcher results.
+	Results []*DispatchResult `json:"dispatchers"`
+}
+
+// NewDispatchSummary returns a new `DispatchSummary` for 'results' evaluated against 'policy'.
+func NewDispatchSummary(endpoint string, policy string, results []*DispatchResult) *DispatchSummary {
+
+	ok := 0
+	failed := 0
+
+	for _, r := range results {
+
+		switch r.Outcome {
+		case DispatchOutcomeOK:
+			ok += 1
+		case DispatchOutcomeFailed:
+			failed += 1
+		}
+	}
+
+	status := DispatchStatusOK
+
+	if failed > 0 {
+
+		if ok > 0 {
+			status = DispatchStatusPartial
+		} else {
+			status = DispatchStatusFailed
+		}
+	}
+
+	var success bool
+
+	switch policy {
+	case DispatchPolicyBestEffort:
+		success = true
+	case DispatchPolicyAny:
+		success = failed == 0 || ok > 0
+	default:
+		success = failed == 0
+	}
+
+	s := &DispatchSummary{
+		Endpoint: endpoint,
+		Policy:   policy,
+		Status:   status,
+		Success:  success,
+		Results:  results,
+	}
+
+	return s
+}
+
+// Failures returns the list of results whose outcome is `DispatchOutcomeFailed`.
+func (s *DispatchSummary) Failures() []*DispatchResult {
+
+	failures := make([]*DispatchResult, 0)
+
+	for _, r := range s.Results {
+
+		if r.Outcome == DispatchOutcomeFailed {
+			failures = append(failures, r)
+		}
+	}
+
+	return failures
+}
+
+// String returns a short description of 's'.
+func (s *DispatchSummary) String() string {
+	return fmt.Sprintf("%s: %d dispatchers, %d failed (policy %s)", s.Status, len(s.Results), len(s.Failures()), s.Policy)
+}
@@ -0,0 +1,57 @@
+package webhookd
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDispatchSummary(t *testing.T) {
+
+	ok := NewDispatchResult("log", time.Millisecond, nil)
+	halted := NewDispatchResult("noop", time.Millisecond, &WebhookError{Code: HaltEvent, Message: "halt"})
+	failed := NewDispatchResult("slack", time.Millisecond, &WebhookError{Code: 502, Message: "Bad Gateway"})
+
+	tests := []struct {
+		policy  string
+		results []*DispatchResult
+		status  string
+		success bool
+	}{
+		{DispatchPolicyAll, []*DispatchResult{ok, halted}, DispatchStatusOK, true},
+		{DispatchPolicyAll, []*DispatchResult{ok, failed}, DispatchStatusPartial, false},
+		{DispatchPolicyAny, []*DispatchResult{ok, failed}, DispatchStatusPartial, true},
+		{DispatchPolicyAny, []*DispatchResult{failed}, DispatchStatusFailed, false},
+		{DispatchPolicyBestEffort, []*DispatchResult{failed}, DispatchStatusFailed, true},
+	}
+
+	for _, test := range tests {
+
+		s := NewDispatchSummary("/test", test.policy, test.results)
+
+		if s.Status != test.status {
+			t.Fatalf("Unexpected status for policy %s: %s", test.policy, s.Status)
+		}
+
+		if s.Success != test.success {
+			t.Fatalf("Unexpected success for policy %s: %t", test.policy, s.Success)
+		}
+	}
+}
+
+func TestDispatchResultMarshalJSON(t *testing.T) {
+
+	r := NewDispatchResult("slack", 2*time.Second, &WebhookError{Code: 502, Message: "Bad Gateway"})
+
+	enc, err := json.Marshal(r)
+
+	if err != nil {
+		t.Fatalf("Failed to marshal result, %v", err)
+	}
+
+	expected := `{"dispatcher":"slack","outcome":"failed","duration":"2s","error":"502 Bad Gateway"}`
+
+	if string(enc) != expected {
+		t.Fatalf("Unexpected JSON: %s", string(enc))
+	}
+}
@@ -6,6 +6,13 @@ import (
 	"net/http"
 )
 
+const (
+	// DeliverySync signals that messages are dispatched before a response is returned to the sender.
+	DeliverySync string = "sync"
+	// DeliveryAsync signals that messages are durably queued and dispatched after a response is returned to the sender.
+	DeliveryAsync string = "async"
+)
+
 // type WebhookHandler is an interface for definining and configuring an individual webhooks.
 type WebhookHandler interface {
 	// Endpoint is the relative URI of the webhook.
@@ -16,6 +23,22 @@ type WebhookHandler interface {
 	Transformations() []WebhookTransformation
 	// Dispatchers() is a list of zero or more `WebhookDispatcher` instances which will be to relay the body of a webhook message after it's been transformed.
 	Dispatchers() []WebhookDispatcher
+	// DispatcherNames() is the list of labels identifying each of the instances returned by `Dispatchers()`, in the same order.
+	DispatcherNames() []string
+	// DispatchPolicy() is the policy (one of the `DispatchPolicy` constants) used to decide whether a webhook message was dispatched successfully.
+	DispatchPolicy() string
+	// Delivery() is the delivery mode (one of the `Delivery` constants) used to relay messages to `Dispatchers()`.
+	Delivery() string
+	// Router() is the optional `WebhookRouter` instance used to choose which of `Dispatchers()` a message is relayed to. If nil
+	// messages are relayed to every dispatcher.
+	Router() WebhookRouter
+}
+
+// WebhookRouter is an interface that defines methods for choosing the dispatchers a (webhook) message is relayed to.
+type WebhookRouter interface {
+	// Route() returns the name of the route matching a message and the labels of the dispatchers it should be relayed to.
+	// The final boolean is false if no route matches.
+	Route(*Message) (string, []string, bool)
 }
 
 // WebhookReceiver is an interface that defines methods for processing a webhook message on arrival.